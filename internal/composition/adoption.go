@@ -0,0 +1,87 @@
+package composition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/adoption"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// errAdoptionRefused is returned when the release named by the adopt-release annotation cannot be adopted.
+var errAdoptionRefused = errors.New("adoption refused")
+
+// releaseToAdopt returns the name of the release to adopt, verifying that it exists, that it is not owned
+// by another composition and that it has been installed from the chart of the definition. An empty name is
+// returned when there is nothing to adopt, including when the release has already been adopted.
+// A refusal is reported with the ReleaseAdopted condition and an error wrapping errAdoptionRefused.
+func (h *handler) releaseToAdopt(ctx context.Context, mg *unstructured.Unstructured, pkg *archive.Info) (string, error) {
+	name, ok := compositionMeta.GetAdoptRelease(mg)
+	if !ok || name == compositionMeta.GetReleaseName(mg) || h.adoptionInspector == nil {
+		return "", nil
+	}
+
+	reason, err := h.verifyAdoption(ctx, mg, name, pkg)
+	if err != nil {
+		return "", err
+	}
+	if reason != "" {
+		err = setConditionMessage(mg, compositionCondition.AdoptionRefused(), fmt.Sprintf("Release %s cannot be adopted: %s", name, reason))
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: release %s: %s", errAdoptionRefused, name, reason)
+	}
+
+	err = setConditionMessage(mg, compositionCondition.ReleaseAdopted(), fmt.Sprintf("Release %s adopted", name))
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// verifyAdoption returns why the release cannot be adopted, empty if it can.
+func (h *handler) verifyAdoption(ctx context.Context, mg *unstructured.Unstructured, name string, pkg *archive.Info) (string, error) {
+	relChart, err := h.adoptionInspector.ReleaseChart(mg.GetNamespace(), name)
+	if err != nil {
+		return "", fmt.Errorf("getting chart of release to adopt: %w", err)
+	}
+	if relChart == nil {
+		return "release not found", nil
+	}
+
+	if h.ownerGetter != nil {
+		owner, err := h.ownerGetter.Owner(mg.GetNamespace(), name)
+		if err != nil {
+			return "", fmt.Errorf("getting owner of release to adopt: %w", err)
+		}
+		if owner != "" && owner != string(mg.GetUID()) {
+			return fmt.Sprintf("release is owned by another composition (uid %s)", owner), nil
+		}
+	}
+
+	src := adoption.Source{
+		URL:                   pkg.URL,
+		Version:               pkg.Version,
+		Repo:                  pkg.Repo,
+		InsecureSkipTLSverify: pkg.InsecureSkipTLSverify,
+	}
+	if pkg.Auth != nil {
+		src.Username = pkg.Auth.Username
+		src.Password = pkg.Auth.Password
+	}
+	pkgChart, err := h.adoptionInspector.PackageChart(ctx, src)
+	if err != nil {
+		return "", fmt.Errorf("getting chart of composition definition: %w", err)
+	}
+	err = adoption.Verify(relChart, pkgChart)
+	if err != nil {
+		return err.Error(), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,107 @@
+package composition
+
+import (
+	"context"
+	"testing"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/adoption"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAdoptionInspector struct {
+	releases map[string]*adoption.Chart
+	pkg      *adoption.Chart
+}
+
+func (f *fakeAdoptionInspector) ReleaseChart(_, releaseName string) (*adoption.Chart, error) {
+	return f.releases[releaseName], nil
+}
+
+func (f *fakeAdoptionInspector) PackageChart(_ context.Context, _ adoption.Source) (*adoption.Chart, error) {
+	return f.pkg, nil
+}
+
+func TestReleaseToAdopt(t *testing.T) {
+	inspector := &fakeAdoptionInspector{
+		releases: map[string]*adoption.Chart{
+			"postgresql": {Name: "postgresql", Version: "1.1.0"},
+			"mysql":      {Name: "mysql", Version: "1.2.0"},
+		},
+		pkg: &adoption.Chart{Name: "postgresql", Version: "1.2.0"},
+	}
+
+	tests := []struct {
+		name        string
+		adopt       string
+		releaseName string
+		owner       string
+		expected    string
+		reason      string
+		message     string
+	}{
+		{name: "nothing to adopt", releaseName: "demo-12345678"},
+		{name: "already adopted", adopt: "postgresql", releaseName: "postgresql"},
+		{
+			name:        "same chart",
+			adopt:       "postgresql",
+			releaseName: "demo-12345678",
+			expected:    "postgresql",
+			reason:      compositionCondition.ReasonReleaseAdopted,
+			message:     "Release postgresql adopted",
+		},
+		{
+			name:        "other chart",
+			adopt:       "mysql",
+			releaseName: "demo-12345678",
+			reason:      compositionCondition.ReasonAdoptionRefused,
+			message:     "Release mysql cannot be adopted: release chart mysql-1.2.0 differs from the chart postgresql-1.2.0 of the composition definition",
+		},
+		{
+			name:        "not found",
+			adopt:       "redis",
+			releaseName: "demo-12345678",
+			reason:      compositionCondition.ReasonAdoptionRefused,
+			message:     "Release redis cannot be adopted: release not found",
+		},
+		{
+			name:        "owned by another composition",
+			adopt:       "postgresql",
+			releaseName: "demo-12345678",
+			owner:       "5d1e7a0b-3c4f-4e2a-8b9c-7a6d5e4f3b21",
+			reason:      compositionCondition.ReasonAdoptionRefused,
+			message:     "Release postgresql cannot be adopted: release is owned by another composition (uid 5d1e7a0b-3c4f-4e2a-8b9c-7a6d5e4f3b21)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &handler{adoptionInspector: inspector, ownerGetter: &fakeOwnerGetter{owner: tt.owner}}
+			mg := newComposition()
+			compositionMeta.SetReleaseName(mg, tt.releaseName)
+			if tt.adopt != "" {
+				mg.SetAnnotations(map[string]string{compositionMeta.AnnotationKeyAdoptRelease: tt.adopt})
+			}
+
+			adopted, err := h.releaseToAdopt(context.Background(), mg, &archive.Info{URL: "https://charts.example.com", Repo: "postgresql", Version: "1.2.0"})
+			if tt.reason == compositionCondition.ReasonAdoptionRefused {
+				assert.ErrorIs(t, err, errAdoptionRefused)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.expected, adopted)
+
+			if tt.reason == "" {
+				assert.Empty(t, unstructuredtools.GetConditions(mg))
+				return
+			}
+			cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeReleaseAdopted, tt.reason)
+			require.NotNil(t, cond)
+			assert.Equal(t, tt.message, cond.Message)
+		})
+	}
+}
@@ -2,29 +2,35 @@ package composition
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
-
 	xcontext "github.com/krateoplatformops/unstructured-runtime/pkg/context"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/logging"
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/chartinspector"
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
 	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
-	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/rbacgen"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/adoption"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/clientpool"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/history"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/migration"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/ownership"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/processor"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rollout"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/tracer"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/valuesfrom"
 
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rbac"
 	"github.com/krateoplatformops/plumbing/env"
 	helmconfig "github.com/krateoplatformops/plumbing/helm"
-	"github.com/krateoplatformops/plumbing/helm/utils"
-	helmutils "github.com/krateoplatformops/plumbing/helm/utils"
 	"github.com/krateoplatformops/plumbing/helm/v3"
 
 	"github.com/krateoplatformops/plumbing/kubeutil/event"
@@ -36,6 +42,7 @@ import (
 	"github.com/krateoplatformops/unstructured-runtime/pkg/pluralizer"
 	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
 
+	"helm.sh/helm/v3/pkg/kube"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
@@ -44,10 +51,25 @@ import (
 var (
 	krateoNamespace = env.String(krateoNamespaceEnvVar, krateoNamespaceDefault)
 	helmMaxHistory  = env.Int(helmMaxHistoryEnvvar, 3)
+	helmWaitTimeout = env.Duration(helmWaitTimeoutEnvVar, 5*time.Minute)
+
+	releaseNameMigration = env.Bool(releaseNameMigrationEnvVar, false)
+
+	fullVerificationInterval = env.Duration(fullVerificationIntervalEnvVar, 30*time.Minute)
+	resourceCheckInterval    = env.Duration(resourceCheckIntervalEnvVar, 10*time.Minute)
+
+	failedRetryBackoff    = env.Duration(failedRetryBackoffEnvVar, 2*time.Minute)
+	failedRetryMaxBackoff = env.Duration(failedRetryMaxBackoffEnvVar, time.Hour)
+
+	helmClientTTL = env.Duration(helmClientTTLEnvVar, 10*time.Minute)
+
+	sharedClientQPS   = env.Float64(sharedClientQPSEnvVar, 0)
+	sharedClientBurst = env.Int(sharedClientBurstEnvVar, 0)
 )
 
 const (
 	reasonReconciliationGracefullyPaused event.Reason = "ReconciliationGracefullyPaused"
+	reasonReconciliationResumed          event.Reason = "ReconciliationResumed"
 
 	// Event reasons
 	reasonCreated   = "CompositionCreated"
@@ -57,10 +79,35 @@ const (
 	reasonUpdated   = "CompositionUpdated"
 	reasonInstalled = "CompositionInstalled"
 
+	reasonSelfHealed     = "CompositionSelfHealed"
+	reasonSelfHealFailed = "CompositionSelfHealFailed"
+	reasonRolledBack     = "CompositionRolledBack"
+
+	reasonRolledBackToRevision = "CompositionRolledBackToRevision"
+	reasonRollbackFailed       = "CompositionRollbackFailed"
+	reasonRolloutHalted        = "CompositionRolloutHalted"
+	reasonReleaseConflict      = "CompositionReleaseConflict"
+	reasonReleaseAdopted       = "CompositionReleaseAdopted"
+	reasonReleaseNameMigrated  = "CompositionReleaseNameMigrated"
+
 	// Environment variables
 	helmMaxHistoryEnvvar  = "HELM_MAX_HISTORY"
+	helmWaitTimeoutEnvVar = "HELM_WAIT_TIMEOUT"
 	krateoNamespaceEnvVar = "KRATEO_NAMESPACE"
 
+	releaseNameMigrationEnvVar = "RELEASE_NAME_MIGRATION"
+
+	fullVerificationIntervalEnvVar = "FULL_VERIFICATION_INTERVAL"
+	resourceCheckIntervalEnvVar    = "RESOURCE_CHECK_INTERVAL"
+
+	failedRetryBackoffEnvVar    = "FAILED_UPGRADE_RETRY_BACKOFF"
+	failedRetryMaxBackoffEnvVar = "FAILED_UPGRADE_RETRY_MAX_BACKOFF"
+
+	helmClientTTLEnvVar = "HELM_CLIENT_TTL"
+
+	sharedClientQPSEnvVar   = "SHARED_CLIENT_QPS"
+	sharedClientBurstEnvVar = "SHARED_CLIENT_BURST"
+
 	// Default namespace for Krateo Installation
 	krateoNamespaceDefault = "krateo-system"
 )
@@ -74,26 +121,60 @@ func NewHandler(cfg *rest.Config,
 	mapper apimeta.RESTMapper,
 	chartInspectorUrl string,
 	saName string,
-	saNamespace string) controller.ExternalClient {
+	saNamespace string) (controller.ExternalClient, error) {
+
+	// The shared clients keep the client-go rate limit unless overridden, a negative QPS disables it
+	clientCfg := rest.CopyConfig(cfg)
+	if sharedClientQPS != 0 {
+		clientCfg.QPS = float32(sharedClientQPS)
+	}
+	if sharedClientBurst != 0 {
+		clientCfg.Burst = sharedClientBurst
+	}
+	clients := clientpool.New(clientCfg, helmClientTTL)
 
+	valuesWatcher, err := valuesfrom.NewWatcher(cfg, compositionMeta.AnnotationKeyValuesFromRevision)
+	if err != nil {
+		return nil, fmt.Errorf("creating valuesFrom watcher: %w", err)
+	}
+
+	// Helm names the field manager after the binary unless set, drift healing applies with the same one
+	kube.ManagedFieldsManager = helmFieldManager
 	return &handler{
 		kubeconfig:        cfg,
+		clients:           clients,
 		pluralizer:        pluralizer,
+		mapper:            mapper,
 		packageInfoGetter: pig,
 		eventRecorder:     event,
 		chartInspectorUrl: chartInspectorUrl,
 		saName:            saName,
 		saNamespace:       saNamespace,
-	}
+		historyLister:     history.NewLister(clients),
+		ownerGetter:       ownership.NewGetter(clients),
+		ownedReleases:     ownership.NewCache(),
+		adoptionInspector: adoption.NewInspector(clients),
+		releaseRenamer:    migration.NewRenamer(clients),
+		rollouts:          rollout.NewTracker(rolloutTrackerTTL),
+		valuesWatcher:     valuesWatcher,
+	}, nil
 }
 
 type handler struct {
 	kubeconfig    *rest.Config
+	clients       *clientpool.Pool
 	pluralizer    pluralizer.PluralizerInterface
 	eventRecorder event.APIRecorder
 	mapper        apimeta.RESTMapper
 
 	packageInfoGetter archive.Getter
+	historyLister     history.Lister
+	ownerGetter       ownership.Getter
+	ownedReleases     *ownership.Cache
+	adoptionInspector adoption.Inspector
+	releaseRenamer    migration.Renamer
+	rollouts          *rollout.Tracker
+	valuesWatcher     *valuesfrom.Watcher
 
 	chartInspectorUrl string
 	saName            string
@@ -112,7 +193,7 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (c
 		WithValues("name", mg.GetName()).
 		WithValues("namespace", mg.GetNamespace())
 
-	dyn, err := dynamic.NewForConfig(h.kubeconfig)
+	dyn, err := h.clients.Dynamic()
 	if err != nil {
 		return controller.ExternalObservation{}, fmt.Errorf("creating dynamic client: %w", err)
 	}
@@ -124,6 +205,22 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (c
 
 	compositionMeta.SetReleaseName(mg, compositionMeta.CalculateReleaseName(mg))
 	releaseName = compositionMeta.GetReleaseName(mg)
+	if resumeAt, expired := pauseExpired(mg, time.Now()); expired {
+		// Lift the pause, the next upgrade injects 'global.gracefullyPaused=false'
+		log.Debug("Composition graceful pause expired, resuming reconciliation.", "resumeAt", resumeAt)
+		clearPauseStatus(mg)
+		mg, err = tools.UpdateStatus(ctx, mg, updateOpts)
+		if err != nil {
+			return controller.ExternalObservation{}, fmt.Errorf("updating status: %w", err)
+		}
+		compositionMeta.RemoveGracefullyPaused(mg)
+		mg, err = tools.Update(ctx, mg, updateOpts)
+		if err != nil {
+			return controller.ExternalObservation{}, fmt.Errorf("updating cr with values: %w", err)
+		}
+		h.eventRecorder.Event(mg, event.Normal(reasonReconciliationResumed, "Observe",
+			fmt.Sprintf("Reconciliation resumed, the graceful pause expired at %s.", resumeAt.UTC().Format(time.RFC3339))))
+	}
 	if _, p := compositionMeta.GetGracefullyPausedTime(mg); p && compositionMeta.IsGracefullyPaused(mg) {
 		log.Debug("Composition is gracefully paused, skipping observe.")
 		h.eventRecorder.Event(mg, event.Normal(reasonReconciliationGracefullyPaused, "Observe", "Reconciliation is paused via the gracefully paused annotation."))
@@ -139,12 +236,28 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (c
 		return controller.ExternalObservation{}, fmt.Errorf("updating cr with values: %w", err)
 	}
 
+	mg, migrated, err := h.migrateReleaseName(ctx, mg, updateOpts)
+	if err != nil {
+		return controller.ExternalObservation{}, err
+	}
+	if migrated {
+		log.Debug("Composition release name migrated.", "from", releaseName, "to", compositionMeta.GetReleaseName(mg))
+		h.eventRecorder.Event(mg, event.Normal(reasonReleaseNameMigrated, "Observe",
+			fmt.Sprintf("Release %s migrated to %s", releaseName, compositionMeta.GetReleaseName(mg))))
+		releaseName = compositionMeta.GetReleaseName(mg)
+	}
+
 	if h.packageInfoGetter == nil {
 		return controller.ExternalObservation{}, fmt.Errorf("helm chart package info getter must be specified")
 	}
-	pkg, err := h.packageInfoGetter.WithLogger(log).Get(mg)
+	pkg, err := h.packageInfoGetter.WithLogger(log).Get(ctx, mg)
 	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("getting package info: %w", err)
+		retErr := fmt.Errorf("getting package info: %w", err)
+		_, err = updateStepFailed(ctx, mg, compositionCondition.ChartResolutionFailed(), PhaseResolvingChart, retErr, updateOpts)
+		if err != nil {
+			log.Warn("Unable to record reconcile status.", "error", err.Error())
+		}
+		return controller.ExternalObservation{}, retErr
 	}
 
 	compositionMeta.SetCompositionDefinitionLabels(mg, compositionMeta.CompositionDefinitionInfo{
@@ -157,15 +270,16 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (c
 	if err != nil {
 		return controller.ExternalObservation{}, fmt.Errorf("updating cr with values: %w", err)
 	}
+	err = setChartResolved(mg, pkg)
+	if err != nil {
+		return controller.ExternalObservation{}, err
+	}
 
-	hc, err := helm.NewClient(h.kubeconfig,
-		helm.WithNamespace(mg.GetNamespace()),
-		helm.WithLogger(h.getHelmLogger(meta.IsVerbose(mg))),
-		helm.WithCache(),
-	)
+	hc, err := h.clients.Helm(mg.GetNamespace(), meta.IsVerbose(mg))
 	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("creating helm client: %w", err)
+		return controller.ExternalObservation{}, err
 	}
+	defer hc.Release()
 
 	rel, err := hc.GetRelease(ctx, releaseName, &helmconfig.GetConfig{})
 	if err != nil {
@@ -179,6 +293,27 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (c
 		}, nil
 	}
 
+	conflict, err := h.releaseConflict(mg, releaseName, rel.Revision)
+	if err != nil {
+		return controller.ExternalObservation{}, err
+	}
+	if conflict {
+		log.Debug("Composition release is owned by another composition, leaving it untouched.", "release", releaseName)
+		_, err = updatePhase(ctx, mg, PhaseFailed, updateOpts)
+		if err != nil {
+			return controller.ExternalObservation{}, err
+		}
+		return controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: true,
+		}, nil
+	}
+
+	err = h.registerOnDependencies(ctx, dyn, mg)
+	if err != nil {
+		return controller.ExternalObservation{}, fmt.Errorf("registering on dependencies: %w", err)
+	}
+
 	if rel.Status == helmconfig.StatusPendingInstall || rel.Status == helmconfig.StatusPendingUpgrade {
 		log.Debug("Composition stuck install or upgrade in progress. Rolling back to previous release before re-attempting.")
 		// Rollback to previous release
@@ -186,144 +321,137 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (c
 			MaxHistory: helmMaxHistory,
 		})
 		if err != nil {
+			hc.Invalidate()
 			return controller.ExternalObservation{}, fmt.Errorf("rolling back release: %w", err)
 		}
 	}
 
-	compositionGVR, err := h.pluralizer.GVKtoGVR(mg.GroupVersionKind())
-	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("converting GVK to GVR: %w", err)
-	}
-
-	chartInspector := chartinspector.NewChartInspector(h.chartInspectorUrl)
-	rbgen := rbacgen.NewRBACGen(h.saName, h.saNamespace, &chartInspector)
-	// Get Resources and generate RBAC
-	generated, err := rbgen.
-		WithBaseName(releaseName).
-		Generate(rbacgen.Parameters{
-			CompositionName:                mg.GetName(),
-			CompositionNamespace:           mg.GetNamespace(),
-			CompositionGVR:                 compositionGVR,
-			CompositionDefinitionName:      pkg.CompositionDefinitionInfo.Name,
-			CompositionDefinitionNamespace: pkg.CompositionDefinitionInfo.Namespace,
-			CompositionDefintionGVR:        pkg.CompositionDefinitionInfo.GVR,
-		})
-	if err != nil {
-		retErr := fmt.Errorf("generating RBAC using chart-inspector: %w", err)
-		condition := condition.Unavailable()
-		condition.Message = retErr.Error()
-		unstructuredtools.SetConditions(mg, condition)
+	switch action, revision := getRollbackAction(mg); action {
+	case rollbackPaused:
+		log.Debug("Composition rolled back on request, upgrades are paused.", "revision", revision)
+		return controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: true,
+		}, nil
+	case rollbackPerform:
+		log.Debug("Rolling back composition on request.", "revision", revision)
+		retErr := h.rollbackToRevision(ctx, hc, mg, releaseName, revision, getWaitOptions(mg, pkg))
+		if retErr == nil {
+			err = h.refreshHistory(mg, releaseName, true)
+			if err != nil {
+				log.Warn("Unable to refresh release history.", "error", err.Error())
+			}
+		}
 		_, err = tools.UpdateStatus(ctx, mg, updateOpts)
 		if err != nil {
-			return controller.ExternalObservation{}, fmt.Errorf("updating status after failure: %w", err)
+			return controller.ExternalObservation{}, fmt.Errorf("updating status after rollback: %w", err)
 		}
-		return controller.ExternalObservation{}, fmt.Errorf("generating RBAC using chart-inspector: %w", err)
-	}
-	rbInstaller := rbac.NewRBACInstaller(dyn)
-	err = rbInstaller.ApplyRBAC(generated)
-	if err != nil {
-		retErr := fmt.Errorf("applying rbac: %w", err)
-		condition := condition.Unavailable()
-		condition.Message = retErr.Error()
-		unstructuredtools.SetConditions(mg, condition)
-		_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+		if retErr != nil {
+			return controller.ExternalObservation{}, retErr
+		}
+		return controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: true,
+		}, nil
+	case rollbackResume:
+		log.Debug("Resuming composition upgrades after requested rollback.")
+		err = clearRollback(mg)
 		if err != nil {
-			return controller.ExternalObservation{}, fmt.Errorf("updating status after failure: %w", err)
+			return controller.ExternalObservation{}, fmt.Errorf("clearing rollback: %w", err)
+		}
+		mg, err = tools.UpdateStatus(ctx, mg, updateOpts)
+		if err != nil {
+			return controller.ExternalObservation{}, fmt.Errorf("updating status: %w", err)
+		}
+		if _, ok := compositionMeta.GetRollbackToRevision(mg); ok {
+			meta.RemoveAnnotations(mg, compositionMeta.AnnotationKeyRollbackToRevision)
+			mg, err = tools.Update(ctx, mg, updateOpts)
+			if err != nil {
+				return controller.ExternalObservation{}, fmt.Errorf("updating cr with values: %w", err)
+			}
 		}
-		return controller.ExternalObservation{}, retErr
 	}
 
-	tracer := tracer.NewTracer(ctx, meta.IsVerbose(mg))
-	cfg := rest.CopyConfig(h.kubeconfig)
-	cfg.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
-		return tracer.WithRoundTripper(rt)
-	}
-	hc, err = helm.NewClient(cfg,
-		helm.WithNamespace(mg.GetNamespace()),
-		helm.WithCache(),
-	)
-	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("getting helm client: %w", err)
+	if rel.Status == helmconfig.StatusFailed {
+		return h.observeFailedRelease(ctx, log, dyn, mg, pkg, rel, updateOpts)
 	}
 
-	values, err := helmutils.ValuesFromSpec(mg)
+	digest, err := processor.ComputeReleaseDigest(rel)
 	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("getting spec values: %w", err)
+		return controller.ExternalObservation{}, fmt.Errorf("computing deployed release digest: %w", err)
 	}
-	err = values.InjectGlobalValues(mg, h.pluralizer, krateoNamespace)
+	actionConfig, err := h.buildActionConfig(ctx, dyn, mg, pkg)
 	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("injecting global values: %w", err)
+		return controller.ExternalObservation{}, err
 	}
-	postrenderLabels, err := utils.LabelPostRenderFromSpec(mg, h.pluralizer, krateoNamespace)
+	fingerprint, err := inputFingerprint(mg, pkg, actionConfig, rel)
 	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("creating label post renderer: %w", err)
+		return controller.ExternalObservation{}, fmt.Errorf("computing input fingerprint: %w", err)
 	}
-	upgradedRel, err := hc.Upgrade(ctx, releaseName, pkg.URL, &helmconfig.UpgradeConfig{
-		ActionConfig: &helmconfig.ActionConfig{
-			ChartVersion:          pkg.Version,
-			ChartName:             pkg.Repo,
-			Username:              pkg.Auth.Username,
-			Password:              pkg.Auth.Password,
-			InsecureSkipTLSverify: pkg.InsecureSkipTLSverify,
-			Values:                values,
-			PostRenderer:          postrenderLabels,
-		},
-		MaxHistory: helmMaxHistory,
-	})
-	if err != nil {
-		retErr := fmt.Errorf("upgrading helm chart: %w", err)
-		condition := condition.Unavailable()
-		condition.Message = retErr.Error()
-		unstructuredtools.SetConditions(mg, condition)
-		_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+	verified := inputsVerified(mg, fingerprint, time.Now())
+	if verified {
+		log.Debug("Composition inputs unchanged since the last full verification, skipping release rendering.", "fingerprint", fingerprint)
+	} else {
+		obs, err := h.verifyRelease(ctx, log, dyn, hc, mg, pkg, rel, digest, actionConfig, updateOpts)
 		if err != nil {
-			return controller.ExternalObservation{}, fmt.Errorf("updating status after failure: %w", err)
+			return controller.ExternalObservation{}, err
+		}
+		if obs != nil {
+			return *obs, nil
+		}
+		err = setInputFingerprint(mg, fingerprint, time.Now())
+		if err != nil {
+			return controller.ExternalObservation{}, err
 		}
-		return controller.ExternalObservation{}, retErr
-	}
-
-	digest, err := processor.ComputeReleaseDigest(upgradedRel)
-	if err != nil {
-		return controller.ExternalObservation{}, fmt.Errorf("computing release digest: %w", err)
 	}
 
-	previousDigest, err := maps.NestedString(mg.Object, "status", "digest")
+	previousDigest, err := maps.NestedString(mg.Object, "status", "previousDigest")
 	if err != nil {
 		return controller.ExternalObservation{}, fmt.Errorf("getting previous digest from status: %w", err)
 	}
-	if previousDigest == "" {
-		// Calculate the digest from the previous release if not present in status
-		log.Debug("Previous digest not found in status, calculating from previous release")
-		previousDigest, err = processor.ComputeReleaseDigest(rel)
+
+	var unhealthy []string
+	var healthMessage string
+	if verified && resourcesChecked(mg, time.Now()) {
+		log.Debug("Composition resources checked within the resource check interval, skipping drift, health and outputs.")
+	} else {
+		unhealthy, healthMessage, err = h.checkResources(ctx, log, dyn, mg, pkg, rel)
 		if err != nil {
-			return controller.ExternalObservation{}, fmt.Errorf("computing release digest from previous release: %w", err)
+			return controller.ExternalObservation{}, err
 		}
 	}
-	if digest != previousDigest {
-		log.Debug("Composition out-of-date.", "package", pkg.URL, "current", digest, "expected", previousDigest)
-		return controller.ExternalObservation{
-			ResourceExists:   true,
-			ResourceUpToDate: false,
-		}, nil
+
+	if historyOutdated(mg, rel.Revision) {
+		err = h.refreshHistory(mg, releaseName, true)
+		if err != nil {
+			log.Warn("Unable to refresh release history.", "error", err.Error())
+		}
 	}
 
-	if rel.ChartVersion != upgradedRel.ChartVersion {
-		log.Debug("Composition package version mismatch.", "package", pkg.URL, "installed", rel.ChartVersion, "expected", pkg.Version)
-		return controller.ExternalObservation{
-			ResourceExists:   true,
-			ResourceUpToDate: false,
-		}, nil
+	err = clearUpgradePending(mg)
+	if err != nil {
+		return controller.ExternalObservation{}, fmt.Errorf("clearing pending upgrade: %w", err)
+	}
+	err = setReleaseDeployed(mg, rel)
+	if err != nil {
+		return controller.ExternalObservation{}, err
 	}
 
+	message, conditionType, phase := "Composition is up-to-date", ConditionTypeAvailable, PhaseReady
+	if len(unhealthy) > 0 {
+		log.Debug("Composition resources are not healthy.", "count", len(unhealthy))
+		message, conditionType, phase = "Composition is up-to-date, but "+healthMessage, ConditionTypeUnavailable, convergingPhase(mg)
+	}
 	err = h.setStatus(mg, &statusManagerOpts{
 		force:          false,
-		resources:      nil, // we don't need to set resources here as they are already set when a resource is created/updated
+		resources:      nil, // managed resources are refreshed above together with their health
 		previousDigest: previousDigest,
 		digest:         digest,
-		message:        "Composition is up-to-date",
+		message:        message,
 		chartURL:       pkg.URL,
 		chartVersion:   pkg.Version,
-		conditionType:  ConditionTypeAvailable,
+		conditionType:  conditionType,
+		phase:          phase,
 	})
 	if err != nil {
 		return controller.ExternalObservation{}, err
@@ -342,6 +470,238 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (c
 	}, nil
 }
 
+// checkResources detects and heals the drift of the release resources, evaluates their health and
+// publishes the outputs of the composition. It returns the unhealthy resources with the message describing them.
+// Drift detection and outputs are informative only, their failures are logged and do not fail the check.
+func (h *handler) checkResources(ctx context.Context, log logging.Logger, dyn dynamic.Interface, mg *unstructured.Unstructured, pkg *archive.Info, rel *helmconfig.Release) ([]string, string, error) {
+	clean := true
+	drifted, err := h.detectDrift(ctx, dyn, mg, rel)
+	if err != nil {
+		log.Warn("Unable to detect drift of release resources.", "error", err.Error())
+		clean = false
+	} else {
+		if len(drifted) > 0 {
+			log.Debug("Composition resources drifted from the release manifest.", "count", len(drifted))
+		}
+		if len(drifted) > 0 && selfHealEnabled(mg, pkg) {
+			healed, failed, err := h.healDrift(ctx, dyn, mg, rel, drifted)
+			if len(healed) > 0 {
+				log.Debug("Composition drifted resources self-healed.", "count", len(healed))
+				h.eventRecorder.Event(mg, event.Normal(reasonSelfHealed, "Observe", fmt.Sprintf("Self-healed %d drifted object(s): %s", len(healed), describeDrift(healed))))
+			}
+			if err != nil {
+				log.Warn("Unable to self-heal drifted resources.", "error", err.Error())
+				h.eventRecorder.Event(mg, event.Warning(reasonSelfHealFailed, "Observe", err))
+			}
+			drifted = failed
+		}
+		err = setDrift(mg, drifted)
+		if err != nil {
+			return nil, "", fmt.Errorf("setting drift status: %w", err)
+		}
+		clean = len(drifted) == 0
+	}
+
+	// Refresh the managed resources with their live health, the composition is only
+	// reported as available when all of them are healthy.
+	all, _, err := processor.DecodeMinRelease(rel)
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding release: %w", err)
+	}
+	managed, err := h.populateManagedResources(all)
+	if err != nil {
+		return nil, "", fmt.Errorf("populating managed resources: %w", err)
+	}
+	unhealthy := h.evaluateManagedHealth(ctx, dyn, managed)
+	setManagedResources(mg, managed)
+	healthMessage, err := setResourcesHealth(mg, unhealthy)
+	if err != nil {
+		return nil, "", fmt.Errorf("setting resources health: %w", err)
+	}
+	if len(unhealthy) == 0 {
+		h.rolloutDone(mg)
+	}
+
+	err = h.publishOutputs(ctx, dyn, mg, pkg, rel)
+	if err != nil {
+		log.Warn("Unable to publish composition outputs.", "error", err.Error())
+		clean = false
+	}
+
+	// Only a clean check can be trusted until the next one, anything to report is checked again on every observe
+	err = setResourcesChecked(mg, clean && len(unhealthy) == 0, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	return unhealthy, healthMessage, nil
+}
+
+// verifyRelease regenerates and applies the RBAC policy of the release and renders the desired release
+// with a server-side dry-run, to find out whether the deployed release is up-to-date. It returns the
+// observation Observe must end with, or nil when the deployed release matches the desired one.
+func (h *handler) verifyRelease(ctx context.Context, log logging.Logger, dyn dynamic.Interface, hc *clientpool.Lease, mg *unstructured.Unstructured, pkg *archive.Info, rel *helmconfig.Release, digest string, actionConfig *helmconfig.ActionConfig, updateOpts tools.UpdateOptions) (*controller.ExternalObservation, error) {
+	releaseName := compositionMeta.GetReleaseName(mg)
+
+	compositionGVR, err := h.pluralizer.GVKtoGVR(mg.GroupVersionKind())
+	if err != nil {
+		return nil, fmt.Errorf("converting GVK to GVR: %w", err)
+	}
+
+	chartInspector := chartinspector.NewChartInspector(h.chartInspectorUrl)
+	rbgen := rbacgen.NewRBACGen(h.saName, h.saNamespace, &chartInspector)
+	// Get Resources and generate RBAC
+	params := rbacgen.Parameters{
+		CompositionName:                mg.GetName(),
+		CompositionNamespace:           mg.GetNamespace(),
+		CompositionGVR:                 compositionGVR,
+		CompositionDefinitionName:      pkg.CompositionDefinitionInfo.Name,
+		CompositionDefinitionNamespace: pkg.CompositionDefinitionInfo.Namespace,
+		CompositionDefintionGVR:        pkg.CompositionDefinitionInfo.GVR,
+	}
+	generated, err := rbgen.
+		WithBaseName(releaseName).
+		Generate(params)
+	if err != nil {
+		retErr := fmt.Errorf("generating RBAC using chart-inspector: %w", err)
+		_, err = updateStepFailed(ctx, mg, compositionCondition.RBACGenerationFailed(), PhaseGeneratingRBAC, retErr, updateOpts)
+		if err != nil {
+			return nil, fmt.Errorf("updating status after failure: %w", err)
+		}
+		return nil, retErr
+	}
+	rbInstaller := rbac.NewRBACInstaller(dyn)
+	err = rbInstaller.ApplyRBAC(generated)
+	if err != nil {
+		retErr := fmt.Errorf("applying rbac: %w", err)
+		_, err = updateStepFailed(ctx, mg, compositionCondition.RBACApplyFailed(), PhaseGeneratingRBAC, retErr, updateOpts)
+		if err != nil {
+			return nil, fmt.Errorf("updating status after failure: %w", err)
+		}
+		return nil, retErr
+	}
+	// The policy generated under the release name used before a migration is left behind otherwise
+	retErr := h.removePreviousRBAC(dyn, mg, rbgen, params)
+	if retErr != nil {
+		_, err = updateStepFailed(ctx, mg, compositionCondition.RBACApplyFailed(), PhaseGeneratingRBAC, retErr, updateOpts)
+		if err != nil {
+			return nil, fmt.Errorf("updating status after failure: %w", err)
+		}
+		return nil, retErr
+	}
+	err = setRBACReady(mg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Traced requests are only dumped for verbose compositions, which get a dedicated client for the dry-run
+	renderer := helmconfig.Client(hc)
+	if meta.IsVerbose(mg) {
+		tracer := tracer.NewTracer(ctx, true)
+		cfg := rest.CopyConfig(h.kubeconfig)
+		cfg.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			return tracer.WithRoundTripper(rt)
+		}
+		traced, err := helm.NewClient(cfg,
+			helm.WithNamespace(mg.GetNamespace()),
+			helm.WithLogger(h.getHelmLogger(true)),
+			helm.WithCache(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("getting helm client: %w", err)
+		}
+		defer traced.Close()
+		renderer = traced
+	}
+
+	// Render the desired release with a server-side dry-run so that Observe never mutates the cluster
+	// nor creates a new Helm revision. The actual upgrade is performed by Update.
+	actionConfig.DryRun = helmconfig.DryRunServer
+	desiredRel, err := renderer.Upgrade(ctx, releaseName, pkg.URL, &helmconfig.UpgradeConfig{
+		ActionConfig: actionConfig,
+		MaxHistory:   helmMaxHistory,
+	})
+	if err != nil {
+		retErr := fmt.Errorf("rendering helm chart (dry-run): %w", err)
+		hc.Invalidate()
+		_, err = updateStepFailed(ctx, mg, compositionCondition.RenderFailed(), PhaseFailed, retErr, updateOpts)
+		if err != nil {
+			return nil, fmt.Errorf("updating status after failure: %w", err)
+		}
+		return nil, retErr
+	}
+
+	desiredDigest, err := processor.ComputeReleaseDigest(desiredRel)
+	if err != nil {
+		return nil, fmt.Errorf("computing desired release digest: %w", err)
+	}
+
+	if digest != desiredDigest || rel.ChartVersion != desiredRel.ChartVersion {
+		waiting, err := h.deferToDependencies(ctx, dyn, mg, updateOpts)
+		if err != nil {
+			return nil, err
+		}
+		if waiting {
+			log.Debug("Composition upgrade deferred until its dependencies are available.")
+			return &controller.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: true,
+			}, nil
+		}
+		deferred, err := deferToMaintenanceWindow(ctx, mg, pkg, updateOpts)
+		if err != nil {
+			return nil, err
+		}
+		if deferred {
+			log.Debug("Composition upgrade deferred until the next maintenance window.")
+			return &controller.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: true,
+			}, nil
+		}
+		// A failed upgrade rolled back in atomic mode leaves the release deployed and out-of-date
+		deferred, err = h.deferToRetryBackoff(log, mg, pkg, actionConfig, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if deferred {
+			return &controller.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: true,
+			}, nil
+		}
+	}
+
+	if rel.ChartVersion != desiredRel.ChartVersion {
+		deferred, err := h.deferToRollout(ctx, log, dyn, mg, pkg, desiredRel.ChartVersion, updateOpts)
+		if err != nil {
+			return nil, err
+		}
+		if deferred {
+			return &controller.ExternalObservation{
+				ResourceExists:   true,
+				ResourceUpToDate: true,
+			}, nil
+		}
+	}
+
+	if digest != desiredDigest {
+		log.Debug("Composition out-of-date.", "package", pkg.URL, "deployed", digest, "desired", desiredDigest)
+		return &controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: false,
+		}, nil
+	}
+
+	if rel.ChartVersion != desiredRel.ChartVersion {
+		log.Debug("Composition package version mismatch.", "package", pkg.URL, "installed", rel.ChartVersion, "expected", desiredRel.ChartVersion)
+		return &controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: false,
+		}, nil
+	}
+	return nil, nil
+}
+
 func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) error {
 	mg = mg.DeepCopy()
 
@@ -352,7 +712,7 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		WithValues("name", mg.GetName()).
 		WithValues("namespace", mg.GetNamespace())
 
-	dyn, err := dynamic.NewForConfig(h.kubeconfig)
+	dyn, err := h.clients.Dynamic()
 	if err != nil {
 		return fmt.Errorf("creating dynamic client: %w", err)
 	}
@@ -375,14 +735,61 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		return fmt.Errorf("updating cr with values: %w", err)
 	}
 
+	waiting, err := h.deferToDependencies(ctx, dyn, mg, updateOpts)
+	if err != nil {
+		return err
+	}
+	if waiting {
+		log.Debug("Composition install deferred until its dependencies are available.")
+		return nil
+	}
+
 	if h.packageInfoGetter == nil {
 		return fmt.Errorf("helm chart package info getter must be specified")
 	}
 
-	pkg, err := h.packageInfoGetter.WithLogger(log).Get(mg)
+	pkg, err := h.packageInfoGetter.WithLogger(log).Get(ctx, mg)
 	if err != nil {
-		return fmt.Errorf("getting package info: %w", err)
+		retErr := fmt.Errorf("getting package info: %w", err)
+		_, err = updateStepFailed(ctx, mg, compositionCondition.ChartResolutionFailed(), PhaseResolvingChart, retErr, updateOpts)
+		if err != nil {
+			log.Warn("Unable to record reconcile status.", "error", err.Error())
+		}
+		return retErr
+	}
+	err = setChartResolved(mg, pkg)
+	if err != nil {
+		return err
+	}
+
+	adopted, err := h.releaseToAdopt(ctx, mg, pkg)
+	if errors.Is(err, errAdoptionRefused) {
+		log.Debug("Composition release adoption refused.", "error", err.Error())
+		_, updateErr := tools.UpdateStatus(ctx, mg, updateOpts)
+		if updateErr != nil {
+			return fmt.Errorf("updating status: %w", updateErr)
+		}
+		return err
 	}
+	if err != nil {
+		return fmt.Errorf("checking release to adopt: %w", err)
+	}
+	if adopted != "" {
+		// The release is upgraded with the values of the composition instead of installing a new one
+		log.Debug("Adopting existing release.", "release", adopted)
+		mg, err = tools.UpdateStatus(ctx, mg, updateOpts)
+		if err != nil {
+			return fmt.Errorf("updating status: %w", err)
+		}
+		compositionMeta.ReplaceReleaseName(mg, adopted)
+		releaseName = adopted
+		mg, err = tools.Update(ctx, mg, updateOpts)
+		if err != nil {
+			return fmt.Errorf("updating cr with values: %w", err)
+		}
+		h.eventRecorder.Event(mg, event.Normal(reasonReleaseAdopted, "Create", fmt.Sprintf("Adopting release %s: %s", adopted, mg.GetName())))
+	}
+
 	compositionGVR, err := h.pluralizer.GVKtoGVR(mg.GroupVersionKind())
 	if err != nil {
 		return fmt.Errorf("converting GVK to GVR: %w", err)
@@ -402,43 +809,51 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 			CompositionDefintionGVR:        pkg.CompositionDefinitionInfo.GVR,
 		})
 	if err != nil {
-		return fmt.Errorf("generating RBAC using chart-inspector: %w", err)
+		retErr := fmt.Errorf("generating RBAC using chart-inspector: %w", err)
+		_, err = updateStepFailed(ctx, mg, compositionCondition.RBACGenerationFailed(), PhaseGeneratingRBAC, retErr, updateOpts)
+		if err != nil {
+			log.Warn("Unable to record reconcile status.", "error", err.Error())
+		}
+		return retErr
 	}
 	rbInstaller := rbac.NewRBACInstaller(dyn)
 	err = rbInstaller.ApplyRBAC(generated)
 	if err != nil {
-		return fmt.Errorf("installing rbac: %w", err)
+		retErr := fmt.Errorf("installing rbac: %w", err)
+		_, err = updateStepFailed(ctx, mg, compositionCondition.RBACApplyFailed(), PhaseGeneratingRBAC, retErr, updateOpts)
+		if err != nil {
+			log.Warn("Unable to record reconcile status.", "error", err.Error())
+		}
+		return retErr
 	}
-
-	hc, err := helm.NewClient(h.kubeconfig,
-		helm.WithNamespace(mg.GetNamespace()),
-		helm.WithLogger(h.getHelmLogger(meta.IsVerbose(mg))),
-	)
+	err = setRBACReady(mg)
 	if err != nil {
-		return fmt.Errorf("creating helm client: %w", err)
+		return err
 	}
 
-	values, err := helmutils.ValuesFromSpec(mg)
+	hc, err := h.clients.Helm(mg.GetNamespace(), meta.IsVerbose(mg))
 	if err != nil {
-		return fmt.Errorf("getting spec values: %w", err)
+		return err
 	}
-	err = values.InjectGlobalValues(mg, h.pluralizer, krateoNamespace)
-	if err != nil {
-		return fmt.Errorf("injecting global values: %w", err)
-	}
-	postrenderLabels, err := utils.LabelPostRenderFromSpec(mg, h.pluralizer, krateoNamespace)
+	defer hc.Release()
+
+	actionConfig, err := h.buildActionConfig(ctx, dyn, mg, pkg)
 	if err != nil {
-		return fmt.Errorf("creating label post renderer: %w", err)
+		return err
 	}
 
-	actionConfig := &helmconfig.ActionConfig{
-		ChartVersion:          pkg.Version,
-		ChartName:             pkg.Repo,
-		Values:                values,
-		Username:              pkg.Auth.Username,
-		Password:              pkg.Auth.Password,
-		InsecureSkipTLSverify: pkg.InsecureSkipTLSverify,
-		PostRenderer:          postrenderLabels,
+	wait := getWaitOptions(mg, pkg)
+	wait.apply(actionConfig)
+	if wait.enabled {
+		log.Debug("Waiting for composition resources to be ready.", "timeout", wait.timeout.String())
+		err = setProgressing(mg, wait.timeout)
+		if err != nil {
+			return fmt.Errorf("setting progressing condition: %w", err)
+		}
+	}
+	mg, err = updatePhase(ctx, mg, PhaseInstalling, updateOpts)
+	if err != nil {
+		return err
 	}
 
 	// Check if the release already exists before attempting to install, this can happen if the create event is triggered after a failed install
@@ -447,6 +862,17 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		return fmt.Errorf("finding helm release: %w", err)
 	}
 	if rel != nil {
+		conflict, err := h.releaseConflict(mg, releaseName, rel.Revision)
+		if err != nil {
+			return err
+		}
+		if conflict {
+			log.Debug("Release already exists and is owned by another composition, leaving it untouched.", "release", releaseName)
+			h.eventRecorder.Event(mg, event.Warning(reasonReleaseConflict, "Create",
+				fmt.Errorf("release %s is owned by another composition", releaseName)))
+			_, err = updatePhase(ctx, mg, PhaseFailed, updateOpts)
+			return err
+		}
 		log.Debug("Release already exists, upgrading instead of installing.")
 		rel, err = hc.Upgrade(ctx, releaseName, pkg.URL, &helmconfig.UpgradeConfig{
 			ActionConfig: actionConfig,
@@ -456,9 +882,32 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		rel, err = hc.Install(ctx, releaseName, pkg.URL, &helmconfig.InstallConfig{
 			ActionConfig: actionConfig,
 		})
+	}
+	if err != nil {
+		retErr := fmt.Errorf("installing helm chart: %w", err)
+		hc.Invalidate()
+		failed, err := h.reportWaitFailure(ctx, dyn, hc, mg, releaseName, wait, "Create", retErr)
 		if err != nil {
-			return fmt.Errorf("installing helm chart: %w", err)
+			log.Warn("Unable to report unready composition resources.", "error", err.Error())
 		}
+		err = setDeployFailed(mg, compositionCondition.InstallFailed(), retErr.Error(), failed)
+		if err != nil {
+			return err
+		}
+		// A failed pre-install or post-install hook is reported as well
+		err = h.refreshHistory(mg, releaseName, true)
+		if err != nil {
+			log.Warn("Unable to refresh release history.", "error", err.Error())
+		}
+		err = setReconcileStatus(mg, PhaseFailed, time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+		if err != nil {
+			return fmt.Errorf("updating status after failure: %w", err)
+		}
+		return retErr
 	}
 
 	log.Debug("Installing composition package", "package", pkg.URL)
@@ -467,6 +916,14 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 	if err != nil {
 		return fmt.Errorf("decoding release: %w", err)
 	}
+	err = setReleaseDeployed(mg, rel)
+	if err != nil {
+		return err
+	}
+	err = setDeployedResourcesHealth(mg, wait)
+	if err != nil {
+		return err
+	}
 
 	err = h.setStatus(mg, &statusManagerOpts{
 		force:          true,
@@ -477,10 +934,24 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		chartURL:       pkg.URL,
 		chartVersion:   pkg.Version,
 		conditionType:  ConditionTypeAvailable,
+		phase:          installedPhase(wait, PhaseInstalling),
 	})
 	if err != nil {
 		return fmt.Errorf("setting status: %w", err)
 	}
+	err = removeCondition(mg, compositionCondition.TypeWaitingForDependencies)
+	if err != nil {
+		return fmt.Errorf("clearing dependencies condition: %w", err)
+	}
+	err = h.publishOutputs(ctx, dyn, mg, pkg, rel)
+	if err != nil {
+		log.Warn("Unable to publish composition outputs.", "error", err.Error())
+	}
+
+	err = h.refreshHistory(mg, releaseName, true)
+	if err != nil {
+		log.Warn("Unable to refresh release history.", "error", err.Error())
+	}
 
 	log.Debug("Composition created.", "package", pkg.URL)
 
@@ -511,7 +982,7 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		WithValues("name", mg.GetName()).
 		WithValues("namespace", mg.GetNamespace())
 
-	dyn, err := dynamic.NewForConfig(h.kubeconfig)
+	dyn, err := h.clients.Dynamic()
 	if err != nil {
 		return fmt.Errorf("creating dynamic client: %w", err)
 	}
@@ -533,38 +1004,146 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		return fmt.Errorf("helm chart package info getter must be specified")
 	}
 
-	pkg, err := h.packageInfoGetter.WithLogger(log).Get(mg)
+	pkg, err := h.packageInfoGetter.WithLogger(log).Get(ctx, mg)
 	if err != nil {
-		return fmt.Errorf("getting package info: %w", err)
+		retErr := fmt.Errorf("getting package info: %w", err)
+		_, err = updateStepFailed(ctx, mg, compositionCondition.ChartResolutionFailed(), PhaseResolvingChart, retErr, updateOpts)
+		if err != nil {
+			log.Warn("Unable to record reconcile status.", "error", err.Error())
+		}
+		return retErr
 	}
 
 	// Update the helm chart
-	hc, err := helm.NewClient(h.kubeconfig,
-		helm.WithNamespace(mg.GetNamespace()),
-		helm.WithLogger(h.getHelmLogger(meta.IsVerbose(mg))),
-	)
+	hc, err := h.clients.Helm(mg.GetNamespace(), meta.IsVerbose(mg))
 	if err != nil {
-		return fmt.Errorf("creating helm client: %w", err)
+		return err
 	}
+	defer hc.Release()
 
-	upgradedRel, err := hc.GetRelease(ctx, releaseName, &helmconfig.GetConfig{})
+	rel, err := hc.GetRelease(ctx, releaseName, &helmconfig.GetConfig{})
 	if err != nil {
 		return fmt.Errorf("getting helm release: %w", err)
 	}
-	if upgradedRel == nil {
-		log.Debug("Composition not found after upgrade.")
-		return fmt.Errorf("composition not found after upgrade")
+	if rel == nil {
+		log.Debug("Composition not found, cannot upgrade.")
+		return fmt.Errorf("composition not found, release %s does not exist", releaseName)
 	}
 
-	previousDigest, err := maps.NestedString(mg.Object, "status", "digest")
+	conflict, err := h.releaseConflict(mg, releaseName, rel.Revision)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		log.Debug("Composition release is owned by another composition, skipping upgrade.", "release", releaseName)
+		h.eventRecorder.Event(mg, event.Warning(reasonReleaseConflict, "Update",
+			fmt.Errorf("release %s is owned by another composition", releaseName)))
+		_, err = updatePhase(ctx, mg, PhaseFailed, updateOpts)
+		return err
+	}
+
+	previousDigest, err := processor.ComputeReleaseDigest(rel)
+	if err != nil {
+		return fmt.Errorf("computing previous release digest: %w", err)
+	}
+
+	actionConfig, err := h.buildActionConfig(ctx, dyn, mg, pkg)
+	if err != nil {
+		return err
+	}
+
+	wait := getWaitOptions(mg, pkg)
+	wait.apply(actionConfig)
+	if wait.enabled {
+		log.Debug("Waiting for composition resources to be ready.", "timeout", wait.timeout.String())
+		err = setProgressing(mg, wait.timeout)
+		if err != nil {
+			return fmt.Errorf("setting progressing condition: %w", err)
+		}
+	}
+	mg, err = updatePhase(ctx, mg, PhaseUpgrading, updateOpts)
 	if err != nil {
-		return fmt.Errorf("getting previous digest from status: %w", err)
+		return err
+	}
+
+	upgradedRel, err := hc.Upgrade(ctx, releaseName, pkg.URL, &helmconfig.UpgradeConfig{
+		ActionConfig: actionConfig,
+		MaxHistory:   helmMaxHistory,
+	})
+	if err != nil {
+		retErr := fmt.Errorf("upgrading helm chart: %w", err)
+		hc.Invalidate()
+		h.rolloutDone(mg)
+		failed, err := h.reportWaitFailure(ctx, dyn, hc, mg, releaseName, wait, "Update", retErr)
+		if err != nil {
+			log.Warn("Unable to report unready composition resources.", "error", err.Error())
+		}
+		// Refresh the hooks before rolling back, so that a failed pre-upgrade or post-upgrade hook is reported
+		err = h.refreshHistory(mg, releaseName, true)
+		if err != nil {
+			log.Warn("Unable to refresh release history.", "error", err.Error())
+		}
+		message := retErr.Error()
+		failure := &failedUpgrade{chartVersion: pkg.Version}
+		if atomicEnabled(mg, pkg) {
+			rolledBack, err := h.rollbackFailedUpgrade(ctx, hc, mg, releaseName, rel, wait)
+			if err != nil {
+				log.Warn("Unable to roll back failed upgrade.", "error", err.Error())
+				message = fmt.Sprintf("%s; %s", message, err.Error())
+			} else if rolledBack != nil {
+				log.Debug("Composition failed upgrade rolled back.", "failedRevision", rolledBack.revision, "restoredRevision", rolledBack.restored)
+				failure = rolledBack
+				message = fmt.Sprintf("%s; rolled back to revision %d", message, rolledBack.restored)
+				h.eventRecorder.Event(mg, event.Warning(reasonRolledBack, "Update",
+					fmt.Errorf("upgrade to chart version %s failed (revision %d), rolled back to revision %d: %w", rolledBack.chartVersion, rolledBack.revision, rolledBack.restored, retErr)))
+			}
+		}
+		inputs, err := upgradeInputs(mg, pkg, actionConfig)
+		if err != nil {
+			return fmt.Errorf("computing upgrade inputs: %w", err)
+		}
+		err = setLastFailure(mg, failure, inputs, retErr, time.Now())
+		if err != nil {
+			return fmt.Errorf("setting last failure: %w", err)
+		}
+		err = setDeployFailed(mg, compositionCondition.UpgradeFailed(), message, failed)
+		if err != nil {
+			return err
+		}
+		if failure.restored > 0 {
+			// Keep the hooks of the failed upgrade rather than those of the rollback
+			err = h.refreshHistory(mg, releaseName, false)
+			if err != nil {
+				log.Warn("Unable to refresh release history.", "error", err.Error())
+			}
+		}
+		err = setReconcileStatus(mg, PhaseFailed, time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+		if err != nil {
+			return fmt.Errorf("updating status after failure: %w", err)
+		}
+		return retErr
 	}
 
 	all, digest, err := processor.DecodeMinRelease(upgradedRel)
 	if err != nil {
 		return fmt.Errorf("decoding release: %w", err)
 	}
+	err = setReleaseDeployed(mg, upgradedRel)
+	if err != nil {
+		return err
+	}
+	clearFailedAttempts(mg)
+	err = setDeployedResourcesHealth(mg, wait)
+	if err != nil {
+		return err
+	}
+	if wait.enabled {
+		h.rolloutDone(mg)
+	}
 
 	managed, err := h.populateManagedResources(all)
 	if err != nil {
@@ -585,11 +1164,41 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		chartURL:       pkg.URL,
 		chartVersion:   pkg.Version,
 		conditionType:  ConditionTypeAvailable,
+		phase:          installedPhase(wait, PhaseUpgrading),
+	}
+	paused, pausedAt := compositionMeta.IsGracefullyPaused(mg), time.Now()
+	if paused {
+		statusOpts.conditionType = ConditionTypeReconcileGracefullyPaused
+		statusOpts.phase = PhasePaused
+		compositionMeta.SetGracefullyPausedTime(mg, pausedAt)
+		err = setPauseStatus(mg)
+		if err != nil {
+			return fmt.Errorf("setting pause status: %w", err)
+		}
+	} else {
+		clearPauseStatus(mg)
 	}
 	err = h.setStatus(mg, statusOpts)
 	if err != nil {
 		return fmt.Errorf("setting status: %w", err)
 	}
+	err = clearUpgradePending(mg)
+	if err != nil {
+		return fmt.Errorf("clearing pending upgrade: %w", err)
+	}
+	err = removeCondition(mg, compositionCondition.TypeWaitingForDependencies)
+	if err != nil {
+		return fmt.Errorf("clearing dependencies condition: %w", err)
+	}
+	err = h.publishOutputs(ctx, dyn, mg, pkg, upgradedRel)
+	if err != nil {
+		log.Warn("Unable to publish composition outputs.", "error", err.Error())
+	}
+
+	err = h.refreshHistory(mg, releaseName, true)
+	if err != nil {
+		log.Warn("Unable to refresh release history.", "error", err.Error())
+	}
 
 	mg, err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
 		Pluralizer:    h.pluralizer,
@@ -599,14 +1208,12 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		return fmt.Errorf("updating cr status with values: %w", err)
 	}
 
-	if compositionMeta.IsGracefullyPaused(mg) {
-		statusOpts.conditionType = ConditionTypeReconcileGracefullyPaused
-		compositionMeta.SetGracefullyPausedTime(mg, time.Now())
+	if paused {
+		compositionMeta.SetGracefullyPausedTime(mg, pausedAt)
 		log.Debug("Composition gracefully paused.")
 		h.eventRecorder.Event(mg, event.Normal(reasonReconciliationGracefullyPaused, "Update", "Reconciliation paused via the gracefully paused annotation."))
 
 	} else {
-		statusOpts.conditionType = ConditionTypeAvailable
 		meta.RemoveAnnotations(mg, compositionMeta.AnnotationKeyReconciliationGracefullyPausedTime)
 	}
 
@@ -630,7 +1237,7 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 		WithValues("name", mg.GetName()).
 		WithValues("namespace", mg.GetNamespace())
 
-	dyn, err := dynamic.NewForConfig(h.kubeconfig)
+	dyn, err := h.clients.Dynamic()
 	if err != nil {
 		return fmt.Errorf("creating dynamic client: %w", err)
 	}
@@ -646,19 +1253,32 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 		return nil
 	}
 
+	dependents, err := h.remainingDependents(ctx, dyn, mg)
+	if err != nil {
+		return fmt.Errorf("checking dependents: %w", err)
+	}
+	if len(dependents) > 0 {
+		log.Debug("Composition deletion blocked by its dependents.", "dependents", dependents)
+		return fmt.Errorf("composition is still required by %d dependent(s): %s", len(dependents), strings.Join(dependents, "; "))
+	}
+
+	mg, err = updatePhase(ctx, mg, PhaseDeleting, updateOpts)
+	if err != nil {
+		return err
+	}
+
 	if h.packageInfoGetter == nil {
 		return fmt.Errorf("helm chart package info getter must be specified")
 	}
 
-	hc, err := helm.NewClient(h.kubeconfig,
-		helm.WithNamespace(mg.GetNamespace()),
-		helm.WithLogger(h.getHelmLogger(meta.IsVerbose(mg))),
-	)
+	hc, err := h.clients.Helm(mg.GetNamespace(), meta.IsVerbose(mg))
 	if err != nil {
-		return fmt.Errorf("creating helm client: %w", err)
+		return err
 	}
+	defer hc.Release()
 
-	pkg, err := h.packageInfoGetter.WithLogger(log).Get(mg)
+	// The chart version is not needed to uninstall, a registry outage or a bad constraint must not block the deletion
+	pkg, err := h.packageInfoGetter.WithLogger(log).WithoutVersionResolution().Get(ctx, mg)
 	if err != nil {
 		return fmt.Errorf("getting package info: %w", err)
 	}
@@ -674,10 +1294,22 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 		return nil
 	}
 
+	conflict, err := h.releaseConflict(mg, releaseName, rel.Revision)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		// The release and its RBAC belong to the other composition, they are left in place
+		log.Debug("Composition release is owned by another composition, nothing to uninstall.", "release", releaseName)
+		h.eventRecorder.Event(mg, event.Normal(reasonDeleted, "Delete", fmt.Sprintf("Release %s is owned by another composition, nothing to uninstall: %s", releaseName, mg.GetName())))
+		return nil
+	}
+
 	err = hc.Uninstall(ctx, releaseName, &helmconfig.UninstallConfig{
 		IgnoreNotFound: true,
 	})
 	if err != nil {
+		hc.Invalidate()
 		return fmt.Errorf("uninstalling helm chart: %w", err)
 	}
 
@@ -688,6 +1320,7 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 	if rel != nil {
 		return fmt.Errorf("composition not deleted, release %s still exists", releaseName)
 	}
+	h.ownedReleases.Forget(mg.GetNamespace(), releaseName, mg.GetUID())
 
 	log.Debug("Uninstalling RBAC", "package", pkg.URL)
 
@@ -699,16 +1332,17 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 	rbgen := rbacgen.NewRBACGen(h.saName, h.saNamespace, &chartInspector)
 
 	// Get Resources and generate RBAC
+	params := rbacgen.Parameters{
+		CompositionName:                mg.GetName(),
+		CompositionNamespace:           mg.GetNamespace(),
+		CompositionGVR:                 compositionGVR,
+		CompositionDefinitionName:      pkg.CompositionDefinitionInfo.Name,
+		CompositionDefinitionNamespace: pkg.CompositionDefinitionInfo.Namespace,
+		CompositionDefintionGVR:        pkg.CompositionDefinitionInfo.GVR,
+	}
 	generated, err := rbgen.
 		WithBaseName(compositionMeta.GetReleaseName(mg)).
-		Generate(rbacgen.Parameters{
-			CompositionName:                mg.GetName(),
-			CompositionNamespace:           mg.GetNamespace(),
-			CompositionGVR:                 compositionGVR,
-			CompositionDefinitionName:      pkg.CompositionDefinitionInfo.Name,
-			CompositionDefinitionNamespace: pkg.CompositionDefinitionInfo.Namespace,
-			CompositionDefintionGVR:        pkg.CompositionDefinitionInfo.GVR,
-		})
+		Generate(params)
 	if err != nil {
 		return fmt.Errorf("generating RBAC for composition %s/%s: %w",
 			mg.GetNamespace(), mg.GetName(), err)
@@ -718,6 +1352,12 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 	if err != nil {
 		return fmt.Errorf("uninstalling rbac: %w", err)
 	}
+	err = h.removePreviousRBAC(dyn, mg, rbgen, params)
+	if err != nil {
+		return err
+	}
+
+	h.valuesWatcher.Untrack(valuesfrom.Owner{GVR: compositionGVR, Namespace: mg.GetNamespace(), Name: mg.GetName()})
 
 	h.eventRecorder.Event(mg, event.Normal(reasonDeleted, "Delete", fmt.Sprintf("Deleted composition: %s", mg.GetName())))
 	log.Debug("Composition package removed.", "package", pkg.URL)
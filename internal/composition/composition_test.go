@@ -195,7 +195,11 @@ func TestController(t *testing.T) {
 				t.Error("Creating REST mapper.", "error", err)
 				return ctx
 			}
-			handler = NewHandler(cfg.Client().RESTConfig(), pig, *event.NewAPIRecorder(rec), pluralizer, mapper, chartInspectorMockURL, "test-sa", altNamespace)
+			handler, err = NewHandler(cfg.Client().RESTConfig(), pig, *event.NewAPIRecorder(rec), pluralizer, mapper, chartInspectorMockURL, "test-sa", altNamespace)
+			if err != nil {
+				t.Error("Creating handler.", "error", err)
+				return ctx
+			}
 
 			// handler = NewHandler(cfg.Client().RESTConfig(), log, pig, *event.NewAPIRecorder(rec), pluralizer, chartInspectorUrl, "test-sa", altNamespace)
 
@@ -0,0 +1,407 @@
+package composition
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// compositionGroup is the API group of the compositions, the only resources a composition can depend on.
+const compositionGroup = "composition.krateo.io"
+
+// maxDependencyLookups bounds the compositions visited while looking for a dependency cycle.
+const maxDependencyLookups = 100
+
+// compositionRef references a composition by its group, version, resource, name and namespace.
+type compositionRef struct {
+	Group     string `json:"group"`
+	Version   string `json:"version"`
+	Resource  string `json:"resource"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (r compositionRef) gvr() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// key identifies the referenced composition regardless of the version it is served with.
+func (r compositionRef) key() string {
+	return r.Group + "/" + r.Resource + "/" + r.Namespace + "/" + r.Name
+}
+
+func (r compositionRef) String() string {
+	return fmt.Sprintf("%s %s/%s", schema.GroupResource{Group: r.Group, Resource: r.Resource}, r.Namespace, r.Name)
+}
+
+// getDependsOn parses the depends-on annotation of the composition.
+// Only compositions in the namespace of the composition can be referenced, since the controller
+// annotates its dependencies with its own credentials.
+func getDependsOn(mg *unstructured.Unstructured) ([]compositionRef, error) {
+	raw, ok := compositionMeta.GetDependsOn(mg)
+	if !ok {
+		return nil, nil
+	}
+
+	var refs []compositionRef
+	err := yaml.UnmarshalStrict([]byte(raw), &refs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s annotation: %w", compositionMeta.AnnotationKeyDependsOn, err)
+	}
+	for i := range refs {
+		if refs[i].Version == "" || refs[i].Resource == "" || refs[i].Name == "" {
+			return nil, fmt.Errorf("dependency %d: version, resource and name are required", i)
+		}
+		if refs[i].Group != compositionGroup {
+			return nil, fmt.Errorf("dependency %d: group must be %s", i, compositionGroup)
+		}
+		if refs[i].Namespace == "" {
+			refs[i].Namespace = mg.GetNamespace()
+		}
+		if refs[i].Namespace != mg.GetNamespace() {
+			return nil, fmt.Errorf("dependency %d: namespace %s must be the namespace of the composition, cross-namespace dependencies are not supported", i, refs[i].Namespace)
+		}
+	}
+	return refs, nil
+}
+
+// selfRef returns the reference to the composition itself.
+func (h *handler) selfRef(mg *unstructured.Unstructured) (compositionRef, error) {
+	gvr, err := h.pluralizer.GVKtoGVR(mg.GroupVersionKind())
+	if err != nil {
+		return compositionRef{}, fmt.Errorf("converting GVK to GVR: %w", err)
+	}
+	return compositionRef{
+		Group:     gvr.Group,
+		Version:   gvr.Version,
+		Resource:  gvr.Resource,
+		Name:      mg.GetName(),
+		Namespace: mg.GetNamespace(),
+	}, nil
+}
+
+// dependentAnnotationKey returns the key of the annotation that registers the dependent on its dependencies.
+// The name is a hash of the reference, since annotation names are limited to 63 characters.
+func dependentAnnotationKey(ref compositionRef) string {
+	sum := sha256.Sum256([]byte(ref.gvr().GroupResource().String() + "/" + ref.Namespace + "/" + ref.Name))
+	return compositionMeta.AnnotationKeyPrefixDependent + hex.EncodeToString(sum[:8])
+}
+
+// isAvailable reports whether the composition reports the Ready condition with the Available reason.
+func isAvailable(obj *unstructured.Unstructured) bool {
+	cond := unstructuredtools.GetCondition(obj, condition.TypeReady, condition.ReasonAvailable)
+	return cond != nil && cond.Status == metav1.ConditionTrue
+}
+
+// dependencyPath looks for the target among the dependencies, direct or transitive, and returns the
+// chain of dependencies leading to it, or nil if it is not reached. Dependencies that are missing or
+// have an invalid annotation are not followed.
+func dependencyPath(ctx context.Context, dyn dynamic.Interface, deps []compositionRef, target compositionRef) ([]compositionRef, error) {
+	type step struct {
+		ref  compositionRef
+		path []compositionRef
+	}
+	queue := make([]step, 0, len(deps))
+	for _, dep := range deps {
+		queue = append(queue, step{ref: dep, path: []compositionRef{dep}})
+	}
+	visited := map[string]bool{}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if cur.ref.key() == target.key() {
+			return cur.path, nil
+		}
+		if visited[cur.ref.key()] {
+			continue
+		}
+		if len(visited) >= maxDependencyLookups {
+			return nil, fmt.Errorf("more than %d compositions in the dependency graph", maxDependencyLookups)
+		}
+		visited[cur.ref.key()] = true
+
+		obj, err := dyn.Resource(cur.ref.gvr()).Namespace(cur.ref.Namespace).Get(ctx, cur.ref.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting dependency %s: %w", cur.ref, err)
+		}
+		next, err := getDependsOn(obj)
+		if err != nil {
+			continue
+		}
+		for _, dep := range next {
+			path := append(append([]compositionRef{}, cur.path...), dep)
+			queue = append(queue, step{ref: dep, path: path})
+		}
+	}
+	return nil, nil
+}
+
+// dependencyCycle returns a description of the cycle the dependencies of the composition lead back
+// to it through, or an empty string if there is none.
+func dependencyCycle(ctx context.Context, dyn dynamic.Interface, self compositionRef, deps []compositionRef) (string, error) {
+	path, err := dependencyPath(ctx, dyn, deps, self)
+	if err != nil || len(path) == 0 {
+		return "", err
+	}
+	names := []string{self.String()}
+	for _, ref := range path {
+		names = append(names, ref.String())
+	}
+	return strings.Join(names, " -> "), nil
+}
+
+// dependentAnnotation returns the annotation that registers the composition on its dependencies.
+func (h *handler) dependentAnnotation(mg *unstructured.Unstructured) (string, string, error) {
+	self, err := h.selfRef(mg)
+	if err != nil {
+		return "", "", err
+	}
+	value, err := json.Marshal(self)
+	if err != nil {
+		return "", "", fmt.Errorf("encoding composition reference: %w", err)
+	}
+	return dependentAnnotationKey(self), string(value), nil
+}
+
+// registerDependent annotates the dependency with the reference to its dependent, unless already done.
+func registerDependent(ctx context.Context, cli dynamic.ResourceInterface, dep compositionRef, obj *unstructured.Unstructured, key, value string) error {
+	if obj.GetAnnotations()[key] == value {
+		return nil
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{key: value},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("encoding dependent annotation: %w", err)
+	}
+	_, err = cli.Patch(ctx, dep.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("registering dependent on %s: %w", dep, err)
+	}
+	return nil
+}
+
+// pendingDependencies returns a description of the dependencies that are not available yet.
+// Every existing dependency is annotated with a reference to the composition,
+// so that it can refuse to be deleted while the composition still exists.
+func (h *handler) pendingDependencies(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, deps []compositionRef) ([]string, error) {
+	key, value, err := h.dependentAnnotation(mg)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, dep := range deps {
+		cli := dyn.Resource(dep.gvr()).Namespace(dep.Namespace)
+		obj, err := cli.Get(ctx, dep.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			pending = append(pending, dep.String()+" (not found)")
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting dependency %s: %w", dep, err)
+		}
+		err = registerDependent(ctx, cli, dep, obj, key, value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case obj.GetDeletionTimestamp() != nil:
+			pending = append(pending, dep.String()+" (being deleted)")
+		case !isAvailable(obj):
+			pending = append(pending, dep.String()+" (not available)")
+		}
+	}
+	return pending, nil
+}
+
+// registerOnDependencies registers the composition on its existing dependencies. It runs on every observe,
+// since the dependencies may be listed or created after the last install or upgrade of the composition.
+// Invalid dependencies and cycles are left to waitForDependencies, that reports them on the next upgrade.
+func (h *handler) registerOnDependencies(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured) error {
+	deps, err := getDependsOn(mg)
+	if err != nil || len(deps) == 0 {
+		return nil
+	}
+	self, err := h.selfRef(mg)
+	if err != nil {
+		return err
+	}
+	cycle, err := dependencyCycle(ctx, dyn, self, deps)
+	if err != nil || cycle != "" {
+		return err
+	}
+	key, value, err := h.dependentAnnotation(mg)
+	if err != nil {
+		return err
+	}
+
+	for _, dep := range deps {
+		cli := dyn.Resource(dep.gvr()).Namespace(dep.Namespace)
+		obj, err := cli.Get(ctx, dep.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("getting dependency %s: %w", dep, err)
+		}
+		err = registerDependent(ctx, cli, dep, obj, key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForDependencies reports whether the install or upgrade of the composition must wait
+// for its dependencies and, in that case, sets the WaitingForDependencies condition accordingly.
+// Invalid dependencies, cycles included, defer the install or upgrade until they are fixed, rather than being ignored.
+// The composition is not registered on the dependencies of a cycle, so that they can still be deleted.
+func (h *handler) waitForDependencies(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured) (bool, error) {
+	deps, err := getDependsOn(mg)
+	if err != nil {
+		return true, setConditionMessage(mg, compositionCondition.InvalidDependencies(),
+			fmt.Sprintf("Waiting, invalid dependencies: %s", err))
+	}
+	if len(deps) == 0 {
+		return false, removeCondition(mg, compositionCondition.TypeWaitingForDependencies)
+	}
+
+	self, err := h.selfRef(mg)
+	if err != nil {
+		return false, err
+	}
+	cycle, err := dependencyCycle(ctx, dyn, self, deps)
+	if err != nil {
+		return false, err
+	}
+	if cycle != "" {
+		return true, setConditionMessage(mg, compositionCondition.InvalidDependencies(),
+			fmt.Sprintf("Waiting, invalid dependencies: dependency cycle %s", cycle))
+	}
+
+	pending, err := h.pendingDependencies(ctx, dyn, mg, deps)
+	if err != nil {
+		return false, err
+	}
+	if len(pending) == 0 {
+		return false, removeCondition(mg, compositionCondition.TypeWaitingForDependencies)
+	}
+
+	return true, setConditionMessage(mg, compositionCondition.DependenciesNotReady(),
+		fmt.Sprintf("Waiting for %d of %d dependencies to be available: %s", len(pending), len(deps), strings.Join(pending, "; ")))
+}
+
+// deferToDependencies is waitForDependencies followed by the update of the composition status
+// when the install or upgrade has been deferred.
+func (h *handler) deferToDependencies(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, updateOpts tools.UpdateOptions) (bool, error) {
+	deferred, err := h.waitForDependencies(ctx, dyn, mg)
+	if err != nil {
+		return false, fmt.Errorf("checking dependencies: %w", err)
+	}
+	if !deferred {
+		return false, nil
+	}
+	_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+	if err != nil {
+		return false, fmt.Errorf("updating status: %w", err)
+	}
+	return true, nil
+}
+
+// remainingDependents returns the compositions registered as dependents that still exist and still
+// depend on the composition. The annotations of the dependents that are gone are removed from it, as
+// are those referencing anything but a composition of the same namespace. A dependent the composition
+// depends on in turn forms a cycle and does not block the deletion, or neither could ever be deleted.
+func (h *handler) remainingDependents(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured) ([]string, error) {
+	self, err := h.selfRef(mg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The dependencies of the composition are only used to break cycles, invalid ones are ignored
+	deps, _ := getDependsOn(mg)
+
+	var remaining, stale []string
+	for key, value := range mg.GetAnnotations() {
+		if !strings.HasPrefix(key, compositionMeta.AnnotationKeyPrefixDependent) {
+			continue
+		}
+
+		var ref compositionRef
+		err := json.Unmarshal([]byte(value), &ref)
+		if err != nil || ref.Group != compositionGroup || ref.Namespace != mg.GetNamespace() {
+			stale = append(stale, key)
+			continue
+		}
+		obj, err := dyn.Resource(ref.gvr()).Namespace(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			stale = append(stale, key)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting dependent %s: %w", ref, err)
+		}
+		if !dependsOn(obj, self) {
+			stale = append(stale, key)
+			continue
+		}
+		cycle, err := dependencyPath(ctx, dyn, deps, ref)
+		if err != nil {
+			return nil, fmt.Errorf("checking dependency cycle with %s: %w", ref, err)
+		}
+		if len(cycle) > 0 {
+			continue
+		}
+		remaining = append(remaining, ref.String())
+	}
+
+	if len(stale) > 0 {
+		annotations := mg.GetAnnotations()
+		for _, key := range stale {
+			delete(annotations, key)
+		}
+		mg.SetAnnotations(annotations)
+	}
+	sort.Strings(remaining)
+	return remaining, nil
+}
+
+// dependsOn reports whether the composition lists the given reference among its dependencies.
+// A composition with invalid dependencies is assumed to still depend on it.
+func dependsOn(obj *unstructured.Unstructured, ref compositionRef) bool {
+	deps, err := getDependsOn(obj)
+	if err != nil {
+		return true
+	}
+	for _, dep := range deps {
+		if dep.key() == ref.key() {
+			return true
+		}
+	}
+	return false
+}
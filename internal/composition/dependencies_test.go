@@ -0,0 +1,307 @@
+package composition
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/clientpool"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	demoGVR     = schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "demos"}
+	databaseGVR = schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "databases"}
+)
+
+func newDependencyHandler() *handler {
+	return &handler{
+		pluralizer: &mockPluralizer{
+			gvrMap: map[schema.GroupVersionKind]schema.GroupVersionResource{
+				{Group: "composition.krateo.io", Version: "v1", Kind: "Demo"}:     demoGVR,
+				{Group: "composition.krateo.io", Version: "v1", Kind: "Database"}: databaseGVR,
+			},
+		},
+	}
+}
+
+func newDatabase(name string, available bool) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "composition.krateo.io/v1",
+		"kind":       "Database",
+		"metadata":   map[string]any{"name": name, "namespace": "demo-system"},
+	}}
+	cond := condition.Unavailable()
+	if available {
+		cond = condition.Available()
+	}
+	_ = unstructuredtools.SetConditions(obj, cond)
+	return obj
+}
+
+// dependingDatabase returns an available database depending on the given compositions.
+func dependingDatabase(name, dependsOn string) *unstructured.Unstructured {
+	obj := newDatabase(name, true)
+	obj.SetAnnotations(map[string]string{compositionMeta.AnnotationKeyDependsOn: dependsOn})
+	return obj
+}
+
+func newDependencyClient(objs ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			demoGVR:     "DemoList",
+			databaseGVR: "DatabaseList",
+		}, objs...)
+}
+
+func TestGetDependsOn(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []compositionRef
+		wantErr  bool
+	}{
+		{name: "not set"},
+		{
+			name:  "yaml with default namespace",
+			value: "- {group: composition.krateo.io, version: v1, resource: databases, name: db}",
+			expected: []compositionRef{
+				{Group: "composition.krateo.io", Version: "v1", Resource: "databases", Name: "db", Namespace: "demo-system"},
+			},
+		},
+		{
+			name:  "json with namespace",
+			value: `[{"group":"composition.krateo.io","version":"v1","resource":"databases","name":"db","namespace":"demo-system"}]`,
+			expected: []compositionRef{
+				{Group: "composition.krateo.io", Version: "v1", Resource: "databases", Name: "db", Namespace: "demo-system"},
+			},
+		},
+		{name: "other namespace", value: "- {group: composition.krateo.io, version: v1, resource: databases, name: db, namespace: shared}", wantErr: true},
+		{name: "not a composition", value: "- {version: v1, resource: secrets, name: db}", wantErr: true},
+		{name: "missing name", value: "- {version: v1, resource: databases}", wantErr: true},
+		{name: "unknown field", value: "- {version: v1, resource: databases, name: db, kind: Database}", wantErr: true},
+		{name: "not a list", value: "db", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			if tt.value != "" {
+				mg.SetAnnotations(map[string]string{compositionMeta.AnnotationKeyDependsOn: tt.value})
+			}
+			refs, err := getDependsOn(mg)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, refs)
+		})
+	}
+}
+
+func TestWaitForDependencies(t *testing.T) {
+	dependsOn := "- {group: composition.krateo.io, version: v1, resource: databases, name: db}\n" +
+		"- {group: composition.krateo.io, version: v1, resource: databases, name: cache}"
+
+	tests := []struct {
+		name    string
+		value   string
+		objs    []runtime.Object
+		waiting bool
+		reason  string
+		message string
+	}{
+		{name: "no dependencies"},
+		{
+			name:    "invalid dependencies",
+			value:   "db",
+			waiting: true,
+			reason:  compositionCondition.ReasonInvalidDependencies,
+		},
+		{
+			name:    "missing and unavailable",
+			value:   dependsOn,
+			objs:    []runtime.Object{newDatabase("db", false)},
+			waiting: true,
+			reason:  compositionCondition.ReasonDependenciesNotReady,
+			message: "Waiting for 2 of 2 dependencies to be available: databases.composition.krateo.io demo-system/db (not available); databases.composition.krateo.io demo-system/cache (not found)",
+		},
+		{
+			name:    "one unavailable",
+			value:   dependsOn,
+			objs:    []runtime.Object{newDatabase("db", true), newDatabase("cache", false)},
+			waiting: true,
+			reason:  compositionCondition.ReasonDependenciesNotReady,
+			message: "Waiting for 1 of 2 dependencies to be available: databases.composition.krateo.io demo-system/cache (not available)",
+		},
+		{
+			name:  "all available",
+			value: dependsOn,
+			objs:  []runtime.Object{newDatabase("db", true), newDatabase("cache", true)},
+		},
+		{
+			name:    "cycle",
+			value:   dependsOn,
+			objs:    []runtime.Object{dependingDatabase("cache", "- {group: composition.krateo.io, version: v1, resource: databases, name: db}"), dependingDatabase("db", "- {group: composition.krateo.io, version: v1, resource: demos, name: demo}")},
+			waiting: true,
+			reason:  compositionCondition.ReasonInvalidDependencies,
+			message: "Waiting, invalid dependencies: dependency cycle demos.composition.krateo.io demo-system/demo -> databases.composition.krateo.io demo-system/db -> demos.composition.krateo.io demo-system/demo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			if tt.value != "" {
+				mg.SetAnnotations(map[string]string{compositionMeta.AnnotationKeyDependsOn: tt.value})
+			}
+			dyn := newDependencyClient(tt.objs...)
+
+			waiting, err := newDependencyHandler().waitForDependencies(context.Background(), dyn, mg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.waiting, waiting)
+
+			if !tt.waiting {
+				for _, c := range unstructuredtools.GetConditions(mg) {
+					assert.NotEqual(t, compositionCondition.TypeWaitingForDependencies, c.Type)
+				}
+				return
+			}
+			cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeWaitingForDependencies, tt.reason)
+			require.NotNil(t, cond)
+			if tt.message != "" {
+				assert.Equal(t, tt.message, cond.Message)
+			}
+		})
+	}
+}
+
+func TestWaitForDependenciesRegistersDependent(t *testing.T) {
+	mg := newComposition()
+	mg.SetAnnotations(map[string]string{
+		compositionMeta.AnnotationKeyDependsOn: "- {group: composition.krateo.io, version: v1, resource: databases, name: db}",
+	})
+	dyn := newDependencyClient(newDatabase("db", true))
+	h := newDependencyHandler()
+
+	waiting, err := h.waitForDependencies(context.Background(), dyn, mg)
+	require.NoError(t, err)
+	assert.False(t, waiting)
+
+	db, err := dyn.Resource(databaseGVR).Namespace("demo-system").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	self, err := h.selfRef(mg)
+	require.NoError(t, err)
+	assert.JSONEq(t,
+		`{"group":"composition.krateo.io","version":"v1","resource":"demos","name":"demo","namespace":"demo-system"}`,
+		db.GetAnnotations()[dependentAnnotationKey(self)])
+
+	// A dependent that is registered and still depends on the database blocks its deletion
+	remaining, err := h.remainingDependents(context.Background(), newDependencyClient(mg), db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"demos.composition.krateo.io demo-system/demo"}, remaining)
+}
+
+func TestDeleteBlockedByDependentNeverUpgraded(t *testing.T) {
+	// The dependency is listed after the install of the composition, which is not upgraded since
+	// annotations do not change its generation
+	app := newComposition()
+	app.SetAnnotations(map[string]string{
+		compositionMeta.AnnotationKeyDependsOn: "- {group: composition.krateo.io, version: v1, resource: databases, name: db}",
+	})
+	dyn := newDependencyClient(app, newDatabase("db", true))
+	h := newDependencyHandler()
+	h.clients = clientpool.New(&rest.Config{Host: "https://127.0.0.1:6443"}, time.Minute).WithDynamic(dyn)
+
+	require.NoError(t, h.registerOnDependencies(context.Background(), dyn, app))
+
+	db, err := dyn.Resource(databaseGVR).Namespace("demo-system").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	err = h.Delete(context.Background(), db)
+	require.Error(t, err)
+	assert.Equal(t, "composition is still required by 1 dependent(s): demos.composition.krateo.io demo-system/demo", err.Error())
+}
+
+func TestRegisterOnDependenciesCycle(t *testing.T) {
+	mg := newComposition()
+	mg.SetAnnotations(map[string]string{
+		compositionMeta.AnnotationKeyDependsOn: "- {group: composition.krateo.io, version: v1, resource: databases, name: db}",
+	})
+	dyn := newDependencyClient(mg, dependingDatabase("db", "- {group: composition.krateo.io, version: v1, resource: demos, name: demo}"))
+	h := newDependencyHandler()
+
+	require.NoError(t, h.registerOnDependencies(context.Background(), dyn, mg))
+
+	db, err := dyn.Resource(databaseGVR).Namespace("demo-system").Get(context.Background(), "db", metav1.GetOptions{})
+	require.NoError(t, err)
+	for key := range db.GetAnnotations() {
+		assert.False(t, strings.HasPrefix(key, compositionMeta.AnnotationKeyPrefixDependent))
+	}
+}
+
+func TestRemainingDependents(t *testing.T) {
+	h := newDependencyHandler()
+	db := newDatabase("db", true)
+
+	gone := compositionRef{Group: "composition.krateo.io", Version: "v1", Resource: "demos", Name: "gone", Namespace: "demo-system"}
+	unrelated := compositionRef{Group: "composition.krateo.io", Version: "v1", Resource: "demos", Name: "demo", Namespace: "demo-system"}
+	db.SetAnnotations(map[string]string{
+		dependentAnnotationKey(gone):      `{"group":"composition.krateo.io","version":"v1","resource":"demos","name":"gone","namespace":"demo-system"}`,
+		dependentAnnotationKey(unrelated): `{"group":"composition.krateo.io","version":"v1","resource":"demos","name":"demo","namespace":"demo-system"}`,
+		"other":                           "kept",
+	})
+
+	// The dependent exists, but it no longer depends on the database
+	remaining, err := h.remainingDependents(context.Background(), newDependencyClient(newComposition()), db)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+	assert.Equal(t, map[string]string{"other": "kept"}, db.GetAnnotations())
+}
+
+func TestRemainingDependentsCycle(t *testing.T) {
+	h := newDependencyHandler()
+	mg := newComposition()
+	db := newDatabase("db", true)
+	self, err := h.selfRef(mg)
+	require.NoError(t, err)
+	db.SetAnnotations(map[string]string{
+		compositionMeta.AnnotationKeyDependsOn: "- {group: composition.krateo.io, version: v1, resource: demos, name: demo}",
+		dependentAnnotationKey(self):           `{"group":"composition.krateo.io","version":"v1","resource":"demos","name":"demo","namespace":"demo-system"}`,
+	})
+	mg.SetAnnotations(map[string]string{
+		compositionMeta.AnnotationKeyDependsOn: "- {group: composition.krateo.io, version: v1, resource: databases, name: db}",
+	})
+	dyn := newDependencyClient(mg, db)
+
+	// Both depend on each other: neither blocks the deletion of the other
+	remaining, err := h.remainingDependents(context.Background(), dyn, db)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+}
+
+func TestRemainingDependentsOtherNamespace(t *testing.T) {
+	h := newDependencyHandler()
+	db := newDatabase("db", true)
+	other := compositionRef{Group: "composition.krateo.io", Version: "v1", Resource: "demos", Name: "demo", Namespace: "other"}
+	db.SetAnnotations(map[string]string{
+		dependentAnnotationKey(other): `{"group":"composition.krateo.io","version":"v1","resource":"demos","name":"demo","namespace":"other"}`,
+	})
+
+	remaining, err := h.remainingDependents(context.Background(), newDependencyClient(), db)
+	require.NoError(t, err)
+	assert.Empty(t, remaining)
+	assert.Empty(t, db.GetAnnotations())
+}
@@ -0,0 +1,196 @@
+package composition
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/drift"
+	dynamictools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/dynamic"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/hooks"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/processor"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// helmFieldManager is the field manager of the Helm clients, named after the binary of the image
+// as Helm would by default, so that the fields of existing releases keep their manager.
+const helmFieldManager = "controller"
+
+// detectDrift compares every object of the release manifest with its live counterpart
+// and returns the objects whose fields owned by the release have been changed in the cluster.
+func (h *handler) detectDrift(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, rel *helmconfig.Release) ([]drift.Object, error) {
+	desired, _, err := processor.DecodeUnstructuredRelease(rel)
+	if err != nil {
+		return nil, fmt.Errorf("decoding release: %w", err)
+	}
+
+	var drifted []drift.Object
+	for _, obj := range desired {
+		// Hooks are run by Helm and can be deleted once completed, they cannot drift
+		if hooks.IsHook(obj.GetAnnotations()) {
+			continue
+		}
+
+		cli, namespace, err := h.resourceClient(dyn, mg, &obj)
+		if err != nil {
+			return nil, err
+		}
+
+		ref := drift.Object{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Name:       obj.GetName(),
+			Namespace:  namespace,
+		}
+
+		live, err := cli.Get(ctx, obj.GetName(), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			ref.Missing = true
+			drifted = append(drifted, ref)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("getting %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		ref.Paths = drift.Diff(obj.Object, live.Object)
+		if len(ref.Paths) > 0 {
+			drifted = append(drifted, ref)
+		}
+	}
+
+	return drifted, nil
+}
+
+// resourceClient returns the dynamic client for an object rendered by the release and the namespace it lives in.
+// Namespaced objects without a namespace in the manifest are resolved in the composition namespace,
+// as Helm installs them in the release namespace.
+func (h *handler) resourceClient(dyn dynamic.Interface, mg *unstructured.Unstructured, obj *unstructured.Unstructured) (dynamic.ResourceInterface, string, error) {
+	gvk := obj.GroupVersionKind()
+	gvr, err := h.pluralizer.GVKtoGVR(gvk)
+	if err != nil {
+		return nil, "", fmt.Errorf("converting GVK to GVR: %w", err)
+	}
+
+	namespace := obj.GetNamespace()
+	if namespace == "" {
+		namespace = mg.GetNamespace()
+	}
+	if h.mapper != nil {
+		namespaced, err := dynamictools.IsNamespaced(h.mapper, gvk)
+		if err != nil {
+			return nil, "", fmt.Errorf("getting REST mapping for %s: %w", gvk.String(), err)
+		}
+		if !namespaced {
+			return dyn.Resource(gvr), "", nil
+		}
+	}
+
+	return dyn.Resource(gvr).Namespace(namespace), namespace, nil
+}
+
+// healDrift re-applies the drifted objects from the release manifest with server-side apply,
+// using the same field manager as Helm. The Helm release and its revision are left untouched.
+// It returns the objects that have been healed and the ones that could not be healed.
+func (h *handler) healDrift(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, rel *helmconfig.Release, drifted []drift.Object) ([]drift.Object, []drift.Object, error) {
+	desired, _, err := processor.DecodeUnstructuredRelease(rel)
+	if err != nil {
+		return nil, drifted, fmt.Errorf("decoding release: %w", err)
+	}
+
+	byKey := make(map[string]*unstructured.Unstructured, len(desired))
+	for i := range desired {
+		byKey[driftKey(desired[i].GetAPIVersion(), desired[i].GetKind(), desired[i].GetNamespace(), desired[i].GetName(), mg.GetNamespace())] = &desired[i]
+	}
+
+	var healed, failed []drift.Object
+	var errs []error
+	for _, d := range drifted {
+		obj, ok := byKey[driftKey(d.APIVersion, d.Kind, d.Namespace, d.Name, mg.GetNamespace())]
+		if !ok {
+			failed = append(failed, d)
+			continue
+		}
+
+		cli, namespace, err := h.resourceClient(dyn, mg, obj)
+		if err != nil {
+			failed = append(failed, d)
+			errs = append(errs, err)
+			continue
+		}
+		obj = obj.DeepCopy()
+		obj.SetNamespace(namespace)
+		_, err = cli.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+			FieldManager: helmFieldManager,
+			Force:        true,
+		})
+		if err != nil {
+			failed = append(failed, d)
+			errs = append(errs, fmt.Errorf("applying %s %s: %w", d.Kind, d.Name, err))
+			continue
+		}
+		healed = append(healed, d)
+	}
+
+	return healed, failed, errors.Join(errs...)
+}
+
+// driftKey identifies an object of the release, namespaced objects without a namespace in the manifest
+// being installed by Helm in the release namespace.
+func driftKey(apiVersion, kind, namespace, name, releaseNamespace string) string {
+	if namespace == "" {
+		namespace = releaseNamespace
+	}
+	return apiVersion + "/" + kind + "/" + namespace + "/" + name
+}
+
+// selfHealEnabled reports whether drifted resources should be healed.
+func selfHealEnabled(mg *unstructured.Unstructured, pkg *archive.Info) bool {
+	return annotationOr(mg, compositionMeta.GetSelfHeal, pkg != nil && pkg.SelfHeal)
+}
+
+func describeDrift(objs []drift.Object) string {
+	refs := make([]string, 0, len(objs))
+	for _, o := range objs {
+		ref := o.Kind + " " + o.Name
+		if o.Namespace != "" {
+			ref = o.Kind + " " + o.Namespace + "/" + o.Name
+		}
+		refs = append(refs, ref)
+	}
+	return strings.Join(refs, ", ")
+}
+
+// setDrift publishes the drifted objects under 'status.drift' and updates the Drifted condition.
+// The condition is only replaced when its content changes, to avoid bumping the status on every observe.
+func setDrift(mg *unstructured.Unstructured, drifted []drift.Object) error {
+	if len(drifted) == 0 {
+		unstructured.RemoveNestedField(mg.Object, "status", "drift")
+		return setConditionMessage(mg, compositionCondition.NotDrifted(), "No drift detected")
+	}
+
+	objects := make([]any, 0, len(drifted))
+	for i := range drifted {
+		o, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&drifted[i])
+		if err != nil {
+			return fmt.Errorf("converting drifted object: %w", err)
+		}
+		objects = append(objects, o)
+	}
+	err := unstructured.SetNestedSlice(mg.Object, objects, "status", "drift", "objects")
+	if err != nil {
+		return fmt.Errorf("setting drift in status: %w", err)
+	}
+
+	return setConditionMessage(mg, compositionCondition.Drifted(), fmt.Sprintf("%d object(s) drifted from the release manifest", len(drifted)))
+}
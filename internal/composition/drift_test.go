@@ -0,0 +1,200 @@
+package composition
+
+import (
+	"context"
+	"testing"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/drift"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func newComposition() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "composition.krateo.io/v1",
+		"kind":       "Demo",
+		"metadata":   map[string]any{"name": "demo", "namespace": "demo-system"},
+	}}
+}
+
+func newConfigMap(name string, data map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": name, "namespace": "demo-system"},
+		"data":       data,
+	}}
+}
+
+func TestDetectDrift(t *testing.T) {
+	manifest := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: missing
+data:
+  key: value
+`
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "configmaps"}: "ConfigMapList"},
+		newConfigMap("unchanged", map[string]any{"key": "value"}),
+		newConfigMap("changed", map[string]any{"key": "edited"}),
+	)
+
+	h := &handler{
+		pluralizer: &mockPluralizer{
+			gvrMap: map[schema.GroupVersionKind]schema.GroupVersionResource{
+				{Version: "v1", Kind: "ConfigMap"}: {Version: "v1", Resource: "configmaps"},
+			},
+		},
+	}
+
+	drifted, err := h.detectDrift(context.Background(), dyn, newComposition(), &helmconfig.Release{Manifest: manifest})
+	require.NoError(t, err)
+
+	assert.Equal(t, []drift.Object{
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "changed", Namespace: "demo-system", Paths: []string{"data.key"}},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "missing", Namespace: "demo-system", Missing: true},
+	}, drifted)
+}
+
+func TestSetDrift(t *testing.T) {
+	mg := newComposition()
+
+	err := setDrift(mg, []drift.Object{
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "changed", Namespace: "demo-system", Paths: []string{"data.key"}},
+	})
+	require.NoError(t, err)
+
+	objects, ok, err := unstructured.NestedSlice(mg.Object, "status", "drift", "objects")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Len(t, objects, 1)
+	cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeDrifted, compositionCondition.ReasonDriftDetected)
+	require.NotNil(t, cond)
+
+	err = setDrift(mg, nil)
+	require.NoError(t, err)
+
+	_, ok, err = unstructured.NestedFieldNoCopy(mg.Object, "status", "drift")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	cond = unstructuredtools.GetCondition(mg, compositionCondition.TypeDrifted, compositionCondition.ReasonNoDrift)
+	require.NotNil(t, cond)
+}
+
+func TestHealDrift(t *testing.T) {
+	manifest := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: changed
+  namespace: other-system
+data:
+  key: other
+`
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "configmaps"}: "ConfigMapList"},
+		newConfigMap("changed", map[string]any{"key": "edited"}),
+	)
+	// The fake client does not implement server-side apply for unstructured objects, record the patches instead
+	var applied []clienttesting.PatchAction
+	dyn.PrependReactor("patch", "configmaps", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pa := action.(clienttesting.PatchAction)
+		applied = append(applied, pa)
+		return true, newConfigMap(pa.GetName(), map[string]any{"key": "value"}), nil
+	})
+
+	h := &handler{
+		pluralizer: &mockPluralizer{
+			gvrMap: map[schema.GroupVersionKind]schema.GroupVersionResource{
+				{Version: "v1", Kind: "ConfigMap"}: {Version: "v1", Resource: "configmaps"},
+			},
+		},
+	}
+
+	rel := &helmconfig.Release{Manifest: manifest}
+	drifted := []drift.Object{
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "changed", Namespace: "other-system", Paths: []string{"data.key"}},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "changed", Namespace: "demo-system", Paths: []string{"data.key"}},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "unknown", Namespace: "demo-system", Missing: true},
+	}
+
+	healed, failed, err := h.healDrift(context.Background(), dyn, newComposition(), rel, drifted)
+	require.NoError(t, err)
+	assert.Equal(t, drifted[:2], healed)
+	assert.Equal(t, drifted[2:], failed)
+
+	// Objects with the same name in different namespaces are healed from their own manifest
+	require.Len(t, applied, 2)
+	var other unstructured.Unstructured
+	require.NoError(t, other.UnmarshalJSON(applied[0].GetPatch()))
+	assert.Equal(t, "other-system", other.GetNamespace())
+	val, _, _ := unstructured.NestedString(other.Object, "data", "key")
+	assert.Equal(t, "other", val)
+
+	applied = applied[1:]
+	assert.Equal(t, types.ApplyPatchType, applied[0].GetPatchType())
+	assert.Equal(t, "demo-system", applied[0].GetNamespace())
+
+	var obj unstructured.Unstructured
+	require.NoError(t, obj.UnmarshalJSON(applied[0].GetPatch()))
+	assert.Equal(t, "demo-system", obj.GetNamespace())
+	val, _, _ = unstructured.NestedString(obj.Object, "data", "key")
+	assert.Equal(t, "value", val)
+}
+
+func TestSelfHealEnabled(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		pkg         *archive.Info
+		expected    bool
+	}{
+		{name: "disabled by default", pkg: &archive.Info{}, expected: false},
+		{name: "enabled by definition", pkg: &archive.Info{SelfHeal: true}, expected: true},
+		{name: "enabled by annotation", annotations: map[string]string{compositionMeta.AnnotationKeySelfHeal: "true"}, pkg: &archive.Info{}, expected: true},
+		{name: "annotation overrides definition", annotations: map[string]string{compositionMeta.AnnotationKeySelfHeal: "false"}, pkg: &archive.Info{SelfHeal: true}, expected: false},
+		{name: "nil package info", pkg: nil, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			mg.SetAnnotations(tt.annotations)
+			assert.Equal(t, tt.expected, selfHealEnabled(mg, tt.pkg))
+		})
+	}
+}
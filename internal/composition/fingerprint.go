@@ -0,0 +1,90 @@
+package composition
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/hasher"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// inputFingerprint hashes everything the desired release is rendered from: the composition spec and
+// metadata, the chart of its definition and the values with the injected globals, together with the
+// deployed revision, so that a change on either side is told apart from a resync.
+// Registry credentials are left out on purpose, the fingerprint is published in status.
+func inputFingerprint(mg *unstructured.Unstructured, pkg *archive.Info, actionConfig *helmconfig.ActionConfig, rel *helmconfig.Release) (string, error) {
+	h := hasher.NewFNVObjectHash()
+	err := h.SumHash(
+		mg.GetUID(), mg.GetGeneration(), mg.GetLabels(), mg.GetAnnotations(),
+		pkg.URL, pkg.Version, pkg.Repo,
+		actionConfig.Values,
+		rel.Name, rel.Revision, rel.ChartVersion,
+	)
+	if err != nil {
+		return "", err
+	}
+	return h.GetHash(), nil
+}
+
+// inputsVerified reports whether the deployed release has been fully verified against the same inputs
+// within the full verification interval, in which case rendering the desired release can be skipped.
+// A zero interval verifies the release on every observe.
+func inputsVerified(mg *unstructured.Unstructured, fingerprint string, now time.Time) bool {
+	if fullVerificationInterval <= 0 {
+		return false
+	}
+	stored, _, _ := unstructured.NestedString(mg.Object, "status", "inputFingerprint")
+	if stored != fingerprint {
+		return false
+	}
+	ts, _, _ := unstructured.NestedString(mg.Object, "status", "lastFullVerificationTime")
+	verifiedAt, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return false
+	}
+	return now.Sub(verifiedAt) < fullVerificationInterval
+}
+
+// setInputFingerprint records the inputs the deployed release has been fully verified against.
+func setInputFingerprint(mg *unstructured.Unstructured, fingerprint string, now time.Time) error {
+	err := unstructured.SetNestedField(mg.Object, fingerprint, "status", "inputFingerprint")
+	if err != nil {
+		return fmt.Errorf("setting input fingerprint in status: %w", err)
+	}
+	err = unstructured.SetNestedField(mg.Object, now.UTC().Format(time.RFC3339), "status", "lastFullVerificationTime")
+	if err != nil {
+		return fmt.Errorf("setting last full verification time in status: %w", err)
+	}
+	return nil
+}
+
+// resourcesChecked reports whether the live checks of the release resources (drift, health and outputs)
+// can be skipped, as the last one found nothing to report within the resource check interval.
+// A zero interval checks the resources on every observe.
+func resourcesChecked(mg *unstructured.Unstructured, now time.Time) bool {
+	if resourceCheckInterval <= 0 {
+		return false
+	}
+	ts, _, _ := unstructured.NestedString(mg.Object, "status", "lastResourceCheckTime")
+	checkedAt, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return false
+	}
+	return now.Sub(checkedAt) < resourceCheckInterval
+}
+
+// setResourcesChecked records when the live checks of the release resources last found them healthy,
+// not drifted and with their outputs published, or forgets it when they did not.
+func setResourcesChecked(mg *unstructured.Unstructured, clean bool, now time.Time) error {
+	if !clean {
+		unstructured.RemoveNestedField(mg.Object, "status", "lastResourceCheckTime")
+		return nil
+	}
+	err := unstructured.SetNestedField(mg.Object, now.UTC().Format(time.RFC3339), "status", "lastResourceCheckTime")
+	if err != nil {
+		return fmt.Errorf("setting last resource check time in status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package composition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputFingerprint(t *testing.T) {
+	fingerprint := func(mutate func(pkg *archive.Info, cfg *helmconfig.ActionConfig, rel *helmconfig.Release)) string {
+		mg := newComposition()
+		mg.SetGeneration(2)
+		pkg := &archive.Info{URL: "https://charts.krateo.io/fireworks-app-1.1.13.tgz", Version: "1.1.13", Repo: "fireworks-app"}
+		cfg := &helmconfig.ActionConfig{Values: map[string]any{"replicas": 2, "global": map[string]any{"compositionName": "demo"}}}
+		rel := &helmconfig.Release{Name: "demo-5a47edd9", Revision: 3, ChartVersion: "1.1.13"}
+		if mutate != nil {
+			mutate(pkg, cfg, rel)
+		}
+		res, err := inputFingerprint(mg, pkg, cfg, rel)
+		require.NoError(t, err)
+		return res
+	}
+
+	base := fingerprint(nil)
+	assert.Equal(t, base, fingerprint(nil))
+
+	tests := []struct {
+		name   string
+		mutate func(pkg *archive.Info, cfg *helmconfig.ActionConfig, rel *helmconfig.Release)
+	}{
+		{name: "chart version", mutate: func(pkg *archive.Info, _ *helmconfig.ActionConfig, _ *helmconfig.Release) { pkg.Version = "1.1.14" }},
+		{name: "chart repo", mutate: func(pkg *archive.Info, _ *helmconfig.ActionConfig, _ *helmconfig.Release) { pkg.Repo = "fireworks" }},
+		{name: "values", mutate: func(_ *archive.Info, cfg *helmconfig.ActionConfig, _ *helmconfig.Release) { cfg.Values["replicas"] = 3 }},
+		{name: "deployed revision", mutate: func(_ *archive.Info, _ *helmconfig.ActionConfig, rel *helmconfig.Release) { rel.Revision = 4 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NotEqual(t, base, fingerprint(tt.mutate))
+		})
+	}
+}
+
+func TestInputsVerified(t *testing.T) {
+	defer func(interval time.Duration) { fullVerificationInterval = interval }(fullVerificationInterval)
+	verifiedAt := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		interval    time.Duration
+		recorded    bool
+		fingerprint string
+		now         time.Time
+		expected    bool
+	}{
+		{name: "never verified", interval: time.Hour, fingerprint: "abc", now: verifiedAt, expected: false},
+		{name: "same inputs", interval: time.Hour, recorded: true, fingerprint: "abc", now: verifiedAt.Add(10 * time.Minute), expected: true},
+		{name: "inputs changed", interval: time.Hour, recorded: true, fingerprint: "def", now: verifiedAt.Add(10 * time.Minute), expected: false},
+		{name: "interval elapsed", interval: time.Hour, recorded: true, fingerprint: "abc", now: verifiedAt.Add(time.Hour), expected: false},
+		{name: "disabled", interval: 0, recorded: true, fingerprint: "abc", now: verifiedAt, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fullVerificationInterval = tt.interval
+			mg := newComposition()
+			if tt.recorded {
+				require.NoError(t, setInputFingerprint(mg, "abc", verifiedAt))
+			}
+			assert.Equal(t, tt.expected, inputsVerified(mg, tt.fingerprint, tt.now))
+		})
+	}
+}
+
+func TestResourcesChecked(t *testing.T) {
+	defer func(interval time.Duration) { resourceCheckInterval = interval }(resourceCheckInterval)
+	checkedAt := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		clean    bool
+		now      time.Time
+		expected bool
+	}{
+		{name: "clean check", interval: 10 * time.Minute, clean: true, now: checkedAt.Add(5 * time.Minute), expected: true},
+		{name: "something to report", interval: 10 * time.Minute, clean: false, now: checkedAt.Add(5 * time.Minute), expected: false},
+		{name: "interval elapsed", interval: 10 * time.Minute, clean: true, now: checkedAt.Add(10 * time.Minute), expected: false},
+		{name: "disabled", interval: 0, clean: true, now: checkedAt, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resourceCheckInterval = tt.interval
+			mg := newComposition()
+			// A previous clean check is forgotten as soon as a check finds something to report
+			require.NoError(t, setResourcesChecked(mg, true, checkedAt.Add(-time.Minute)))
+			require.NoError(t, setResourcesChecked(mg, tt.clean, checkedAt))
+			assert.Equal(t, tt.expected, resourcesChecked(mg, tt.now))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/health"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// maxUnhealthyInMessage limits the number of unhealthy resources listed in the condition message.
+const maxUnhealthyInMessage = 5
+
+// evaluateManagedHealth fetches the live state of every managed resource, records its health
+// in the 'health' field of the entry and returns a description of the unhealthy ones.
+func (h *handler) evaluateManagedHealth(ctx context.Context, dyn dynamic.Interface, managed []any) []string {
+	evaluator := health.NewEvaluator(dyn)
+
+	var unhealthy []string
+	for i, el := range managed {
+		ref, ok := el.(ManagedResource)
+		if !ok {
+			continue
+		}
+
+		res := getManagedHealth(ctx, dyn, evaluator, &ref)
+		ref.Health = string(res.Status)
+		managed[i] = ref
+
+		if !res.IsHealthy() {
+			desc := fmt.Sprintf("%s %s (%s)", ref.Resource, managedRefName(&ref), res.Status)
+			if res.Message != "" {
+				desc = fmt.Sprintf("%s %s (%s: %s)", ref.Resource, managedRefName(&ref), res.Status, res.Message)
+			}
+			unhealthy = append(unhealthy, desc)
+		}
+	}
+
+	return unhealthy
+}
+
+func getManagedHealth(ctx context.Context, dyn dynamic.Interface, evaluator *health.Evaluator, ref *ManagedResource) health.Result {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return health.Result{Status: health.StatusUnknown, Message: err.Error()}
+	}
+
+	cli := dyn.Resource(gv.WithResource(ref.Resource))
+	var live *unstructured.Unstructured
+	if ref.Namespace != "" {
+		live, err = cli.Namespace(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	} else {
+		live, err = cli.Get(ctx, ref.Name, metav1.GetOptions{})
+	}
+	if apierrors.IsNotFound(err) {
+		return evaluator.Evaluate(ctx, nil)
+	}
+	if err != nil {
+		return health.Result{Status: health.StatusUnknown, Message: err.Error()}
+	}
+	return evaluator.Evaluate(ctx, live)
+}
+
+func managedRefName(ref *ManagedResource) string {
+	if ref.Namespace == "" {
+		return ref.Name
+	}
+	return ref.Namespace + "/" + ref.Name
+}
+
+// setResourcesHealth updates the ResourcesHealthy condition and returns the message
+// describing the health of the managed resources.
+func setResourcesHealth(mg *unstructured.Unstructured, unhealthy []string) (string, error) {
+	if len(unhealthy) == 0 {
+		msg := "All composition resources are healthy"
+		return msg, setConditionMessage(mg, compositionCondition.ResourcesHealthy(), msg)
+	}
+
+	listed := unhealthy
+	if len(listed) > maxUnhealthyInMessage {
+		listed = listed[:maxUnhealthyInMessage]
+	}
+	msg := fmt.Sprintf("%d resource(s) not healthy: %s", len(unhealthy), strings.Join(listed, "; "))
+	if len(unhealthy) > len(listed) {
+		msg = fmt.Sprintf("%s; and %d more", msg, len(unhealthy)-len(listed))
+	}
+	return msg, setConditionMessage(mg, compositionCondition.ResourcesUnhealthy(), msg)
+}
@@ -0,0 +1,67 @@
+package composition
+
+import (
+	"context"
+	"testing"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/health"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestEvaluateManagedHealth(t *testing.T) {
+	deployment := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]any{"name": "web", "namespace": "demo-system"},
+		"spec":       map[string]any{"replicas": int64(2)},
+		"status":     map[string]any{"replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(1)},
+	}}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "configmaps"}:                 "ConfigMapList",
+			{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+		},
+		newConfigMap("settings", map[string]any{"key": "value"}),
+		deployment,
+	)
+
+	managed := []any{
+		ManagedResource{APIVersion: "v1", Resource: "configmaps", Name: "settings", Namespace: "demo-system"},
+		ManagedResource{APIVersion: "apps/v1", Resource: "deployments", Name: "web", Namespace: "demo-system"},
+		ManagedResource{APIVersion: "v1", Resource: "configmaps", Name: "missing", Namespace: "demo-system"},
+	}
+
+	h := &handler{}
+	unhealthy := h.evaluateManagedHealth(context.Background(), dyn, managed)
+
+	assert.Equal(t, string(health.StatusHealthy), managed[0].(ManagedResource).Health)
+	assert.Equal(t, string(health.StatusProgressing), managed[1].(ManagedResource).Health)
+	assert.Equal(t, string(health.StatusMissing), managed[2].(ManagedResource).Health)
+	assert.Equal(t, []string{
+		"deployments demo-system/web (Progressing: 1 of 2 updated replicas are available)",
+		"configmaps demo-system/missing (Missing: resource not found)",
+	}, unhealthy)
+}
+
+func TestSetResourcesHealth(t *testing.T) {
+	mg := newComposition()
+
+	msg, err := setResourcesHealth(mg, []string{"a", "b", "c", "d", "e", "f", "g"})
+	require.NoError(t, err)
+	assert.Equal(t, "7 resource(s) not healthy: a; b; c; d; e; and 2 more", msg)
+	cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeResourcesHealthy, compositionCondition.ReasonResourcesUnhealthy)
+	require.NotNil(t, cond)
+	assert.Equal(t, msg, cond.Message)
+
+	_, err = setResourcesHealth(mg, nil)
+	require.NoError(t, err)
+	cond = unstructuredtools.GetCondition(mg, compositionCondition.TypeResourcesHealthy, compositionCondition.ReasonResourcesHealthy)
+	require.NotNil(t, cond)
+}
@@ -0,0 +1,84 @@
+package composition
+
+import (
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/history"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/hooks"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// refreshHistory publishes the revisions of the release under 'status.history', newest first and
+// trimmed to HELM_MAX_HISTORY entries. With withHooks, the Helm hooks of the latest revision are
+// published as well, from the same read of the release storage.
+func (h *handler) refreshHistory(mg *unstructured.Unstructured, releaseName string, withHooks bool) error {
+	if h.historyLister == nil {
+		return nil
+	}
+
+	rels, err := h.historyLister.List(mg.GetNamespace(), releaseName)
+	if err != nil {
+		return err
+	}
+	entries, err := history.FromReleases(rels, helmMaxHistory)
+	if err != nil {
+		return err
+	}
+	err = setHistory(mg, entries)
+	if err != nil {
+		return err
+	}
+	if !withHooks {
+		return nil
+	}
+	return setHooks(mg, hooks.FromRelease(history.Latest(rels)))
+}
+
+// historyOutdated reports whether the latest revision published in the status
+// differs from the given revision of the release.
+func historyOutdated(mg *unstructured.Unstructured, revision int) bool {
+	entries, ok, err := unstructured.NestedSlice(mg.Object, "status", "history")
+	if err != nil || !ok || len(entries) == 0 {
+		return true
+	}
+	latest, ok := entries[0].(map[string]any)
+	if !ok {
+		return true
+	}
+	rev, ok, err := unstructured.NestedFieldNoCopy(latest, "revision")
+	if err != nil || !ok {
+		return true
+	}
+	switch v := rev.(type) {
+	case int64:
+		return v != int64(revision)
+	case float64:
+		return v != float64(revision)
+	case int:
+		return v != revision
+	}
+	return true
+}
+
+func setHistory(mg *unstructured.Unstructured, entries []history.Entry) error {
+	if len(entries) == 0 {
+		unstructured.RemoveNestedField(mg.Object, "status", "history")
+		return nil
+	}
+
+	list := make([]any, 0, len(entries))
+	for i := range entries {
+		e, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&entries[i])
+		if err != nil {
+			return fmt.Errorf("converting history entry: %w", err)
+		}
+		list = append(list, e)
+	}
+	err := unstructured.SetNestedSlice(mg.Object, list, "status", "history")
+	if err != nil {
+		return fmt.Errorf("setting history in status: %w", err)
+	}
+	return nil
+}
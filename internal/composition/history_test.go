@@ -0,0 +1,76 @@
+package composition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type fakeHistoryLister struct {
+	releases []*release.Release
+}
+
+func (f *fakeHistoryLister) List(_, _ string) ([]*release.Release, error) {
+	return f.releases, nil
+}
+
+func newRevision(revision int, version string, status release.Status, hooks ...*release.Hook) *release.Release {
+	return &release.Release{
+		Name:    "demo",
+		Version: revision,
+		Chart:   &chart.Chart{Metadata: &chart.Metadata{Name: "demo", Version: version}},
+		Info:    &release.Info{Status: status},
+		Hooks:   hooks,
+	}
+}
+
+func TestRefreshHistory(t *testing.T) {
+	migrate := &release.Hook{Name: "demo-migrate", Kind: "Job", Events: []release.HookEvent{release.HookPreUpgrade},
+		LastRun: release.HookExecution{Phase: release.HookPhaseFailed}}
+	lister := &fakeHistoryLister{releases: []*release.Release{
+		newRevision(1, "1.0.0", release.StatusSuperseded),
+		newRevision(4, "1.2.0", release.StatusDeployed, migrate),
+		newRevision(2, "1.0.1", release.StatusSuperseded),
+		newRevision(3, "1.1.0", release.StatusSuperseded),
+	}}
+	h := &handler{historyLister: lister}
+
+	t.Run("with hooks", func(t *testing.T) {
+		mg := newComposition()
+		assert.True(t, historyOutdated(mg, 4))
+
+		require.NoError(t, h.refreshHistory(mg, "demo", true))
+
+		entries, ok, err := unstructured.NestedSlice(mg.Object, "status", "history")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Len(t, entries, helmMaxHistory)
+		assert.Equal(t, "1.2.0", entries[0].(map[string]any)["chartVersion"])
+
+		assert.False(t, historyOutdated(mg, 4))
+		assert.True(t, historyOutdated(mg, 5))
+
+		// The hooks of the latest revision are published from the same read
+		list, ok, err := unstructured.NestedSlice(mg.Object, "status", "hooks")
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Len(t, list, 1)
+		assert.Equal(t, "demo-migrate", list[0].(map[string]any)["name"])
+	})
+
+	t.Run("without hooks", func(t *testing.T) {
+		mg := newComposition()
+		require.NoError(t, h.refreshHistory(mg, "demo", false))
+
+		_, ok, err := unstructured.NestedSlice(mg.Object, "status", "history")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		_, ok, err = unstructured.NestedSlice(mg.Object, "status", "hooks")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
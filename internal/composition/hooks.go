@@ -0,0 +1,52 @@
+package composition
+
+import (
+	"fmt"
+	"strings"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/hooks"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// setHooks publishes the Helm hooks of the latest revision of the release under 'status.hooks'
+// and updates the HooksSucceeded condition with the outcome of their last run.
+func setHooks(mg *unstructured.Unstructured, list []hooks.Hook) error {
+	if len(list) == 0 {
+		unstructured.RemoveNestedField(mg.Object, "status", "hooks")
+		return removeCondition(mg, compositionCondition.TypeHooksSucceeded)
+	}
+
+	entries := make([]any, 0, len(list))
+	var succeeded int
+	var failed []string
+	for i := range list {
+		e, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&list[i])
+		if err != nil {
+			return fmt.Errorf("converting hook: %w", err)
+		}
+		entries = append(entries, e)
+
+		switch list[i].Outcome {
+		case hooks.OutcomeSucceeded:
+			succeeded++
+		case hooks.OutcomeFailed:
+			failed = append(failed, fmt.Sprintf("%s %s (%s)", list[i].Kind, list[i].Name, strings.Join(list[i].Phases, ", ")))
+		}
+	}
+	err := unstructured.SetNestedSlice(mg.Object, entries, "status", "hooks")
+	if err != nil {
+		return fmt.Errorf("setting hooks in status: %w", err)
+	}
+
+	switch {
+	case len(failed) > 0:
+		return setConditionMessage(mg, compositionCondition.HookFailed(),
+			fmt.Sprintf("%d hook(s) failed: %s", len(failed), strings.Join(failed, "; ")))
+	case succeeded == 0:
+		return removeCondition(mg, compositionCondition.TypeHooksSucceeded)
+	}
+	return setConditionMessage(mg, compositionCondition.HooksSucceeded(), fmt.Sprintf("%d hook(s) succeeded", succeeded))
+}
@@ -0,0 +1,65 @@
+package composition
+
+import (
+	"testing"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/hooks"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSetHooks(t *testing.T) {
+	migrate := hooks.Hook{Name: "demo-migrate", Kind: "Job", Phases: []string{"pre-upgrade"}, LastRun: "2024-05-01T10:00:00Z", Outcome: hooks.OutcomeSucceeded}
+	cleanup := hooks.Hook{Name: "demo-cleanup", Kind: "Job", Phases: []string{"pre-delete"}}
+	failed := hooks.Hook{Name: "demo-check", Kind: "Pod", Phases: []string{"post-install", "post-upgrade"}, LastRun: "2024-05-01T10:01:00Z", Outcome: hooks.OutcomeFailed}
+
+	tests := []struct {
+		name    string
+		hooks   []hooks.Hook
+		reason  string
+		message string
+	}{
+		{name: "no hooks"},
+		{name: "not run", hooks: []hooks.Hook{cleanup}},
+		{
+			name:    "succeeded",
+			hooks:   []hooks.Hook{migrate, cleanup},
+			reason:  compositionCondition.ReasonHooksSucceeded,
+			message: "1 hook(s) succeeded",
+		},
+		{
+			name:    "failed",
+			hooks:   []hooks.Hook{migrate, failed},
+			reason:  compositionCondition.ReasonHookFailed,
+			message: "1 hook(s) failed: Pod demo-check (post-install, post-upgrade)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			// A previous failure is cleared once the hooks succeed
+			require.NoError(t, setHooks(mg, []hooks.Hook{failed}))
+
+			require.NoError(t, setHooks(mg, tt.hooks))
+
+			entries, ok, err := unstructured.NestedSlice(mg.Object, "status", "hooks")
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.hooks) > 0, ok)
+			assert.Len(t, entries, len(tt.hooks))
+
+			if tt.reason == "" {
+				for _, c := range unstructuredtools.GetConditions(mg) {
+					assert.NotEqual(t, compositionCondition.TypeHooksSucceeded, c.Type)
+				}
+				return
+			}
+			cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeHooksSucceeded, tt.reason)
+			require.NotNil(t, cond)
+			assert.Equal(t, tt.message, cond.Message)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/maintenance"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// getMaintenanceWindow returns the maintenance window of the composition, if any.
+func getMaintenanceWindow(mg *unstructured.Unstructured, pkg *archive.Info) *maintenance.Spec {
+	var definition *maintenance.Spec
+	if pkg != nil {
+		definition = pkg.MaintenanceWindow
+	}
+	return annotationOr(mg, maintenanceWindowAnnotation, definition)
+}
+
+// maintenanceWindowAnnotation returns the maintenance window set with the annotations of the composition.
+func maintenanceWindowAnnotation(o metav1.Object) (*maintenance.Spec, bool) {
+	schedule, duration, ok := compositionMeta.GetMaintenanceWindow(o)
+	if !ok {
+		return nil, false
+	}
+	return &maintenance.Spec{Schedule: schedule, Duration: duration}, true
+}
+
+// deferUpgrade reports whether an upgrade must wait for the next maintenance window and,
+// in that case, sets the UpgradePending condition accordingly.
+// An invalid maintenance window defers upgrades until it is fixed, rather than ignoring it.
+func deferUpgrade(mg *unstructured.Unstructured, pkg *archive.Info, now time.Time) (bool, error) {
+	spec := getMaintenanceWindow(mg, pkg)
+	if spec == nil {
+		return false, nil
+	}
+
+	window, err := maintenance.Parse(*spec)
+	if err != nil {
+		return true, setConditionMessage(mg, compositionCondition.InvalidMaintenanceWindow(),
+			fmt.Sprintf("Upgrade deferred, invalid maintenance window: %s", err))
+	}
+	if window.Active(now) {
+		return false, nil
+	}
+
+	return true, setConditionMessage(mg, compositionCondition.OutsideMaintenanceWindow(),
+		fmt.Sprintf("Upgrade deferred until the next maintenance window starting at %s", window.NextStart(now).Format(time.RFC3339)))
+}
+
+// clearUpgradePending removes the pending upgrade condition set by a maintenance window
+// or by a rollout, together with the rollout progress.
+func clearUpgradePending(mg *unstructured.Unstructured) error {
+	unstructured.RemoveNestedField(mg.Object, "status", "rollout")
+	return removeCondition(mg, compositionCondition.TypeUpgradePending)
+}
+
+// deferToMaintenanceWindow is deferUpgrade followed by the update of the composition status
+// when the upgrade has been deferred.
+func deferToMaintenanceWindow(ctx context.Context, mg *unstructured.Unstructured, pkg *archive.Info, updateOpts tools.UpdateOptions) (bool, error) {
+	deferred, err := deferUpgrade(mg, pkg, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("checking maintenance window: %w", err)
+	}
+	if !deferred {
+		return false, nil
+	}
+	_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+	if err != nil {
+		return false, fmt.Errorf("updating status: %w", err)
+	}
+	return true, nil
+}
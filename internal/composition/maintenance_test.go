@@ -0,0 +1,84 @@
+package composition
+
+import (
+	"testing"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/maintenance"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMaintenanceWindow(t *testing.T) {
+	pkg := &archive.Info{MaintenanceWindow: &maintenance.Spec{Schedule: "0 2 * * 6", Duration: "4h"}}
+
+	mg := newComposition()
+	assert.Nil(t, getMaintenanceWindow(mg, nil))
+	assert.Equal(t, pkg.MaintenanceWindow, getMaintenanceWindow(mg, pkg))
+
+	mg.SetAnnotations(map[string]string{
+		compositionMeta.AnnotationKeyMaintenanceWindowSchedule: "0 22 * * *",
+		compositionMeta.AnnotationKeyMaintenanceWindowDuration: "1h",
+	})
+	assert.Equal(t, &maintenance.Spec{Schedule: "0 22 * * *", Duration: "1h"}, getMaintenanceWindow(mg, pkg))
+}
+
+func TestDeferUpgrade(t *testing.T) {
+	// Saturday
+	inside := time.Date(2025, 3, 8, 3, 0, 0, 0, time.UTC)
+	outside := time.Date(2025, 3, 8, 7, 0, 0, 0, time.UTC)
+	window := &maintenance.Spec{Schedule: "0 2 * * 6", Duration: "4h"}
+
+	tests := []struct {
+		name     string
+		pkg      *archive.Info
+		now      time.Time
+		deferred bool
+		reason   string
+		message  string
+	}{
+		{name: "no maintenance window", pkg: &archive.Info{}, now: outside},
+		{name: "inside the window", pkg: &archive.Info{MaintenanceWindow: window}, now: inside},
+		{
+			name:     "outside the window",
+			pkg:      &archive.Info{MaintenanceWindow: window},
+			now:      outside,
+			deferred: true,
+			reason:   compositionCondition.ReasonOutsideMaintenanceWindow,
+			message:  "Upgrade deferred until the next maintenance window starting at 2025-03-15T02:00:00Z",
+		},
+		{
+			name:     "invalid window",
+			pkg:      &archive.Info{MaintenanceWindow: &maintenance.Spec{Schedule: "every night", Duration: "4h"}},
+			now:      inside,
+			deferred: true,
+			reason:   compositionCondition.ReasonInvalidMaintenanceWindow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			deferred, err := deferUpgrade(mg, tt.pkg, tt.now)
+			require.NoError(t, err)
+			assert.Equal(t, tt.deferred, deferred)
+
+			if !tt.deferred {
+				assert.Empty(t, unstructuredtools.GetConditions(mg))
+				return
+			}
+			cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeUpgradePending, tt.reason)
+			require.NotNil(t, cond)
+			if tt.message != "" {
+				assert.Equal(t, tt.message, cond.Message)
+			}
+
+			require.NoError(t, clearUpgradePending(mg))
+			assert.Nil(t, unstructuredtools.GetCondition(mg, compositionCondition.TypeUpgradePending, tt.reason))
+		})
+	}
+}
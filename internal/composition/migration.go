@@ -0,0 +1,103 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/rbacgen"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rbac"
+
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// needsReleaseNameMigration reports whether the composition still uses the release name scheme of the
+// versions up to 0.19.9, where the release was named after the composition, and returns the new name.
+func needsReleaseNameMigration(mg *unstructured.Unstructured) (string, bool) {
+	if !releaseNameMigration || compositionMeta.GetReleaseName(mg) != mg.GetName() {
+		return "", false
+	}
+	to := compositionMeta.CalculateReleaseName(mg)
+	return to, to != mg.GetName()
+}
+
+// migrateReleaseName moves the release of a composition named with the pre-0.20 scheme to the UID-suffixed
+// release name, then points the release name label to it. Only the Helm release storage is rewritten, the
+// deployed objects are left untouched. The progress is reported with the ReleaseNameMigrated condition.
+// The previous name is kept in status until the RBAC policy generated under it is removed, see removePreviousRBAC.
+// It returns the updated composition and whether the release name changed.
+func (h *handler) migrateReleaseName(ctx context.Context, mg *unstructured.Unstructured, updateOpts tools.UpdateOptions) (*unstructured.Unstructured, bool, error) {
+	to, ok := needsReleaseNameMigration(mg)
+	if !ok || h.releaseRenamer == nil {
+		return mg, false, nil
+	}
+	from := compositionMeta.GetReleaseName(mg)
+
+	err := setConditionMessage(mg, compositionCondition.ReleaseNameMigrating(), fmt.Sprintf("Migrating release %s to %s", from, to))
+	if err != nil {
+		return mg, false, err
+	}
+	mg, err = tools.UpdateStatus(ctx, mg, updateOpts)
+	if err != nil {
+		return mg, false, fmt.Errorf("updating status: %w", err)
+	}
+
+	moved, renameErr := h.releaseRenamer.Rename(mg.GetNamespace(), from, to)
+	if renameErr != nil {
+		renameErr = fmt.Errorf("migrating release %s to %s: %w", from, to, renameErr)
+		err = setConditionMessage(mg, compositionCondition.ReleaseNameMigrationFailed(), renameErr.Error())
+		if err != nil {
+			return mg, false, err
+		}
+		_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+		if err != nil {
+			return mg, false, fmt.Errorf("updating status after failure: %w", err)
+		}
+		return mg, false, renameErr
+	}
+
+	err = setConditionMessage(mg, compositionCondition.ReleaseNameMigrated(),
+		fmt.Sprintf("Release %s migrated to %s, %d revision(s) moved", from, to, moved))
+	if err != nil {
+		return mg, false, err
+	}
+	err = unstructured.SetNestedField(mg.Object, from, "status", "previousReleaseName")
+	if err != nil {
+		return mg, false, fmt.Errorf("setting previous release name in status: %w", err)
+	}
+	mg, err = tools.UpdateStatus(ctx, mg, updateOpts)
+	if err != nil {
+		return mg, false, fmt.Errorf("updating status: %w", err)
+	}
+	compositionMeta.ReplaceReleaseName(mg, to)
+	mg, err = tools.Update(ctx, mg, updateOpts)
+	if err != nil {
+		return mg, false, fmt.Errorf("updating cr with values: %w", err)
+	}
+	return mg, true, nil
+}
+
+// removePreviousRBAC deletes the RBAC policy generated under the release name used before the migration,
+// as the policy is named after the release and would otherwise be left behind. It is called once the policy
+// of the new name is in place, and on delete; the previous name is forgotten once its policy is gone.
+func (h *handler) removePreviousRBAC(dyn dynamic.Interface, mg *unstructured.Unstructured, rbgen rbacgen.RBACGenInterface, params rbacgen.Parameters) error {
+	previous, _, _ := unstructured.NestedString(mg.Object, "status", "previousReleaseName")
+	if previous == "" {
+		return nil
+	}
+	if previous != compositionMeta.GetReleaseName(mg) {
+		generated, err := rbgen.WithBaseName(previous).Generate(params)
+		if err != nil {
+			return fmt.Errorf("generating RBAC of previous release %s: %w", previous, err)
+		}
+		err = rbac.NewRBACInstaller(dyn).UninstallRBAC(generated)
+		if err != nil {
+			return fmt.Errorf("uninstalling RBAC of previous release %s: %w", previous, err)
+		}
+	}
+	unstructured.RemoveNestedField(mg.Object, "status", "previousReleaseName")
+	return nil
+}
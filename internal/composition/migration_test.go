@@ -0,0 +1,153 @@
+package composition
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/chartinspector"
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/rbacgen"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+type fakeRenamer struct {
+	renamed [][2]string
+	err     error
+}
+
+func (f *fakeRenamer) Rename(_, from, to string) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	f.renamed = append(f.renamed, [2]string{from, to})
+	return 3, nil
+}
+
+func TestMigrateReleaseName(t *testing.T) {
+	defer func(enabled bool) { releaseNameMigration = enabled }(releaseNameMigration)
+
+	tests := []struct {
+		name        string
+		enabled     bool
+		releaseName string
+		renameErr   error
+		migrated    bool
+		reason      string
+	}{
+		{name: "disabled", releaseName: "demo"},
+		{name: "already migrated", enabled: true, releaseName: "demo-5a47edd9"},
+		{name: "migrated", enabled: true, releaseName: "demo", migrated: true, reason: compositionCondition.ReasonReleaseNameMigrated},
+		{name: "failed", enabled: true, releaseName: "demo", renameErr: errors.New("boom"), reason: compositionCondition.ReasonReleaseNameMigrationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releaseNameMigration = tt.enabled
+			mg := newComposition()
+			mg.SetUID(types.UID("5a47edd9-c710-4b4b-b5ea-b6cdf9fc1f58"))
+			compositionMeta.SetReleaseName(mg, tt.releaseName)
+			newName := compositionMeta.CalculateReleaseName(mg)
+
+			dyn := newDependencyClient(mg)
+			renamer := &fakeRenamer{err: tt.renameErr}
+			h := newDependencyHandler()
+			h.releaseRenamer = renamer
+
+			res, migrated, err := h.migrateReleaseName(context.Background(), mg, tools.UpdateOptions{Pluralizer: h.pluralizer, DynamicClient: dyn})
+			if tt.renameErr != nil {
+				assert.ErrorIs(t, err, tt.renameErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.migrated, migrated)
+
+			stored, err := dyn.Resource(demoGVR).Namespace("demo-system").Get(context.Background(), "demo", metav1.GetOptions{})
+			require.NoError(t, err)
+			if tt.reason == "" {
+				assert.Empty(t, renamer.renamed)
+				assert.Equal(t, tt.releaseName, compositionMeta.GetReleaseName(stored))
+				return
+			}
+
+			cond := unstructuredtools.GetCondition(stored, compositionCondition.TypeReleaseNameMigrated, tt.reason)
+			require.NotNil(t, cond)
+			if !tt.migrated {
+				assert.Equal(t, "demo", compositionMeta.GetReleaseName(stored))
+				return
+			}
+			assert.Equal(t, [][2]string{{"demo", newName}}, renamer.renamed)
+			assert.Equal(t, "Release demo migrated to "+newName+", 3 revision(s) moved", cond.Message)
+			assert.Equal(t, newName, compositionMeta.GetReleaseName(stored))
+			assert.Equal(t, newName, compositionMeta.GetReleaseName(res))
+			previous, _, _ := unstructured.NestedString(stored.Object, "status", "previousReleaseName")
+			assert.Equal(t, "demo", previous)
+		})
+	}
+}
+
+type fakeChartInspector struct {
+	resources []chartinspector.Resource
+}
+
+func (f *fakeChartInspector) Resources(_ chartinspector.Parameters) ([]chartinspector.Resource, error) {
+	return f.resources, nil
+}
+
+func TestRemovePreviousRBAC(t *testing.T) {
+	var (
+		clusterRolesGVR = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+		rolesGVR        = schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}
+	)
+	newRBACObject := func(kind, namespace, name string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]any{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": kind}}
+		obj.SetNamespace(namespace)
+		obj.SetName(name)
+		return obj
+	}
+
+	mg := newComposition()
+	mg.SetUID(types.UID("5a47edd9-c710-4b4b-b5ea-b6cdf9fc1f58"))
+	compositionMeta.SetReleaseName(mg, compositionMeta.CalculateReleaseName(mg))
+	require.NoError(t, unstructured.SetNestedField(mg.Object, "demo", "status", "previousReleaseName"))
+
+	dyn := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newRBACObject("ClusterRole", "", "demo"),
+		newRBACObject("ClusterRole", "", "demo-5a47edd9"),
+		newRBACObject("Role", "demo-system", "demo"),
+		newRBACObject("Role", "demo-system", "demo-5a47edd9"),
+	)
+	rbgen := rbacgen.NewRBACGen("cdc", "krateo-system", &fakeChartInspector{resources: []chartinspector.Resource{
+		{Version: "v1", Resource: "configmaps", Name: "demo", Namespace: "demo-system"},
+	}})
+
+	h := &handler{}
+	require.NoError(t, h.removePreviousRBAC(dyn, mg, rbgen, rbacgen.Parameters{CompositionName: "demo", CompositionNamespace: "demo-system"}))
+
+	_, err := dyn.Resource(clusterRolesGVR).Get(context.Background(), "demo", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "the cluster role of the previous release must be deleted")
+	_, err = dyn.Resource(rolesGVR).Namespace("demo-system").Get(context.Background(), "demo", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "the role of the previous release must be deleted")
+
+	_, err = dyn.Resource(clusterRolesGVR).Get(context.Background(), "demo-5a47edd9", metav1.GetOptions{})
+	assert.NoError(t, err)
+	_, err = dyn.Resource(rolesGVR).Namespace("demo-system").Get(context.Background(), "demo-5a47edd9", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	_, ok, _ := unstructured.NestedString(mg.Object, "status", "previousReleaseName")
+	assert.False(t, ok)
+
+	// Nothing left to remove
+	require.NoError(t, h.removePreviousRBAC(dyn, mg, rbgen, rbacgen.Parameters{}))
+}
@@ -0,0 +1,189 @@
+package composition
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/outputs"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/processor"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// outputsFieldManager is the field manager of the Secret mirroring the outputs.
+const outputsFieldManager = "composition-dynamic-controller"
+
+var secretsGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+// outputsSecretName returns the name of the Secret mirroring the outputs of the composition.
+func outputsSecretName(mg *unstructured.Unstructured) string {
+	return compositionMeta.GetReleaseName(mg) + "-outputs"
+}
+
+// outputsSecretEnabled reports whether the outputs must be mirrored into a Secret,
+// either because the definition asks so or because some of them are sensitive.
+func outputsSecretEnabled(pkg *archive.Info) bool {
+	if pkg.OutputsSecret {
+		return true
+	}
+	for _, out := range pkg.Outputs {
+		if out.Sensitive {
+			return true
+		}
+	}
+	return false
+}
+
+// publishOutputs resolves the outputs declared in the definition against the live objects of the release,
+// publishes the ones that are not sensitive under 'status.outputs' and mirrors all of them into a Secret
+// when requested. The outputs that cannot be resolved yet are left out and reported in the returned error.
+func (h *handler) publishOutputs(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, pkg *archive.Info, rel *helmconfig.Release) error {
+	if pkg == nil || len(pkg.Outputs) == 0 {
+		unstructured.RemoveNestedField(mg.Object, "status", "outputs")
+		return h.deleteOutputsSecret(ctx, dyn, mg)
+	}
+
+	rendered, _, err := processor.DecodeUnstructuredRelease(rel)
+	if err != nil {
+		return fmt.Errorf("decoding release: %w", err)
+	}
+	values, resolveErr := outputs.Resolve(ctx, rendered, pkg.Outputs, func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		cli, _, err := h.resourceClient(dyn, mg, obj)
+		if err != nil {
+			return nil, err
+		}
+		return cli.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	})
+
+	err = setOutputs(mg, pkg.Outputs, values)
+	if err != nil {
+		return err
+	}
+	if !outputsSecretEnabled(pkg) {
+		return errors.Join(resolveErr, h.deleteOutputsSecret(ctx, dyn, mg))
+	}
+	return errors.Join(resolveErr, h.applyOutputsSecret(ctx, dyn, mg, values))
+}
+
+// setOutputs publishes the resolved outputs that are not sensitive under 'status.outputs'.
+func setOutputs(mg *unstructured.Unstructured, outs []outputs.Output, values map[string]string) error {
+	published := map[string]any{}
+	for _, out := range outs {
+		val, ok := values[out.Name]
+		if !ok || out.Sensitive {
+			continue
+		}
+		published[out.Name] = val
+	}
+	if len(published) == 0 {
+		unstructured.RemoveNestedField(mg.Object, "status", "outputs")
+		return nil
+	}
+	err := unstructured.SetNestedMap(mg.Object, published, "status", "outputs")
+	if err != nil {
+		return fmt.Errorf("setting outputs in status: %w", err)
+	}
+	return nil
+}
+
+// applyOutputsSecret mirrors the resolved outputs into a Secret owned by the composition,
+// so that it is garbage collected together with it. A Secret of the same name not owned by the
+// composition is left untouched, and the Secret of a previous release name is deleted.
+func (h *handler) applyOutputsSecret(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, values map[string]string) error {
+	name := outputsSecretName(mg)
+	cli := dyn.Resource(secretsGVR).Namespace(mg.GetNamespace())
+
+	previous, _, _ := unstructured.NestedString(mg.Object, "status", "outputsSecretName")
+	if previous != "" && previous != name {
+		err := deleteOwnedSecret(ctx, cli, mg, previous)
+		if err != nil {
+			return err
+		}
+		unstructured.RemoveNestedField(mg.Object, "status", "outputsSecretName")
+	}
+
+	existing, err := cli.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("getting outputs secret %s: %w", name, err)
+	}
+	if err == nil && !controlledBy(existing, mg) {
+		return fmt.Errorf("outputs secret %s already exists and is not owned by the composition", name)
+	}
+
+	data := make(map[string]any, len(values))
+	for k, v := range values {
+		data[k] = base64.StdEncoding.EncodeToString([]byte(v))
+	}
+
+	secret := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]any{
+			"name":      name,
+			"namespace": mg.GetNamespace(),
+		},
+		"type": "Opaque",
+		"data": data,
+	}}
+	secret.SetOwnerReferences([]metav1.OwnerReference{
+		*metav1.NewControllerRef(mg, mg.GroupVersionKind()),
+	})
+
+	_, err = cli.Apply(ctx, name, secret, metav1.ApplyOptions{
+		FieldManager: outputsFieldManager,
+		Force:        true,
+	})
+	if err != nil {
+		return fmt.Errorf("applying outputs secret %s: %w", name, err)
+	}
+	return unstructured.SetNestedField(mg.Object, name, "status", "outputsSecretName")
+}
+
+// deleteOutputsSecret deletes the Secret mirroring the outputs, if it has been created.
+func (h *handler) deleteOutputsSecret(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured) error {
+	name, ok, err := unstructured.NestedString(mg.Object, "status", "outputsSecretName")
+	if err != nil || !ok {
+		return err
+	}
+	err = deleteOwnedSecret(ctx, dyn.Resource(secretsGVR).Namespace(mg.GetNamespace()), mg, name)
+	if err != nil {
+		return err
+	}
+	unstructured.RemoveNestedField(mg.Object, "status", "outputsSecretName")
+	return nil
+}
+
+// deleteOwnedSecret deletes the Secret if it is owned by the composition.
+func deleteOwnedSecret(ctx context.Context, cli dynamic.ResourceInterface, mg *unstructured.Unstructured, name string) error {
+	secret, err := cli.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting outputs secret %s: %w", name, err)
+	}
+	if !controlledBy(secret, mg) {
+		return nil
+	}
+	uid := secret.GetUID()
+	err = cli.Delete(ctx, name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting outputs secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// controlledBy reports whether the object is controlled by the composition.
+func controlledBy(obj *unstructured.Unstructured, mg *unstructured.Unstructured) bool {
+	ref := metav1.GetControllerOfNoCopy(obj)
+	return ref != nil && ref.UID == mg.GetUID()
+}
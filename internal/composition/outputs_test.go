@@ -0,0 +1,206 @@
+package composition
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/outputs"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestPublishOutputs(t *testing.T) {
+	manifest := `
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: endpoint
+data:
+  host: db.example.com
+  password: s3cr3t
+`
+	pkg := &archive.Info{Outputs: []outputs.Output{
+		{Name: "host", Selector: outputs.Selector{APIVersion: "v1", Kind: "ConfigMap", Name: "endpoint"}, JSONPath: ".data.host"},
+		{Name: "password", Selector: outputs.Selector{APIVersion: "v1", Kind: "ConfigMap", Name: "endpoint"}, JSONPath: ".data.password", Sensitive: true},
+		{Name: "port", Selector: outputs.Selector{APIVersion: "v1", Kind: "ConfigMap", Name: "endpoint"}, JSONPath: ".data.port"},
+	}}
+
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "configmaps"}: "ConfigMapList",
+			secretsGVR:                              "SecretList",
+		},
+		newConfigMap("endpoint", map[string]any{"host": "db.example.com", "password": "s3cr3t"}),
+	)
+	// The fake client does not implement server-side apply for unstructured objects, record the patches instead
+	var applied []clienttesting.PatchAction
+	dyn.PrependReactor("patch", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		pa := action.(clienttesting.PatchAction)
+		applied = append(applied, pa)
+		return true, &unstructured.Unstructured{}, nil
+	})
+
+	h := &handler{
+		pluralizer: &mockPluralizer{
+			gvrMap: map[schema.GroupVersionKind]schema.GroupVersionResource{
+				{Version: "v1", Kind: "ConfigMap"}: {Version: "v1", Resource: "configmaps"},
+			},
+		},
+	}
+
+	mg := newComposition()
+	mg.SetUID("demo-uid")
+	compositionMeta.SetReleaseName(mg, "demo")
+	err := h.publishOutputs(context.Background(), dyn, mg, pkg, &helmconfig.Release{Manifest: manifest})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `output "port"`)
+
+	// Sensitive outputs are only published in the Secret
+	published, ok, err := unstructured.NestedStringMap(mg.Object, "status", "outputs")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{"host": "db.example.com"}, published)
+
+	require.Len(t, applied, 1)
+	assert.Equal(t, "demo-outputs", applied[0].GetName())
+	var secret unstructured.Unstructured
+	require.NoError(t, secret.UnmarshalJSON(applied[0].GetPatch()))
+	data, _, _ := unstructured.NestedStringMap(secret.Object, "data")
+	assert.Equal(t, map[string]string{
+		"host":     base64.StdEncoding.EncodeToString([]byte("db.example.com")),
+		"password": base64.StdEncoding.EncodeToString([]byte("s3cr3t")),
+	}, data)
+	require.Len(t, secret.GetOwnerReferences(), 1)
+	assert.Equal(t, "Demo", secret.GetOwnerReferences()[0].Kind)
+
+	name, _, _ := unstructured.NestedString(mg.Object, "status", "outputsSecretName")
+	assert.Equal(t, "demo-outputs", name)
+	secret.SetNamespace("demo-system")
+	require.NoError(t, dyn.Tracker().Add(&secret))
+
+	// Without outputs, the status and the Secret are cleaned up
+	var deleted []string
+	dyn.PrependReactor("delete", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		deleted = append(deleted, action.(clienttesting.DeleteAction).GetName())
+		return true, nil, nil
+	})
+	err = h.publishOutputs(context.Background(), dyn, mg, &archive.Info{}, &helmconfig.Release{Manifest: manifest})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"demo-outputs"}, deleted)
+	_, ok, _ = unstructured.NestedFieldNoCopy(mg.Object, "status", "outputs")
+	assert.False(t, ok)
+	_, ok, _ = unstructured.NestedFieldNoCopy(mg.Object, "status", "outputsSecretName")
+	assert.False(t, ok)
+}
+
+func TestOutputsSecretEnabled(t *testing.T) {
+	out := outputs.Output{Name: "host", JSONPath: ".data.host"}
+	sensitive := outputs.Output{Name: "password", JSONPath: ".data.password", Sensitive: true}
+
+	assert.False(t, outputsSecretEnabled(&archive.Info{Outputs: []outputs.Output{out}}))
+	assert.True(t, outputsSecretEnabled(&archive.Info{Outputs: []outputs.Output{out}, OutputsSecret: true}))
+	assert.True(t, outputsSecretEnabled(&archive.Info{Outputs: []outputs.Output{out, sensitive}}))
+}
+
+func TestApplyOutputsSecretOwnership(t *testing.T) {
+	newSecret := func(name string, owner *unstructured.Unstructured) *unstructured.Unstructured {
+		secret := &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]any{"name": name, "namespace": "demo-system"},
+		}}
+		if owner != nil {
+			secret.SetOwnerReferences([]metav1.OwnerReference{*metav1.NewControllerRef(owner, owner.GroupVersionKind())})
+		}
+		return secret
+	}
+	mg := newComposition()
+	mg.SetUID("demo-uid")
+	compositionMeta.SetReleaseName(mg, "demo")
+	other := newComposition()
+	other.SetUID("other-uid")
+
+	tests := []struct {
+		name     string
+		existing []runtime.Object
+		previous string
+		err      string
+		applied  bool
+		deleted  []string
+	}{
+		{
+			name:    "new secret",
+			applied: true,
+		},
+		{
+			name:     "secret owned by the composition",
+			existing: []runtime.Object{newSecret("demo-outputs", mg)},
+			applied:  true,
+		},
+		{
+			name:     "secret owned by another composition",
+			existing: []runtime.Object{newSecret("demo-outputs", other)},
+			err:      "outputs secret demo-outputs already exists and is not owned by the composition",
+		},
+		{
+			name:     "secret not owned",
+			existing: []runtime.Object{newSecret("demo-outputs", nil)},
+			err:      "outputs secret demo-outputs already exists and is not owned by the composition",
+		},
+		{
+			name:     "secret of the release name before the migration",
+			existing: []runtime.Object{newSecret("old-outputs", mg)},
+			previous: "old-outputs",
+			applied:  true,
+			deleted:  []string{"old-outputs"},
+		},
+		{
+			name:     "secret of the previous release name not owned",
+			existing: []runtime.Object{newSecret("old-outputs", other)},
+			previous: "old-outputs",
+			applied:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{secretsGVR: "SecretList"}, tt.existing...)
+			applied := false
+			dyn.PrependReactor("patch", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				applied = true
+				return true, &unstructured.Unstructured{}, nil
+			})
+			var deleted []string
+			dyn.PrependReactor("delete", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				deleted = append(deleted, action.(clienttesting.DeleteAction).GetName())
+				return true, nil, nil
+			})
+
+			obj := mg.DeepCopy()
+			if tt.previous != "" {
+				require.NoError(t, unstructured.SetNestedField(obj.Object, tt.previous, "status", "outputsSecretName"))
+			}
+			err := (&handler{}).applyOutputsSecret(context.Background(), dyn, obj, map[string]string{"host": "db"})
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+				name, _, _ := unstructured.NestedString(obj.Object, "status", "outputsSecretName")
+				assert.Equal(t, "demo-outputs", name)
+			}
+			assert.Equal(t, tt.applied, applied)
+			assert.Equal(t, tt.deleted, deleted)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package composition
+
+import (
+	"fmt"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// releaseConflict reports whether the release is owned by another composition, in which case the
+// ReleaseConflict condition is set and the release must be left untouched. Releases installed
+// before ownership was stamped have no owner and are claimed by the next install or upgrade.
+// A revision already found owned by the composition is not looked up again.
+func (h *handler) releaseConflict(mg *unstructured.Unstructured, releaseName string, revision int) (bool, error) {
+	if h.ownerGetter == nil {
+		return false, nil
+	}
+	if h.ownedReleases.Owned(mg.GetNamespace(), releaseName, mg.GetUID(), revision) {
+		return false, removeCondition(mg, compositionCondition.TypeReleaseConflict)
+	}
+
+	owner, err := h.ownerGetter.Owner(mg.GetNamespace(), releaseName)
+	if err != nil {
+		return false, fmt.Errorf("getting release owner: %w", err)
+	}
+	if owner == string(mg.GetUID()) {
+		h.ownedReleases.SetOwned(mg.GetNamespace(), releaseName, mg.GetUID(), revision)
+	}
+	if owner == "" || owner == string(mg.GetUID()) {
+		return false, removeCondition(mg, compositionCondition.TypeReleaseConflict)
+	}
+
+	err = setConditionMessage(mg, compositionCondition.ReleaseOwnedByOther(),
+		fmt.Sprintf("Release %s is owned by another composition (uid %s), it is left untouched", releaseName, owner))
+	if err != nil {
+		return false, fmt.Errorf("setting release conflict condition: %w", err)
+	}
+	return true, nil
+}
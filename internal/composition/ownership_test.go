@@ -0,0 +1,81 @@
+package composition
+
+import (
+	"testing"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/ownership"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type fakeOwnerGetter struct {
+	owner   string
+	lookups int
+}
+
+func (f *fakeOwnerGetter) Owner(_, _ string) (string, error) {
+	f.lookups++
+	return f.owner, nil
+}
+
+func TestReleaseConflict(t *testing.T) {
+	const uid = types.UID("0c2b4f4e-6f5e-4a8b-9d3a-2f1e0b7c9a11")
+
+	tests := []struct {
+		name     string
+		owner    string
+		conflict bool
+	}{
+		{name: "not owned"},
+		{name: "owned by the composition", owner: string(uid)},
+		{name: "owned by another composition", owner: "5d1e7a0b-3c4f-4e2a-8b9c-7a6d5e4f3b21", conflict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &handler{ownerGetter: &fakeOwnerGetter{owner: tt.owner}}
+			mg := newComposition()
+			mg.SetUID(uid)
+			// A previous conflict is cleared once the release is no longer owned by another composition
+			require.NoError(t, unstructuredtools.SetConditions(mg, compositionCondition.ReleaseOwnedByOther()))
+
+			conflict, err := h.releaseConflict(mg, "demo", 3)
+			require.NoError(t, err)
+			assert.Equal(t, tt.conflict, conflict)
+
+			cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeReleaseConflict, compositionCondition.ReasonReleaseOwnedByOther)
+			if !tt.conflict {
+				assert.Nil(t, cond)
+				return
+			}
+			require.NotNil(t, cond)
+			assert.Equal(t, "Release demo is owned by another composition (uid 5d1e7a0b-3c4f-4e2a-8b9c-7a6d5e4f3b21), it is left untouched", cond.Message)
+		})
+	}
+}
+
+func TestReleaseConflictCached(t *testing.T) {
+	const uid = types.UID("0c2b4f4e-6f5e-4a8b-9d3a-2f1e0b7c9a11")
+
+	getter := &fakeOwnerGetter{owner: string(uid)}
+	h := &handler{ownerGetter: getter, ownedReleases: ownership.NewCache()}
+	mg := newComposition()
+	mg.SetUID(uid)
+
+	for range 2 {
+		conflict, err := h.releaseConflict(mg, "demo", 3)
+		require.NoError(t, err)
+		assert.False(t, conflict)
+	}
+	assert.Equal(t, 1, getter.lookups, "an owned revision is looked up once")
+
+	// A new revision may have been installed by someone else, it is looked up again
+	getter.owner = "5d1e7a0b-3c4f-4e2a-8b9c-7a6d5e4f3b21"
+	conflict, err := h.releaseConflict(mg, "demo", 4)
+	require.NoError(t, err)
+	assert.True(t, conflict)
+	assert.Equal(t, 2, getter.lookups)
+}
@@ -0,0 +1,57 @@
+package composition
+
+import (
+	"fmt"
+	"time"
+
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// pauseStatus describes the graceful pause of the composition under 'status.pause'.
+type pauseStatus struct {
+	PausedBy string `json:"pausedBy,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	PausedAt string `json:"pausedAt,omitempty"`
+	ResumeAt string `json:"resumeAt,omitempty"`
+}
+
+// setPauseStatus publishes who paused the composition, why, and when the pause expires, as told by its annotations.
+func setPauseStatus(mg *unstructured.Unstructured) error {
+	annotations := mg.GetAnnotations()
+	status := pauseStatus{
+		PausedBy: annotations[compositionMeta.AnnotationKeyReconciliationGracefullyPausedBy],
+		Reason:   annotations[compositionMeta.AnnotationKeyReconciliationGracefullyPausedReason],
+	}
+	if t, ok := compositionMeta.GetGracefullyPausedTime(mg); ok {
+		status.PausedAt = t.UTC().Format(time.RFC3339)
+	}
+	if t, ok := compositionMeta.GetGracefullyPausedResumeTime(mg); ok {
+		status.ResumeAt = t.UTC().Format(time.RFC3339)
+	}
+
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return fmt.Errorf("converting pause status: %w", err)
+	}
+	return unstructured.SetNestedMap(mg.Object, m, "status", "pause")
+}
+
+// clearPauseStatus removes the description of the graceful pause from the status.
+func clearPauseStatus(mg *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(mg.Object, "status", "pause")
+}
+
+// pauseExpired reports whether the composition is gracefully paused with a deadline that has passed.
+func pauseExpired(mg *unstructured.Unstructured, now time.Time) (time.Time, bool) {
+	if !compositionMeta.IsGracefullyPaused(mg) {
+		return time.Time{}, false
+	}
+	resumeAt, ok := compositionMeta.GetGracefullyPausedResumeTime(mg)
+	if !ok || now.Before(resumeAt) {
+		return time.Time{}, false
+	}
+	return resumeAt, true
+}
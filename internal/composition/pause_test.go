@@ -0,0 +1,98 @@
+package composition
+
+import (
+	"testing"
+	"time"
+
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPauseExpired(t *testing.T) {
+	pausedAt := time.Date(2025, 3, 8, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		now         time.Time
+		expired     bool
+	}{
+		{
+			name: "not paused",
+			annotations: map[string]string{
+				compositionMeta.AnnotationKeyReconciliationGracefullyPausedUntil: "2025-03-08T12:00:00Z",
+			},
+			now: pausedAt.Add(3 * time.Hour),
+		},
+		{
+			name:        "paused without deadline",
+			annotations: map[string]string{compositionMeta.AnnotationKeyReconciliationGracefullyPaused: "true"},
+			now:         pausedAt.Add(300 * time.Hour),
+		},
+		{
+			name: "duration not elapsed",
+			annotations: map[string]string{
+				compositionMeta.AnnotationKeyReconciliationGracefullyPaused:         "true",
+				compositionMeta.AnnotationKeyReconciliationGracefullyPausedTime:     pausedAt.Format(time.RFC3339),
+				compositionMeta.AnnotationKeyReconciliationGracefullyPausedDuration: "2h",
+			},
+			now: pausedAt.Add(time.Hour),
+		},
+		{
+			name: "duration elapsed",
+			annotations: map[string]string{
+				compositionMeta.AnnotationKeyReconciliationGracefullyPaused:         "true",
+				compositionMeta.AnnotationKeyReconciliationGracefullyPausedTime:     pausedAt.Format(time.RFC3339),
+				compositionMeta.AnnotationKeyReconciliationGracefullyPausedDuration: "2h",
+			},
+			now:     pausedAt.Add(2 * time.Hour),
+			expired: true,
+		},
+		{
+			name: "deadline passed",
+			annotations: map[string]string{
+				compositionMeta.AnnotationKeyReconciliationGracefullyPaused:      "true",
+				compositionMeta.AnnotationKeyReconciliationGracefullyPausedUntil: "2025-03-08T12:00:00Z",
+			},
+			now:     pausedAt.Add(3 * time.Hour),
+			expired: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			mg.SetAnnotations(tt.annotations)
+			_, expired := pauseExpired(mg, tt.now)
+			assert.Equal(t, tt.expired, expired)
+		})
+	}
+}
+
+func TestSetPauseStatus(t *testing.T) {
+	mg := newComposition()
+	mg.SetAnnotations(map[string]string{
+		compositionMeta.AnnotationKeyReconciliationGracefullyPaused:         "true",
+		compositionMeta.AnnotationKeyReconciliationGracefullyPausedTime:     "2025-03-08T10:00:00Z",
+		compositionMeta.AnnotationKeyReconciliationGracefullyPausedDuration: "2h",
+		compositionMeta.AnnotationKeyReconciliationGracefullyPausedBy:       "jane",
+		compositionMeta.AnnotationKeyReconciliationGracefullyPausedReason:   "database migration",
+	})
+
+	require.NoError(t, setPauseStatus(mg))
+	pause, ok, err := unstructured.NestedStringMap(mg.Object, "status", "pause")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, map[string]string{
+		"pausedBy": "jane",
+		"reason":   "database migration",
+		"pausedAt": "2025-03-08T10:00:00Z",
+		"resumeAt": "2025-03-08T12:00:00Z",
+	}, pause)
+
+	clearPauseStatus(mg)
+	_, ok, _ = unstructured.NestedMap(mg.Object, "status", "pause")
+	assert.False(t, ok)
+}
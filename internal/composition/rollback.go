@@ -0,0 +1,355 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/hasher"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/history"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/processor"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"github.com/krateoplatformops/plumbing/kubeutil/event"
+
+	"github.com/krateoplatformops/unstructured-runtime/pkg/controller"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/logging"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// failedUpgrade describes an upgrade that has been rolled back.
+type failedUpgrade struct {
+	revision     int
+	chartVersion string
+	restored     int
+}
+
+// atomicEnabled reports whether failed upgrades should be rolled back.
+func atomicEnabled(mg *unstructured.Unstructured, pkg *archive.Info) bool {
+	return annotationOr(mg, compositionMeta.GetAtomic, pkg != nil && pkg.Atomic)
+}
+
+// rollbackFailedUpgrade rolls the release back to the newest revision still deployed after the failed upgrade.
+// The release read before the upgrade is not used as the target, since it may itself be a failed install or upgrade.
+// It returns nil when the failed upgrade did not create a new revision, as there is nothing to roll back,
+// and an error when no revision has ever been deployed successfully.
+func (h *handler) rollbackFailedUpgrade(ctx context.Context, hc helmconfig.Client, mg *unstructured.Unstructured, releaseName string, previous *helmconfig.Release, wait waitOptions) (*failedUpgrade, error) {
+	latest, err := hc.GetRelease(ctx, releaseName, &helmconfig.GetConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("finding helm release: %w", err)
+	}
+	if latest == nil || latest.Revision <= previous.Revision {
+		return nil, nil
+	}
+
+	if h.historyLister == nil {
+		return nil, fmt.Errorf("release history not available, rollback skipped")
+	}
+	rels, err := h.historyLister.List(mg.GetNamespace(), releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("listing release history: %w", err)
+	}
+	entries, err := history.FromReleases(rels, 0)
+	if err != nil {
+		return nil, fmt.Errorf("listing release history: %w", err)
+	}
+	restored := lastDeployedRevision(entries, latest.Revision)
+	if restored == 0 {
+		return nil, fmt.Errorf("no deployed revision of release %s to roll back to, rollback skipped", releaseName)
+	}
+
+	_, err = hc.Rollback(ctx, releaseName, &helmconfig.RollbackConfig{
+		ReleaseVersion: restored,
+		MaxHistory:     helmMaxHistory,
+		Wait:           wait.enabled,
+		WaitForJobs:    wait.enabled,
+		Timeout:        wait.timeout,
+		CleanupOnFail:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("rolling back release to revision %d: %w", restored, err)
+	}
+
+	return &failedUpgrade{
+		revision:     latest.Revision,
+		chartVersion: latest.ChartVersion,
+		restored:     restored,
+	}, nil
+}
+
+// lastDeployedRevision returns the newest revision older than the given one whose status is deployed, or 0 if there is none.
+func lastDeployedRevision(entries []history.Entry, before int) int {
+	restored := 0
+	for _, e := range entries {
+		if e.Revision < before && e.Revision > restored && e.Status == release.StatusDeployed.String() {
+			restored = e.Revision
+		}
+	}
+	return restored
+}
+
+// setLastFailure records the failed upgrade in the composition status.
+// The failed revision is omitted when the upgrade did not create one. Consecutive failures with the
+// same inputs are counted, to back off their retries.
+func setLastFailure(mg *unstructured.Unstructured, failed *failedUpgrade, inputs string, cause error, now time.Time) error {
+	attempts := int64(1)
+	if previous, _, _ := unstructured.NestedString(mg.Object, "status", "lastFailedInputs"); previous == inputs {
+		count, _, _ := unstructured.NestedInt64(mg.Object, "status", "failedAttempts")
+		attempts = count + 1
+	}
+	fields := map[string]any{
+		"lastFailedChartVersion": failed.chartVersion,
+		"lastFailedInputs":       inputs,
+		"failedAttempts":         attempts,
+		"lastFailureMessage":     cause.Error(),
+		"lastFailureTime":        now.UTC().Format(time.RFC3339),
+	}
+	if failed.revision > 0 {
+		fields["lastFailedRevision"] = int64(failed.revision)
+	} else {
+		unstructured.RemoveNestedField(mg.Object, "status", "lastFailedRevision")
+	}
+	for k, v := range fields {
+		err := unstructured.SetNestedField(mg.Object, v, "status", k)
+		if err != nil {
+			return fmt.Errorf("setting %s in status: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// clearFailedAttempts forgets the consecutive failures once an upgrade succeeds, the last failure is kept.
+func clearFailedAttempts(mg *unstructured.Unstructured) {
+	unstructured.RemoveNestedField(mg.Object, "status", "lastFailedInputs")
+	unstructured.RemoveNestedField(mg.Object, "status", "failedAttempts")
+}
+
+// upgradeInputs hashes what an upgrade is performed with: the spec, the chart and the values.
+func upgradeInputs(mg *unstructured.Unstructured, pkg *archive.Info, actionConfig *helmconfig.ActionConfig) (string, error) {
+	h := hasher.NewFNVObjectHash()
+	err := h.SumHash(mg.GetGeneration(), pkg.URL, pkg.Version, pkg.Repo, actionConfig.Values)
+	if err != nil {
+		return "", err
+	}
+	return h.GetHash(), nil
+}
+
+// retryAt returns when the failed upgrade recorded in the status may be retried with the given inputs.
+// Changed inputs are retried right away, otherwise the delay doubles with every consecutive failure,
+// from the failed upgrade retry backoff up to its maximum.
+func retryAt(mg *unstructured.Unstructured, inputs string) time.Time {
+	previous, _, _ := unstructured.NestedString(mg.Object, "status", "lastFailedInputs")
+	if previous == "" || previous != inputs || failedRetryBackoff <= 0 {
+		return time.Time{}
+	}
+	ts, _, _ := unstructured.NestedString(mg.Object, "status", "lastFailureTime")
+	failedAt, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return time.Time{}
+	}
+	attempts, _, _ := unstructured.NestedInt64(mg.Object, "status", "failedAttempts")
+	backoff := failedRetryBackoff
+	for i := int64(1); i < attempts && backoff < failedRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return failedAt.Add(min(backoff, max(failedRetryMaxBackoff, failedRetryBackoff)))
+}
+
+// deferToRetryBackoff reports whether the upgrade must wait for the backoff of the previous failed upgrade.
+func (h *handler) deferToRetryBackoff(log logging.Logger, mg *unstructured.Unstructured, pkg *archive.Info, actionConfig *helmconfig.ActionConfig, now time.Time) (bool, error) {
+	inputs, err := upgradeInputs(mg, pkg, actionConfig)
+	if err != nil {
+		return false, fmt.Errorf("computing upgrade inputs: %w", err)
+	}
+	at := retryAt(mg, inputs)
+	if !now.Before(at) {
+		return false, nil
+	}
+	log.Debug("Composition upgrade retry deferred after a failed upgrade with the same inputs.", "retryAt", at.UTC().Format(time.RFC3339))
+	return true, nil
+}
+
+// observeFailedRelease observes a release whose last install or upgrade failed (e.g. its resources did not
+// become ready in time): the upgrade is retried unless it waits for the dependencies, the maintenance window,
+// the backoff of the failure or the rollout of a new chart version, which may have been halted by this very failure.
+func (h *handler) observeFailedRelease(ctx context.Context, log logging.Logger, dyn dynamic.Interface, mg *unstructured.Unstructured, pkg *archive.Info, rel *helmconfig.Release, updateOpts tools.UpdateOptions) (controller.ExternalObservation, error) {
+	log.Debug("Composition release failed, upgrade needed.", "revision", rel.Revision)
+	waiting, err := h.deferToDependencies(ctx, dyn, mg, updateOpts)
+	if err != nil {
+		return controller.ExternalObservation{}, err
+	}
+	if waiting {
+		log.Debug("Composition upgrade deferred until its dependencies are available.")
+		return controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: true,
+		}, nil
+	}
+	deferred, err := deferToMaintenanceWindow(ctx, mg, pkg, updateOpts)
+	if err != nil {
+		return controller.ExternalObservation{}, err
+	}
+	if deferred {
+		return controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: true,
+		}, nil
+	}
+
+	actionConfig, err := h.buildActionConfig(ctx, dyn, mg, pkg)
+	if err != nil {
+		return controller.ExternalObservation{}, err
+	}
+	deferred, err = h.deferToRetryBackoff(log, mg, pkg, actionConfig, time.Now())
+	if err != nil {
+		return controller.ExternalObservation{}, err
+	}
+	if deferred {
+		return controller.ExternalObservation{
+			ResourceExists:   true,
+			ResourceUpToDate: true,
+		}, nil
+	}
+
+	// Retrying an install or an upgrade within the deployed chart version is not part of a rollout
+	deployed, _, _ := unstructured.NestedString(mg.Object, "status", "helmChartVersion")
+	if deployed != "" && pkg.Version != deployed {
+		deferred, err = h.deferToRollout(ctx, log, dyn, mg, pkg, pkg.Version, updateOpts)
+		if err != nil {
+			return controller.ExternalObservation{}, err
+		}
+	}
+	return controller.ExternalObservation{
+		ResourceExists:   true,
+		ResourceUpToDate: deferred,
+	}, nil
+}
+
+// rollbackRequest is a rollback requested with the rollback-to-revision annotation that has been performed.
+// It is stored under 'status.rollback' together with the generation of the composition at that time,
+// so that upgrades can be resumed as soon as the spec changes.
+type rollbackRequest struct {
+	Revision   int   `json:"revision"`
+	Generation int64 `json:"generation"`
+}
+
+func getRollbackRequest(mg *unstructured.Unstructured) *rollbackRequest {
+	m, ok, err := unstructured.NestedMap(mg.Object, "status", "rollback")
+	if err != nil || !ok {
+		return nil
+	}
+	var req rollbackRequest
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(m, &req)
+	if err != nil {
+		return nil
+	}
+	return &req
+}
+
+func setRollbackRequest(mg *unstructured.Unstructured, req *rollbackRequest) error {
+	if req == nil {
+		unstructured.RemoveNestedField(mg.Object, "status", "rollback")
+		return nil
+	}
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(req)
+	if err != nil {
+		return fmt.Errorf("converting rollback request: %w", err)
+	}
+	return unstructured.SetNestedMap(mg.Object, m, "status", "rollback")
+}
+
+// rollbackAction is what the handler has to do about the rollback-to-revision annotation.
+type rollbackAction int
+
+const (
+	// rollbackNone means no rollback has been requested, upgrades proceed as usual.
+	rollbackNone rollbackAction = iota
+	// rollbackPerform means the release has to be rolled back to the requested revision.
+	rollbackPerform
+	// rollbackPaused means the requested rollback has been performed and upgrades are paused.
+	rollbackPaused
+	// rollbackResume means the rollback has been performed, but the annotation has been removed
+	// or the spec has changed since then, so upgrades must be resumed.
+	rollbackResume
+)
+
+// getRollbackAction compares the rollback-to-revision annotation with the rollback recorded in the status.
+func getRollbackAction(mg *unstructured.Unstructured) (rollbackAction, int) {
+	requested, ok := compositionMeta.GetRollbackToRevision(mg)
+	current := getRollbackRequest(mg)
+
+	switch {
+	case !ok && current == nil:
+		return rollbackNone, 0
+	case !ok:
+		return rollbackResume, 0
+	case current == nil || current.Revision != requested:
+		return rollbackPerform, requested
+	case current.Generation != mg.GetGeneration():
+		return rollbackResume, requested
+	}
+	return rollbackPaused, requested
+}
+
+// rollbackToRevision rolls the release back to the revision requested with the rollback-to-revision annotation
+// and records the result in the RolledBack condition of the composition and in an event.
+func (h *handler) rollbackToRevision(ctx context.Context, hc helmconfig.Client, mg *unstructured.Unstructured, releaseName string, revision int, wait waitOptions) error {
+	rel, err := hc.Rollback(ctx, releaseName, &helmconfig.RollbackConfig{
+		ReleaseVersion: revision,
+		MaxHistory:     helmMaxHistory,
+		Wait:           wait.enabled,
+		WaitForJobs:    wait.enabled,
+		Timeout:        wait.timeout,
+		CleanupOnFail:  true,
+	})
+	if err != nil {
+		retErr := fmt.Errorf("rolling back release to revision %d: %w", revision, err)
+		err = setConditionMessage(mg, compositionCondition.RollbackFailed(), retErr.Error())
+		if err != nil {
+			return err
+		}
+		h.eventRecorder.Event(mg, event.Warning(reasonRollbackFailed, "Observe", retErr))
+		return retErr
+	}
+
+	err = setRollbackRequest(mg, &rollbackRequest{Revision: revision, Generation: mg.GetGeneration()})
+	if err != nil {
+		return fmt.Errorf("setting rollback in status: %w", err)
+	}
+	err = setConditionMessage(mg, compositionCondition.RolledBack(),
+		fmt.Sprintf("Rolled back to revision %d, upgrades are paused until the %s annotation is removed or the spec changes", revision, compositionMeta.AnnotationKeyRollbackToRevision))
+	if err != nil {
+		return err
+	}
+
+	if rel != nil {
+		all, _, err := processor.DecodeMinRelease(rel)
+		if err != nil {
+			return fmt.Errorf("decoding release: %w", err)
+		}
+		managed, err := h.populateManagedResources(all)
+		if err != nil {
+			return fmt.Errorf("populating managed resources: %w", err)
+		}
+		setManagedResources(mg, managed)
+	}
+
+	h.eventRecorder.Event(mg, event.Normal(reasonRolledBackToRevision, "Observe", fmt.Sprintf("Rolled back to revision %d on request", revision)))
+	return nil
+}
+
+// clearRollback forgets the requested rollback, so that upgrades are resumed.
+func clearRollback(mg *unstructured.Unstructured) error {
+	err := setRollbackRequest(mg, nil)
+	if err != nil {
+		return err
+	}
+	return removeCondition(mg, compositionCondition.TypeRolledBack)
+}
@@ -0,0 +1,286 @@
+package composition
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rollout"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"github.com/krateoplatformops/plumbing/kubeutil/event"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/logging"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/release"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/events"
+)
+
+// fakeHelmClient serves a fixed release and records rollbacks.
+type fakeHelmClient struct {
+	helmconfig.Client
+	release   *helmconfig.Release
+	rollbacks []*helmconfig.RollbackConfig
+}
+
+func (f *fakeHelmClient) GetRelease(_ context.Context, _ string, _ *helmconfig.GetConfig) (*helmconfig.Release, error) {
+	return f.release, nil
+}
+
+func (f *fakeHelmClient) Rollback(_ context.Context, _ string, cfg *helmconfig.RollbackConfig) (*helmconfig.Release, error) {
+	f.rollbacks = append(f.rollbacks, cfg)
+	return &helmconfig.Release{Revision: f.release.Revision + 1, Status: helmconfig.StatusDeployed}, nil
+}
+
+func TestRollbackFailedUpgrade(t *testing.T) {
+	previous := &helmconfig.Release{Revision: 3, ChartVersion: "1.0.0", Status: helmconfig.StatusFailed}
+	failedRevision := &helmconfig.Release{Revision: 4, ChartVersion: "1.1.0", Status: helmconfig.StatusFailed}
+
+	tests := []struct {
+		name     string
+		latest   *helmconfig.Release
+		releases []*release.Release
+		expected *failedUpgrade
+		wantErr  bool
+	}{
+		{
+			name:   "rolls back to the newest deployed revision",
+			latest: failedRevision,
+			releases: []*release.Release{
+				newRevision(4, "1.1.0", release.StatusFailed),
+				newRevision(3, "1.0.1", release.StatusFailed),
+				newRevision(2, "1.0.0", release.StatusDeployed),
+				newRevision(1, "0.9.0", release.StatusSuperseded),
+			},
+			expected: &failedUpgrade{revision: 4, chartVersion: "1.1.0", restored: 2},
+		},
+		{
+			name:   "no deployed revision",
+			latest: failedRevision,
+			releases: []*release.Release{
+				newRevision(4, "1.1.0", release.StatusFailed),
+				newRevision(3, "1.0.1", release.StatusFailed),
+			},
+			wantErr: true,
+		},
+		{name: "nothing to roll back without a new revision", latest: previous},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := &fakeHelmClient{release: tt.latest}
+			h := &handler{historyLister: &fakeHistoryLister{releases: tt.releases}}
+
+			failed, err := h.rollbackFailedUpgrade(context.Background(), hc, newComposition(), "demo", previous, waitOptions{})
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, failed)
+				assert.Empty(t, hc.rollbacks)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, failed)
+			if tt.expected == nil {
+				assert.Empty(t, hc.rollbacks)
+				return
+			}
+			require.Len(t, hc.rollbacks, 1)
+			assert.Equal(t, tt.expected.restored, hc.rollbacks[0].ReleaseVersion)
+		})
+	}
+}
+
+func TestSetLastFailure(t *testing.T) {
+	mg := newComposition()
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	err := setLastFailure(mg, &failedUpgrade{revision: 4, chartVersion: "1.1.0", restored: 3}, "inputs", errors.New("boom"), now)
+	require.NoError(t, err)
+
+	rev, _, _ := unstructured.NestedInt64(mg.Object, "status", "lastFailedRevision")
+	assert.Equal(t, int64(4), rev)
+	version, _, _ := unstructured.NestedString(mg.Object, "status", "lastFailedChartVersion")
+	assert.Equal(t, "1.1.0", version)
+	msg, _, _ := unstructured.NestedString(mg.Object, "status", "lastFailureMessage")
+	assert.Equal(t, "boom", msg)
+	ts, _, _ := unstructured.NestedString(mg.Object, "status", "lastFailureTime")
+	assert.Equal(t, "2024-05-01T10:00:00Z", ts)
+	attempts, _, _ := unstructured.NestedInt64(mg.Object, "status", "failedAttempts")
+	assert.Equal(t, int64(1), attempts)
+
+	// Consecutive failures are only counted while the inputs are unchanged
+	require.NoError(t, setLastFailure(mg, &failedUpgrade{chartVersion: "1.1.0"}, "inputs", errors.New("boom"), now))
+	attempts, _, _ = unstructured.NestedInt64(mg.Object, "status", "failedAttempts")
+	assert.Equal(t, int64(2), attempts)
+	require.NoError(t, setLastFailure(mg, &failedUpgrade{chartVersion: "1.1.0"}, "changed", errors.New("boom"), now))
+	attempts, _, _ = unstructured.NestedInt64(mg.Object, "status", "failedAttempts")
+	assert.Equal(t, int64(1), attempts)
+
+	clearFailedAttempts(mg)
+	_, ok, _ := unstructured.NestedInt64(mg.Object, "status", "failedAttempts")
+	assert.False(t, ok)
+	assert.True(t, retryAt(mg, "changed").IsZero())
+}
+
+func TestRetryAt(t *testing.T) {
+	failedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		attempts int64
+		inputs   string
+		expected time.Time
+	}{
+		{name: "first failure", attempts: 1, inputs: "inputs", expected: failedAt.Add(failedRetryBackoff)},
+		{name: "third failure", attempts: 3, inputs: "inputs", expected: failedAt.Add(4 * failedRetryBackoff)},
+		{name: "backoff capped", attempts: 20, inputs: "inputs", expected: failedAt.Add(failedRetryMaxBackoff)},
+		{name: "inputs changed", attempts: 3, inputs: "changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			require.NoError(t, setLastFailure(mg, &failedUpgrade{chartVersion: "1.1.0"}, "inputs", errors.New("boom"), failedAt))
+			require.NoError(t, unstructured.SetNestedField(mg.Object, tt.attempts, "status", "failedAttempts"))
+			assert.Equal(t, tt.expected, retryAt(mg, tt.inputs))
+		})
+	}
+}
+
+func TestAtomicEnabled(t *testing.T) {
+	mg := newComposition()
+	assert.False(t, atomicEnabled(mg, &archive.Info{}))
+	assert.True(t, atomicEnabled(mg, &archive.Info{Atomic: true}))
+
+	mg.SetAnnotations(map[string]string{compositionMeta.AnnotationKeyAtomic: "false"})
+	assert.False(t, atomicEnabled(mg, &archive.Info{Atomic: true}))
+}
+
+func TestGetRollbackAction(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotation  string
+		status      *rollbackRequest
+		generation  int64
+		expected    rollbackAction
+		expectedRev int
+	}{
+		{name: "no rollback", expected: rollbackNone},
+		{name: "new request", annotation: "2", generation: 1, expected: rollbackPerform, expectedRev: 2},
+		{name: "already rolled back", annotation: "2", status: &rollbackRequest{Revision: 2, Generation: 1}, generation: 1, expected: rollbackPaused, expectedRev: 2},
+		{name: "different revision requested", annotation: "1", status: &rollbackRequest{Revision: 2, Generation: 1}, generation: 1, expected: rollbackPerform, expectedRev: 1},
+		{name: "spec changed", annotation: "2", status: &rollbackRequest{Revision: 2, Generation: 1}, generation: 2, expected: rollbackResume, expectedRev: 2},
+		{name: "annotation removed", status: &rollbackRequest{Revision: 2, Generation: 1}, generation: 1, expected: rollbackResume},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			mg.SetGeneration(tt.generation)
+			if tt.annotation != "" {
+				mg.SetAnnotations(map[string]string{compositionMeta.AnnotationKeyRollbackToRevision: tt.annotation})
+			}
+			require.NoError(t, setRollbackRequest(mg, tt.status))
+
+			action, rev := getRollbackAction(mg)
+			assert.Equal(t, tt.expected, action)
+			assert.Equal(t, tt.expectedRev, rev)
+		})
+	}
+}
+
+func TestClearRollback(t *testing.T) {
+	mg := newComposition()
+	require.NoError(t, setRollbackRequest(mg, &rollbackRequest{Revision: 2, Generation: 1}))
+	require.NoError(t, setConditionMessage(mg, compositionCondition.RolledBack(), "rolled back"))
+	require.NoError(t, setConditionMessage(mg, compositionCondition.NotDrifted(), "No drift detected"))
+
+	require.NoError(t, clearRollback(mg))
+
+	assert.Nil(t, getRollbackRequest(mg))
+	assert.Nil(t, unstructuredtools.GetCondition(mg, compositionCondition.TypeRolledBack, compositionCondition.ReasonRolledBack))
+	assert.NotNil(t, unstructuredtools.GetCondition(mg, compositionCondition.TypeDrifted, compositionCondition.ReasonNoDrift))
+}
+
+func TestObserveFailedRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		deployed    string
+		maxFailures int
+		upToDate    bool
+		halted      bool
+	}{
+		{name: "rollout halted by the failure", deployed: "1.0.0", maxFailures: 1, upToDate: true, halted: true},
+		{name: "rollout still admitting upgrades", deployed: "1.0.0", maxFailures: 2},
+		{name: "failure within the deployed chart version", deployed: "2.0.0", maxFailures: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newRolloutComposition("failed", tt.deployed, false)
+			mg.Object["spec"] = map[string]any{}
+			require.NoError(t, unstructured.SetNestedField(mg.Object, "2.0.0", "status", "lastFailedChartVersion"))
+			dyn := newDependencyClient(mg.DeepCopy(), newRolloutComposition("updated", "2.0.0", true))
+
+			h := newDependencyHandler()
+			h.rollouts = rollout.NewTracker(time.Minute)
+			h.eventRecorder = *event.NewAPIRecorder(events.NewFakeRecorder(10))
+			pkg := &archive.Info{
+				Version: "2.0.0",
+				Rollout: &rollout.Policy{MaxFailures: tt.maxFailures},
+				CompositionDefinitionInfo: &archive.CompositionDefinitionInfo{
+					Name:      "demo",
+					Namespace: "krateo-system",
+				},
+			}
+			updateOpts := tools.UpdateOptions{Pluralizer: h.pluralizer, DynamicClient: dyn}
+
+			obs, err := h.observeFailedRelease(context.Background(), logging.NewNopLogger(), dyn, mg, pkg,
+				&helmconfig.Release{Revision: 3, Status: helmconfig.StatusFailed}, updateOpts)
+			require.NoError(t, err)
+			assert.True(t, obs.ResourceExists)
+			assert.Equal(t, tt.upToDate, obs.ResourceUpToDate)
+			halted := unstructuredtools.GetCondition(mg, compositionCondition.TypeUpgradePending, compositionCondition.ReasonRolloutHalted)
+			assert.Equal(t, tt.halted, halted != nil)
+		})
+	}
+}
+
+func TestObserveFailedReleaseBackoff(t *testing.T) {
+	mg := newComposition()
+	mg.Object["spec"] = map[string]any{"replicas": int64(1)}
+	dyn := newDependencyClient(mg.DeepCopy())
+	h := newDependencyHandler()
+	pkg := &archive.Info{URL: "oci://example.com/charts/demo", Version: "1.0.0"}
+	rel := &helmconfig.Release{Revision: 2, Status: helmconfig.StatusFailed}
+	updateOpts := tools.UpdateOptions{Pluralizer: h.pluralizer, DynamicClient: dyn}
+	observe := func() bool {
+		obs, err := h.observeFailedRelease(context.Background(), logging.NewNopLogger(), dyn, mg, pkg, rel, updateOpts)
+		require.NoError(t, err)
+		return obs.ResourceUpToDate
+	}
+
+	// Failed install, never retried with these inputs yet
+	assert.False(t, observe())
+
+	actionConfig, err := h.buildActionConfig(context.Background(), dyn, mg, pkg)
+	require.NoError(t, err)
+	inputs, err := upgradeInputs(mg, pkg, actionConfig)
+	require.NoError(t, err)
+	require.NoError(t, setLastFailure(mg, &failedUpgrade{revision: 2, chartVersion: "1.0.0"}, inputs, errors.New("timed out"), time.Now()))
+
+	// Unchanged failed release, not retried on consecutive observes
+	assert.True(t, observe())
+	assert.True(t, observe())
+
+	// A change of the spec is retried right away
+	mg.Object["spec"] = map[string]any{"replicas": int64(2)}
+	mg.SetGeneration(2)
+	assert.False(t, observe())
+}
@@ -0,0 +1,139 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rollout"
+	"github.com/krateoplatformops/plumbing/kubeutil/event"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/logging"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+)
+
+// rolloutTrackerTTL is how long an admitted upgrade is considered in flight if its completion is never reported.
+const rolloutTrackerTTL = 30 * time.Minute
+
+// admitRollout decides whether the composition may be upgraded to the target chart version,
+// according to the rollout policy of its definition and to the state of the other compositions of the definition.
+func (h *handler) admitRollout(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, pkg *archive.Info, target string) (rollout.Progress, rollout.Decision, error) {
+	if h.rollouts == nil || pkg == nil || !pkg.Rollout.Enabled() || pkg.CompositionDefinitionInfo == nil {
+		return rollout.Progress{}, rollout.Admit, nil
+	}
+
+	gvr, err := h.pluralizer.GVKtoGVR(mg.GroupVersionKind())
+	if err != nil {
+		return rollout.Progress{}, rollout.Admit, fmt.Errorf("converting GVK to GVR: %w", err)
+	}
+	selector := labels.SelectorFromSet(labels.Set{
+		compositionMeta.CompositionDefinitionNameLabel:      pkg.CompositionDefinitionInfo.Name,
+		compositionMeta.CompositionDefinitionNamespaceLabel: pkg.CompositionDefinitionInfo.Namespace,
+	})
+	list, err := dyn.Resource(gvr).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return rollout.Progress{}, rollout.Admit, fmt.Errorf("listing compositions of definition %s/%s: %w",
+			pkg.CompositionDefinitionInfo.Namespace, pkg.CompositionDefinitionInfo.Name, err)
+	}
+
+	members := make([]rollout.Member, 0, len(list.Items))
+	for i := range list.Items {
+		members = append(members, rolloutMember(&list.Items[i]))
+	}
+
+	key := pkg.CompositionDefinitionInfo.Namespace + "/" + pkg.CompositionDefinitionInfo.Name
+	progress, decision := h.rollouts.Admit(key, string(mg.GetUID()), target, members, *pkg.Rollout)
+	return progress, decision, nil
+}
+
+// deferToRollout admits the upgrade of the composition to the target chart version, or publishes the progress
+// of the rollout in the composition status when the upgrade must wait or the rollout is halted.
+// It returns whether the upgrade has been deferred.
+func (h *handler) deferToRollout(ctx context.Context, log logging.Logger, dyn dynamic.Interface, mg *unstructured.Unstructured, pkg *archive.Info, target string, updateOpts tools.UpdateOptions) (bool, error) {
+	progress, decision, err := h.admitRollout(ctx, dyn, mg, pkg, target)
+	if err != nil {
+		return false, fmt.Errorf("checking rollout: %w", err)
+	}
+	if decision == rollout.Admit {
+		return false, nil
+	}
+
+	log.Debug("Composition chart version upgrade deferred by rollout.", "version", target,
+		"updated", progress.Updated, "upgrading", progress.Upgrading, "failed", progress.Failed, "total", progress.Total)
+	alreadyHalted := unstructuredtools.GetCondition(mg, compositionCondition.TypeUpgradePending, compositionCondition.ReasonRolloutHalted) != nil
+	err = setRolloutPending(mg, progress, decision, pkg.Rollout)
+	if err != nil {
+		return false, fmt.Errorf("setting rollout status: %w", err)
+	}
+	if decision == rollout.Halt && !alreadyHalted {
+		h.eventRecorder.Event(mg, event.Warning(reasonRolloutHalted, "Observe",
+			fmt.Errorf("rollout of chart version %s halted after %d failed upgrade(s)", progress.ChartVersion, progress.Failed)))
+	}
+	_, err = tools.UpdateStatus(ctx, mg, updateOpts)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// rolloutDone reports the completion of the upgrade of the composition, if it was admitted by a rollout:
+// either its resources are healthy or the upgrade failed.
+func (h *handler) rolloutDone(mg *unstructured.Unstructured) {
+	if h.rollouts == nil {
+		return
+	}
+	h.rollouts.Done(string(mg.GetUID()))
+}
+
+func rolloutMember(mg *unstructured.Unstructured) rollout.Member {
+	version, _, _ := unstructured.NestedString(mg.Object, "status", "helmChartVersion")
+	failed, _, _ := unstructured.NestedString(mg.Object, "status", "lastFailedChartVersion")
+
+	// Ready alone is set as soon as an upgrade that did not wait returns, the health of the
+	// resources is only known once evaluated, so a composition is available when both hold
+	ready, healthy := false, false
+	for _, c := range unstructuredtools.GetConditions(mg) {
+		switch c.Type {
+		case condition.TypeReady:
+			ready = c.Status == metav1.ConditionTrue
+		case compositionCondition.TypeResourcesHealthy:
+			healthy = c.Status == metav1.ConditionTrue
+		}
+	}
+
+	return rollout.Member{
+		UID:                string(mg.GetUID()),
+		ChartVersion:       version,
+		Available:          ready && healthy,
+		FailedChartVersion: failed,
+	}
+}
+
+// setRolloutPending publishes the rollout progress under 'status.rollout' and marks the upgrade as pending.
+func setRolloutPending(mg *unstructured.Unstructured, progress rollout.Progress, decision rollout.Decision, policy *rollout.Policy) error {
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&progress)
+	if err != nil {
+		return fmt.Errorf("converting rollout progress: %w", err)
+	}
+	err = unstructured.SetNestedMap(mg.Object, m, "status", "rollout")
+	if err != nil {
+		return fmt.Errorf("setting rollout in status: %w", err)
+	}
+
+	if decision == rollout.Halt {
+		return setConditionMessage(mg, compositionCondition.RolloutHalted(),
+			fmt.Sprintf("Rollout of chart version %s halted after %d failed upgrade(s) (max %d)", progress.ChartVersion, progress.Failed, policy.MaxFailures))
+	}
+	return setConditionMessage(mg, compositionCondition.RolloutThrottled(),
+		fmt.Sprintf("Waiting for rollout of chart version %s: %d/%d updated, %d upgrading (max %d)", progress.ChartVersion, progress.Updated, progress.Total, progress.Upgrading, policy.MaxUnavailable))
+}
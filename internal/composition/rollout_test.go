@@ -0,0 +1,114 @@
+package composition
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rollout"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newRolloutComposition(name, chartVersion string, ready bool) *unstructured.Unstructured {
+	mg := newComposition()
+	mg.SetName(name)
+	mg.SetUID(types.UID(name))
+	mg.SetLabels(map[string]string{
+		compositionMeta.CompositionDefinitionNameLabel:      "demo",
+		compositionMeta.CompositionDefinitionNamespaceLabel: "krateo-system",
+	})
+	_ = unstructured.SetNestedField(mg.Object, chartVersion, "status", "helmChartVersion")
+	if ready {
+		_ = unstructuredtools.SetConditions(mg, condition.Available(), compositionCondition.ResourcesHealthy())
+	} else {
+		_ = unstructuredtools.SetConditions(mg, condition.Unavailable())
+	}
+	return mg
+}
+
+func TestRolloutMember(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		available  bool
+	}{
+		{name: "ready and healthy", conditions: []metav1.Condition{condition.Available(), compositionCondition.ResourcesHealthy()}, available: true},
+		{name: "ready, health not evaluated since the upgrade", conditions: []metav1.Condition{condition.Available()}},
+		{name: "ready but unhealthy", conditions: []metav1.Condition{condition.Available(), compositionCondition.ResourcesUnhealthy()}},
+		{name: "not ready", conditions: []metav1.Condition{condition.Unavailable(), compositionCondition.ResourcesHealthy()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			require.NoError(t, unstructuredtools.SetConditions(mg, tt.conditions...))
+			assert.Equal(t, tt.available, rolloutMember(mg).Available)
+		})
+	}
+}
+
+func TestAdmitRollout(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "demos"}
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "DemoList"},
+		newRolloutComposition("updated-not-ready", "2.0.0", false),
+		newRolloutComposition("old-1", "1.0.0", true),
+		newRolloutComposition("old-2", "1.0.0", true),
+	)
+
+	h := &handler{
+		pluralizer: &mockPluralizer{
+			gvrMap: map[schema.GroupVersionKind]schema.GroupVersionResource{
+				{Group: "composition.krateo.io", Version: "v1", Kind: "Demo"}: gvr,
+			},
+		},
+		rollouts: rollout.NewTracker(time.Minute),
+	}
+	pkg := &archive.Info{
+		Rollout: &rollout.Policy{MaxUnavailable: 2},
+		CompositionDefinitionInfo: &archive.CompositionDefinitionInfo{
+			Name:      "demo",
+			Namespace: "krateo-system",
+		},
+	}
+
+	progress, decision, err := h.admitRollout(context.Background(), dyn, newRolloutComposition("old-1", "1.0.0", true), pkg, "2.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, rollout.Admit, decision)
+	assert.Equal(t, 3, progress.Total)
+	assert.Equal(t, 2, progress.Upgrading)
+
+	mg := newRolloutComposition("old-2", "1.0.0", true)
+	progress, decision, err = h.admitRollout(context.Background(), dyn, mg, pkg, "2.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, rollout.Throttle, decision)
+
+	require.NoError(t, setRolloutPending(mg, progress, decision, pkg.Rollout))
+	cond := unstructuredtools.GetCondition(mg, compositionCondition.TypeUpgradePending, compositionCondition.ReasonRolloutThrottled)
+	require.NotNil(t, cond)
+	assert.Equal(t, "Waiting for rollout of chart version 2.0.0: 1/3 updated, 2 upgrading (max 2)", cond.Message)
+	_, ok, _ := unstructured.NestedMap(mg.Object, "status", "rollout")
+	assert.True(t, ok)
+
+	require.NoError(t, clearUpgradePending(mg))
+	assert.Nil(t, unstructuredtools.GetCondition(mg, compositionCondition.TypeUpgradePending, compositionCondition.ReasonRolloutThrottled))
+	_, ok, _ = unstructured.NestedMap(mg.Object, "status", "rollout")
+	assert.False(t, ok)
+
+	// Without a policy every upgrade is admitted
+	_, decision, err = h.admitRollout(context.Background(), dyn, mg, &archive.Info{}, "2.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, rollout.Admit, decision)
+}
@@ -0,0 +1,88 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Phase is the step of the reconciliation a composition is at, published under 'status.phase'.
+type Phase string
+
+const (
+	PhaseResolvingChart Phase = "ResolvingChart"
+	PhaseGeneratingRBAC Phase = "GeneratingRBAC"
+	PhaseInstalling     Phase = "Installing"
+	PhaseUpgrading      Phase = "Upgrading"
+	PhaseReady          Phase = "Ready"
+	PhaseFailed         Phase = "Failed"
+	PhasePaused         Phase = "Paused"
+	PhaseDeleting       Phase = "Deleting"
+)
+
+// succeeded reports whether the reconciliation ending in the phase succeeded.
+func (p Phase) succeeded() bool {
+	return p == PhaseReady || p == PhasePaused
+}
+
+func getPhase(mg *unstructured.Unstructured) Phase {
+	phase, _, _ := unstructured.NestedString(mg.Object, "status", "phase")
+	return Phase(phase)
+}
+
+// setReconcileStatus records the phase of the reconciliation together with the generation of the composition
+// it observed and when it happened, so that a stale status can be told from a current one.
+// Successful reconciliations are also recorded under 'status.lastSuccessfulReconcileTime'.
+func setReconcileStatus(mg *unstructured.Unstructured, phase Phase, now time.Time) error {
+	ts := now.UTC().Format(time.RFC3339)
+	fields := map[string]any{
+		"phase":              string(phase),
+		"observedGeneration": mg.GetGeneration(),
+		"lastReconcileTime":  ts,
+	}
+	if phase.succeeded() {
+		fields["lastSuccessfulReconcileTime"] = ts
+	}
+	for k, v := range fields {
+		err := unstructured.SetNestedField(mg.Object, v, "status", k)
+		if err != nil {
+			return fmt.Errorf("setting %s in status: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// convergingPhase returns the phase of a release that is deployed but whose resources are not healthy yet:
+// an install or upgrade that did not wait for them keeps converging, otherwise the composition has failed.
+func convergingPhase(mg *unstructured.Unstructured) Phase {
+	switch phase := getPhase(mg); phase {
+	case PhaseInstalling, PhaseUpgrading:
+		return phase
+	}
+	return PhaseFailed
+}
+
+// updatePhase records the phase of the reconciliation and updates the status of the composition.
+func updatePhase(ctx context.Context, mg *unstructured.Unstructured, phase Phase, updateOpts tools.UpdateOptions) (*unstructured.Unstructured, error) {
+	err := setReconcileStatus(mg, phase, time.Now())
+	if err != nil {
+		return mg, err
+	}
+	res, err := tools.UpdateStatus(ctx, mg, updateOpts)
+	if err != nil {
+		return mg, fmt.Errorf("updating status: %w", err)
+	}
+	return res, nil
+}
+
+// installedPhase returns the phase reached once an install or upgrade succeeds: when Helm waited for the
+// resources the composition is ready, otherwise it keeps converging until Observe finds the resources healthy.
+func installedPhase(wait waitOptions, converging Phase) Phase {
+	if wait.enabled {
+		return PhaseReady
+	}
+	return converging
+}
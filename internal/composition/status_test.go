@@ -0,0 +1,73 @@
+package composition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSetReconcileStatus(t *testing.T) {
+	first := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	second := first.Add(time.Minute)
+
+	tests := []struct {
+		name           string
+		phase          Phase
+		lastSuccessful string
+	}{
+		{name: "ready", phase: PhaseReady, lastSuccessful: "2025-03-01T10:01:00Z"},
+		{name: "paused", phase: PhasePaused, lastSuccessful: "2025-03-01T10:01:00Z"},
+		{name: "failed", phase: PhaseFailed, lastSuccessful: "2025-03-01T10:00:00Z"},
+		{name: "installing", phase: PhaseInstalling, lastSuccessful: "2025-03-01T10:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			mg.SetGeneration(3)
+			require.NoError(t, setReconcileStatus(mg, PhaseReady, first))
+
+			mg.SetGeneration(4)
+			require.NoError(t, setReconcileStatus(mg, tt.phase, second.In(time.FixedZone("CET", 3600))))
+
+			assert.Equal(t, tt.phase, getPhase(mg))
+			generation, _, _ := unstructured.NestedInt64(mg.Object, "status", "observedGeneration")
+			assert.Equal(t, int64(4), generation)
+			last, _, _ := unstructured.NestedString(mg.Object, "status", "lastReconcileTime")
+			assert.Equal(t, "2025-03-01T10:01:00Z", last)
+			lastSuccessful, _, _ := unstructured.NestedString(mg.Object, "status", "lastSuccessfulReconcileTime")
+			assert.Equal(t, tt.lastSuccessful, lastSuccessful)
+		})
+	}
+}
+
+func TestConvergingPhase(t *testing.T) {
+	tests := []struct {
+		current Phase
+		want    Phase
+	}{
+		{current: "", want: PhaseFailed},
+		{current: PhaseInstalling, want: PhaseInstalling},
+		{current: PhaseUpgrading, want: PhaseUpgrading},
+		{current: PhaseReady, want: PhaseFailed},
+		{current: PhaseFailed, want: PhaseFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.current), func(t *testing.T) {
+			mg := newComposition()
+			if tt.current != "" {
+				require.NoError(t, unstructured.SetNestedField(mg.Object, string(tt.current), "status", "phase"))
+			}
+			assert.Equal(t, tt.want, convergingPhase(mg))
+		})
+	}
+}
+
+func TestInstalledPhase(t *testing.T) {
+	assert.Equal(t, PhaseReady, installedPhase(waitOptions{enabled: true}, PhaseUpgrading))
+	assert.Equal(t, PhaseUpgrading, installedPhase(waitOptions{}, PhaseUpgrading))
+}
@@ -0,0 +1,110 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// reconcileSteps are the types of the conditions reporting the outcome of each step
+// of the reconciliation, in the order the steps run.
+var reconcileSteps = []string{
+	compositionCondition.TypeChartResolved,
+	compositionCondition.TypeRBACReady,
+	compositionCondition.TypeReleaseDeployed,
+	compositionCondition.TypeResourcesHealthy,
+}
+
+// failedStep returns the condition of the first step of the reconciliation that failed, if any.
+// Steps not run yet are not reported and never count as failed.
+func failedStep(mg *unstructured.Unstructured) *metav1.Condition {
+	conditions := unstructuredtools.GetConditions(mg)
+	for _, t := range reconcileSteps {
+		for i := range conditions {
+			if conditions[i].Type == t && conditions[i].Status == metav1.ConditionFalse {
+				return &conditions[i]
+			}
+		}
+	}
+	return nil
+}
+
+// setReady computes the Ready condition from the steps of the reconciliation. When a step failed,
+// Ready is False with the reason of the first failed step, so that alerting can key on it; otherwise
+// the given condition is set.
+func setReady(mg *unstructured.Unstructured, cond metav1.Condition, message string, force bool) error {
+	if step := failedStep(mg); step != nil {
+		cond = condition.Unavailable()
+		cond.Reason = step.Reason
+	}
+	if !force {
+		return setConditionMessage(mg, cond, message)
+	}
+	cond.Message = message
+	err := unstructuredtools.SetConditions(mg, cond)
+	if err != nil {
+		return fmt.Errorf("setting condition: %w", err)
+	}
+	return nil
+}
+
+// setStepFailed records the failure of a step of the reconciliation and marks the composition as not ready.
+func setStepFailed(mg *unstructured.Unstructured, cond metav1.Condition, message string) error {
+	err := setConditionMessage(mg, cond, message)
+	if err != nil {
+		return err
+	}
+	return setReady(mg, condition.Unavailable(), message, true)
+}
+
+// setDeployFailed records the failure of an install or upgrade. The composition is marked as not ready,
+// unless Helm waited for the resources of the release and it has already been marked as Failed listing them.
+func setDeployFailed(mg *unstructured.Unstructured, cond metav1.Condition, message string, waitFailed bool) error {
+	if waitFailed {
+		return setConditionMessage(mg, cond, message)
+	}
+	return setStepFailed(mg, cond, message)
+}
+
+// setDeployedResourcesHealth records the health of the resources of a release just installed or upgraded.
+// When Helm waited for them they are ready, otherwise their health is unknown until the next observation.
+func setDeployedResourcesHealth(mg *unstructured.Unstructured, wait waitOptions) error {
+	if wait.enabled {
+		_, err := setResourcesHealth(mg, nil)
+		return err
+	}
+	return removeCondition(mg, compositionCondition.TypeResourcesHealthy)
+}
+
+// updateStepFailed records the failure of a step of the reconciliation together with the phase
+// it happened in, and updates the status of the composition.
+func updateStepFailed(ctx context.Context, mg *unstructured.Unstructured, cond metav1.Condition, phase Phase, cause error, updateOpts tools.UpdateOptions) (*unstructured.Unstructured, error) {
+	err := setStepFailed(mg, cond, cause.Error())
+	if err != nil {
+		return mg, err
+	}
+	return updatePhase(ctx, mg, phase, updateOpts)
+}
+
+func setChartResolved(mg *unstructured.Unstructured, pkg *archive.Info) error {
+	return setConditionMessage(mg, compositionCondition.ChartResolved(),
+		fmt.Sprintf("Chart %s version %s resolved", pkg.URL, pkg.Version))
+}
+
+func setRBACReady(mg *unstructured.Unstructured) error {
+	return setConditionMessage(mg, compositionCondition.RBACReady(), "RBAC policy of the release applied")
+}
+
+func setReleaseDeployed(mg *unstructured.Unstructured, rel *helmconfig.Release) error {
+	return setConditionMessage(mg, compositionCondition.ReleaseDeployed(),
+		fmt.Sprintf("Release %s revision %d deployed with chart version %s", rel.Name, rel.Revision, rel.ChartVersion))
+}
@@ -0,0 +1,120 @@
+package composition
+
+import (
+	"testing"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
+	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func readyCondition(t *testing.T, conditions []metav1.Condition) metav1.Condition {
+	t.Helper()
+	for _, c := range conditions {
+		if c.Type == condition.TypeReady {
+			return c
+		}
+	}
+	require.Fail(t, "Ready condition not found")
+	return metav1.Condition{}
+}
+
+func TestSetReady(t *testing.T) {
+	tests := []struct {
+		name   string
+		steps  []metav1.Condition
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{
+			name:   "no step reported",
+			status: metav1.ConditionTrue,
+			reason: condition.ReasonAvailable,
+		},
+		{
+			name:   "every step succeeded",
+			steps:  []metav1.Condition{compositionCondition.ChartResolved(), compositionCondition.RBACReady(), compositionCondition.ReleaseDeployed(), compositionCondition.ResourcesHealthy()},
+			status: metav1.ConditionTrue,
+			reason: condition.ReasonAvailable,
+		},
+		{
+			name:   "resources unhealthy",
+			steps:  []metav1.Condition{compositionCondition.ChartResolved(), compositionCondition.ReleaseDeployed(), compositionCondition.ResourcesUnhealthy()},
+			status: metav1.ConditionFalse,
+			reason: compositionCondition.ReasonResourcesUnhealthy,
+		},
+		{
+			name:   "first failed step wins",
+			steps:  []metav1.Condition{compositionCondition.ResourcesUnhealthy(), compositionCondition.UpgradeFailed(), compositionCondition.RBACApplyFailed()},
+			status: metav1.ConditionFalse,
+			reason: compositionCondition.ReasonRBACApplyFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			for _, step := range tt.steps {
+				require.NoError(t, unstructuredtools.SetConditions(mg, step))
+			}
+
+			require.NoError(t, setReady(mg, condition.Available(), "Composition is up-to-date", false))
+
+			ready := readyCondition(t, unstructuredtools.GetConditions(mg))
+			assert.Equal(t, tt.status, ready.Status)
+			assert.Equal(t, tt.reason, ready.Reason)
+			assert.Equal(t, "Composition is up-to-date", ready.Message)
+		})
+	}
+}
+
+func TestSetDeployFailed(t *testing.T) {
+	t.Run("marks the composition as not ready", func(t *testing.T) {
+		mg := newComposition()
+		require.NoError(t, setReady(mg, condition.Available(), "Composition created", true))
+
+		require.NoError(t, setDeployFailed(mg, compositionCondition.UpgradeFailed(), "upgrading helm chart: boom", false))
+
+		step := unstructuredtools.GetCondition(mg, compositionCondition.TypeReleaseDeployed, compositionCondition.ReasonUpgradeFailed)
+		require.NotNil(t, step)
+		assert.Equal(t, metav1.ConditionFalse, step.Status)
+		ready := readyCondition(t, unstructuredtools.GetConditions(mg))
+		assert.Equal(t, metav1.ConditionFalse, ready.Status)
+		assert.Equal(t, compositionCondition.ReasonUpgradeFailed, ready.Reason)
+		assert.Equal(t, "upgrading helm chart: boom", ready.Message)
+	})
+
+	t.Run("keeps the wait failure", func(t *testing.T) {
+		mg := newComposition()
+		require.NoError(t, setConditionMessage(mg, compositionCondition.Failed(), "Composition resources not ready after 5m0s"))
+
+		require.NoError(t, setDeployFailed(mg, compositionCondition.InstallFailed(), "installing helm chart: timed out", true))
+
+		require.NotNil(t, unstructuredtools.GetCondition(mg, compositionCondition.TypeReleaseDeployed, compositionCondition.ReasonInstallFailed))
+		ready := readyCondition(t, unstructuredtools.GetConditions(mg))
+		assert.Equal(t, compositionCondition.ReasonFailed, ready.Reason)
+		assert.Equal(t, "Composition resources not ready after 5m0s", ready.Message)
+	})
+}
+
+func TestSetDeployedResourcesHealth(t *testing.T) {
+	t.Run("waited", func(t *testing.T) {
+		mg := newComposition()
+		require.NoError(t, unstructuredtools.SetConditions(mg, compositionCondition.ResourcesUnhealthy()))
+
+		require.NoError(t, setDeployedResourcesHealth(mg, waitOptions{enabled: true}))
+		assert.NotNil(t, unstructuredtools.GetCondition(mg, compositionCondition.TypeResourcesHealthy, compositionCondition.ReasonResourcesHealthy))
+	})
+
+	t.Run("not waited", func(t *testing.T) {
+		mg := newComposition()
+		require.NoError(t, unstructuredtools.SetConditions(mg, compositionCondition.ResourcesUnhealthy()))
+
+		require.NoError(t, setDeployedResourcesHealth(mg, waitOptions{}))
+		assert.Nil(t, failedStep(mg))
+		assert.Nil(t, unstructuredtools.GetCondition(mg, compositionCondition.TypeResourcesHealthy, compositionCondition.ReasonResourcesUnhealthy))
+	})
+}
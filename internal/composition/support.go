@@ -1,17 +1,27 @@
 package composition
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/dynamic"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/hooks"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/ownership"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/processor"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	helmutils "github.com/krateoplatformops/plumbing/helm/utils"
 	"github.com/krateoplatformops/plumbing/maps"
 
 	unstructuredtools "github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured"
 	"github.com/krateoplatformops/unstructured-runtime/pkg/tools/unstructured/condition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sdynamic "k8s.io/client-go/dynamic"
 )
 
 type ManagedResource struct {
@@ -20,24 +30,7 @@ type ManagedResource struct {
 	Name       string `json:"name"`
 	Namespace  string `json:"namespace"`
 	Path       string `json:"path"`
-}
-
-func setAvaibleStatus(mg *unstructured.Unstructured, message string, force bool) error {
-	if !force {
-		currentCondition := unstructuredtools.GetCondition(mg, condition.Available().Type, condition.Available().Reason)
-
-		if currentCondition != nil && currentCondition.Message == message {
-			return nil
-		}
-	}
-
-	cond := condition.Available()
-	cond.Message = message
-	err := unstructuredtools.SetConditions(mg, cond)
-	if err != nil {
-		return fmt.Errorf("setting condition: %w", err)
-	}
-	return nil
+	Health     string `json:"health,omitempty"`
 }
 
 func setGracefullyPausedCondition(mg *unstructured.Unstructured, force bool) error {
@@ -62,6 +55,7 @@ type ConditionType string
 
 const (
 	ConditionTypeAvailable                 ConditionType = "Available"
+	ConditionTypeUnavailable               ConditionType = "Unavailable"
 	ConditionTypeReconcileGracefullyPaused ConditionType = "ReconcileGracefullyPaused"
 )
 
@@ -74,6 +68,7 @@ type statusManagerOpts struct {
 	digest         string
 	message        string
 	conditionType  ConditionType
+	phase          Phase
 }
 
 func (h *handler) setStatus(mg *unstructured.Unstructured, opts *statusManagerOpts) error {
@@ -110,11 +105,20 @@ func (h *handler) setStatus(mg *unstructured.Unstructured, opts *statusManagerOp
 		return fmt.Errorf("setting chart version in status: %w", err)
 	}
 
+	if opts.phase != "" {
+		err = setReconcileStatus(mg, opts.phase, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
 	switch opts.conditionType {
 	case ConditionTypeReconcileGracefullyPaused:
 		return setGracefullyPausedCondition(mg, opts.force)
 	case ConditionTypeAvailable:
-		return setAvaibleStatus(mg, opts.message, opts.force)
+		return setReady(mg, condition.Available(), opts.message, opts.force)
+	case ConditionTypeUnavailable:
+		return setReady(mg, condition.Unavailable(), opts.message, opts.force)
 	}
 	return fmt.Errorf("unknown condition type: %s", opts.conditionType)
 }
@@ -133,6 +137,11 @@ func setManagedResources(mg *unstructured.Unstructured, managed []any) {
 func (h *handler) populateManagedResources(resources []processor.MinimalMetadata) ([]any, error) {
 	var managed []interface{}
 	for _, ref := range resources {
+		// Hooks are not part of the release resources, they are reported under 'status.hooks'
+		if hooks.IsHook(ref.GetAnnotations()) {
+			continue
+		}
+
 		gvr, err := h.pluralizer.GVKtoGVR(schema.FromAPIVersionAndKind(ref.GetAPIVersion(), ref.GetKind()))
 		if err != nil {
 			return nil, fmt.Errorf("getting GVR for %s/%s with name %s and namespace %s: %w", ref.GetAPIVersion(), ref.GetKind(), ref.GetName(), ref.GetNamespace(), err)
@@ -176,3 +185,82 @@ func (h *handler) populateManagedResources(resources []processor.MinimalMetadata
 
 	return managed, nil
 }
+
+// buildActionConfig returns the Helm action configuration shared by install, upgrade and dry-run renders.
+// Values are taken from the valuesFrom references of the definition, overridden by the composition spec,
+// and enriched with the global values injected by the controller.
+func (h *handler) buildActionConfig(ctx context.Context, dyn k8sdynamic.Interface, mg *unstructured.Unstructured, pkg *archive.Info) (*helmconfig.ActionConfig, error) {
+	values, err := helmutils.ValuesFromSpec(mg)
+	if err != nil {
+		return nil, fmt.Errorf("getting spec values: %w", err)
+	}
+	values, err = h.mergeValuesFrom(ctx, dyn, mg, pkg, values)
+	if err != nil {
+		return nil, err
+	}
+	err = values.InjectGlobalValues(mg, h.pluralizer, krateoNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("injecting global values: %w", err)
+	}
+	postrenderLabels, err := helmutils.LabelPostRenderFromSpec(mg, h.pluralizer, krateoNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("creating label post renderer: %w", err)
+	}
+
+	actionConfig := &helmconfig.ActionConfig{
+		ChartVersion:          pkg.Version,
+		ChartName:             pkg.Repo,
+		Values:                values,
+		InsecureSkipTLSverify: pkg.InsecureSkipTLSverify,
+		PostRenderer:          postrenderLabels,
+		Labels:                ownership.Labels(mg.GetUID()),
+	}
+	if pkg.Auth != nil {
+		actionConfig.Username = pkg.Auth.Username
+		actionConfig.Password = pkg.Auth.Password
+	}
+	return actionConfig, nil
+}
+
+// annotationOr returns the setting of the composition annotation when set, the one of the CompositionDefinition otherwise.
+func annotationOr[T any](mg *unstructured.Unstructured, annotation func(metav1.Object) (T, bool), definition T) T {
+	if v, ok := annotation(mg); ok {
+		return v
+	}
+	return definition
+}
+
+// setConditionMessage sets the condition with the given message, unless a condition
+// with the same type, reason and message is already set.
+func setConditionMessage(mg *unstructured.Unstructured, cond metav1.Condition, message string) error {
+	currentCondition := unstructuredtools.GetCondition(mg, cond.Type, cond.Reason)
+	if currentCondition != nil && currentCondition.Message == message {
+		return nil
+	}
+
+	cond.Message = message
+	err := unstructuredtools.SetConditions(mg, cond)
+	if err != nil {
+		return fmt.Errorf("setting condition: %w", err)
+	}
+	return nil
+}
+
+// removeCondition removes the condition with the given type, if present.
+func removeCondition(mg *unstructured.Unstructured, condType string) error {
+	conditions := unstructuredtools.GetConditions(mg)
+	if len(conditions) == 0 {
+		return nil
+	}
+	condition.Remove(&conditions, condType)
+
+	res := make([]any, 0, len(conditions))
+	for i := range conditions {
+		c, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&conditions[i])
+		if err != nil {
+			return fmt.Errorf("converting condition: %w", err)
+		}
+		res = append(res, c)
+	}
+	return unstructured.SetNestedSlice(mg.Object, res, "status", "conditions")
+}
@@ -184,6 +184,29 @@ func TestPopulateManagedResources(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "helm hooks are skipped",
+			pluralizer: &mockPluralizer{
+				gvrMap: map[schema.GroupVersionKind]schema.GroupVersionResource{
+					{Group: "", Version: "v1", Kind: "Service"}:  {Group: "", Version: "v1", Resource: "services"},
+					{Group: "batch", Version: "v1", Kind: "Job"}: {Group: "batch", Version: "v1", Resource: "jobs"},
+				},
+				errMap: make(map[schema.GroupVersionKind]error),
+			},
+			resources: []processor.MinimalMetadata{
+				{APIVersion: "batch/v1", Kind: "Job", Metadata: processor.Metadata{Name: "test-migrate", Namespace: "default", Annotations: map[string]string{"helm.sh/hook": "pre-upgrade"}}},
+				{APIVersion: "v1", Kind: "Service", Metadata: processor.Metadata{Name: "test-service", Namespace: "default"}},
+			},
+			expected: []interface{}{
+				ManagedResource{
+					APIVersion: "v1",
+					Resource:   "services",
+					Name:       "test-service",
+					Namespace:  "default",
+					Path:       "/api/v1/namespaces/default/services/test-service",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,41 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/valuesfrom"
+	helmutils "github.com/krateoplatformops/plumbing/helm/utils"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// mergeValuesFrom merges the values of the spec over the ones read from the valuesFrom references
+// of the definition, and tracks the references so that the composition is reconciled when they change.
+func (h *handler) mergeValuesFrom(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured, pkg *archive.Info, spec helmutils.Values) (helmutils.Values, error) {
+	owner, err := h.valuesOwner(mg)
+	if err != nil {
+		return nil, err
+	}
+	if pkg == nil || len(pkg.ValuesFrom) == 0 {
+		h.valuesWatcher.Untrack(owner)
+		return spec, nil
+	}
+	h.valuesWatcher.Track(owner, pkg.ValuesFrom)
+
+	values, err := h.valuesWatcher.Load(ctx, dyn, owner, pkg.ValuesFrom)
+	if err != nil {
+		return nil, fmt.Errorf("loading valuesFrom: %w", err)
+	}
+	return valuesfrom.Merge(values, spec), nil
+}
+
+func (h *handler) valuesOwner(mg *unstructured.Unstructured) (valuesfrom.Owner, error) {
+	gvr, err := h.pluralizer.GVKtoGVR(mg.GroupVersionKind())
+	if err != nil {
+		return valuesfrom.Owner{}, fmt.Errorf("converting GVK to GVR: %w", err)
+	}
+	return valuesfrom.Owner{GVR: gvr, Namespace: mg.GetNamespace(), Name: mg.GetName()}, nil
+}
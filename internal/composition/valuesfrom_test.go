@@ -0,0 +1,70 @@
+package composition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/valuesfrom"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestValuesOwner(t *testing.T) {
+	owner, err := newDependencyHandler().valuesOwner(newComposition())
+	require.NoError(t, err)
+	assert.Equal(t, valuesfrom.Owner{GVR: demoGVR, Namespace: "demo-system", Name: "demo"}, owner)
+}
+
+func TestBuildActionConfigValuesPrecedence(t *testing.T) {
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "configmaps"}: "ConfigMapList"},
+		newConfigMap("shared", map[string]any{
+			"values.yaml": "replicas: 2\nimage:\n  repository: nginx\n  tag: \"1.0\"\nglobal:\n  compositionName: from-values\n",
+		}),
+	)
+	mg := newComposition()
+	mg.Object["spec"] = map[string]any{
+		"image":  map[string]any{"tag": "2.0"},
+		"global": map[string]any{"compositionName": "from-spec"},
+	}
+
+	tests := []struct {
+		name     string
+		pkg      *archive.Info
+		expected map[string]any
+	}{
+		{
+			name: "valuesFrom, overridden by the spec, overridden by the global values",
+			pkg:  &archive.Info{ValuesFrom: []valuesfrom.Reference{{Kind: valuesfrom.KindConfigMap, Name: "shared"}}},
+			expected: map[string]any{
+				"replicas": float64(2),
+				"image":    map[string]any{"repository": "nginx", "tag": "2.0"},
+			},
+		},
+		{
+			name: "spec only",
+			pkg:  &archive.Info{},
+			expected: map[string]any{
+				"image": map[string]any{"tag": "2.0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actionConfig, err := newDependencyHandler().buildActionConfig(context.Background(), dyn, mg.DeepCopy(), tt.pkg)
+			require.NoError(t, err)
+
+			values := map[string]any(actionConfig.Values)
+			name, _, _ := unstructured.NestedString(values, "global", "compositionName")
+			assert.Equal(t, "demo", name)
+			delete(values, "global")
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	compositionCondition "github.com/krateoplatformops/composition-dynamic-controller/internal/condition"
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/processor"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"github.com/krateoplatformops/plumbing/kubeutil/event"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// waitOptions tells whether install and upgrade must wait for the resources of the release to be ready.
+type waitOptions struct {
+	enabled bool
+	timeout time.Duration
+}
+
+// getWaitOptions returns the wait settings of the composition, setting only the timeout annotation enables waiting.
+func getWaitOptions(mg *unstructured.Unstructured, pkg *archive.Info) waitOptions {
+	opts := waitOptions{timeout: helmWaitTimeout}
+	if pkg != nil {
+		opts.enabled = pkg.Wait
+		if pkg.WaitTimeout > 0 {
+			opts.timeout = pkg.WaitTimeout
+		}
+	}
+
+	_, timeoutSet := compositionMeta.GetWaitTimeout(mg)
+	opts.timeout = annotationOr(mg, compositionMeta.GetWaitTimeout, opts.timeout)
+	opts.enabled = annotationOr(mg, compositionMeta.GetWait, opts.enabled || timeoutSet)
+	return opts
+}
+
+// apply configures the Helm action to wait for the resources, jobs included, up to the timeout.
+func (o waitOptions) apply(cfg *helmconfig.ActionConfig) {
+	if !o.enabled {
+		return
+	}
+	cfg.Wait = true
+	cfg.WaitForJobs = true
+	cfg.Timeout = o.timeout
+}
+
+// setProgressing marks the composition as Progressing while the release resources are awaited.
+func setProgressing(mg *unstructured.Unstructured, timeout time.Duration) error {
+	return setConditionMessage(mg, compositionCondition.Progressing(),
+		fmt.Sprintf("Waiting up to %s for composition resources to be ready", timeout))
+}
+
+// setWaitFailed inspects the resources of the latest release revision after a failed install or upgrade
+// and marks the composition as Failed listing the ones that are not ready.
+// It returns false when all the resources are ready, that is the failure is not due to the wait timeout.
+func (h *handler) setWaitFailed(ctx context.Context, dyn dynamic.Interface, hc helmconfig.Client, mg *unstructured.Unstructured, releaseName string, timeout time.Duration) (bool, error) {
+	rel, err := hc.GetRelease(ctx, releaseName, &helmconfig.GetConfig{})
+	if err != nil {
+		return false, fmt.Errorf("finding helm release: %w", err)
+	}
+	if rel == nil {
+		return false, nil
+	}
+
+	all, _, err := processor.DecodeMinRelease(rel)
+	if err != nil {
+		return false, fmt.Errorf("decoding release: %w", err)
+	}
+	managed, err := h.populateManagedResources(all)
+	if err != nil {
+		return false, fmt.Errorf("populating managed resources: %w", err)
+	}
+	unhealthy := h.evaluateManagedHealth(ctx, dyn, managed)
+	setManagedResources(mg, managed)
+	if len(unhealthy) == 0 {
+		return false, nil
+	}
+
+	healthMessage, err := setResourcesHealth(mg, unhealthy)
+	if err != nil {
+		return false, err
+	}
+	err = setConditionMessage(mg, compositionCondition.Failed(),
+		fmt.Sprintf("Composition resources not ready after %s, %s", timeout, healthMessage))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// reportWaitFailure marks the composition as Failed and records a warning event when an install
+// or upgrade waiting for the release resources failed because some of them are not ready.
+// It reports whether the status of the composition has been changed.
+func (h *handler) reportWaitFailure(ctx context.Context, dyn dynamic.Interface, hc helmconfig.Client, mg *unstructured.Unstructured, releaseName string, wait waitOptions, action event.Action, cause error) (bool, error) {
+	if !wait.enabled {
+		return false, nil
+	}
+	failed, err := h.setWaitFailed(ctx, dyn, hc, mg, releaseName, wait.timeout)
+	if err != nil || !failed {
+		return false, err
+	}
+	h.eventRecorder.Event(mg, event.Warning(reasonNotReady, action, cause))
+	return true, nil
+}
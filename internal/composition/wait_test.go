@@ -0,0 +1,68 @@
+package composition
+
+import (
+	"testing"
+	"time"
+
+	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/archive"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWaitOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		pkg         *archive.Info
+		expected    waitOptions
+	}{
+		{
+			name:     "disabled by default",
+			pkg:      &archive.Info{},
+			expected: waitOptions{enabled: false, timeout: helmWaitTimeout},
+		},
+		{
+			name:     "enabled by definition",
+			pkg:      &archive.Info{Wait: true, WaitTimeout: 2 * time.Minute},
+			expected: waitOptions{enabled: true, timeout: 2 * time.Minute},
+		},
+		{
+			name:        "timeout annotation enables waiting",
+			annotations: map[string]string{compositionMeta.AnnotationKeyWaitTimeout: "30s"},
+			pkg:         &archive.Info{},
+			expected:    waitOptions{enabled: true, timeout: 30 * time.Second},
+		},
+		{
+			name:        "annotation overrides definition",
+			annotations: map[string]string{compositionMeta.AnnotationKeyWait: "false"},
+			pkg:         &archive.Info{Wait: true, WaitTimeout: 2 * time.Minute},
+			expected:    waitOptions{enabled: false, timeout: 2 * time.Minute},
+		},
+		{
+			name:     "nil package info",
+			pkg:      nil,
+			expected: waitOptions{enabled: false, timeout: helmWaitTimeout},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mg := newComposition()
+			mg.SetAnnotations(tt.annotations)
+			assert.Equal(t, tt.expected, getWaitOptions(mg, tt.pkg))
+		})
+	}
+}
+
+func TestWaitOptionsApply(t *testing.T) {
+	cfg := &helmconfig.ActionConfig{}
+	waitOptions{enabled: false, timeout: time.Minute}.apply(cfg)
+	assert.False(t, cfg.Wait)
+	assert.Zero(t, cfg.Timeout)
+
+	waitOptions{enabled: true, timeout: time.Minute}.apply(cfg)
+	assert.True(t, cfg.Wait)
+	assert.True(t, cfg.WaitForJobs)
+	assert.Equal(t, time.Minute, cfg.Timeout)
+}
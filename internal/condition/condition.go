@@ -5,8 +5,93 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	// TypeChartResolved resources have the chart of their CompositionDefinition resolved.
+	TypeChartResolved = "ChartResolved"
+
+	// TypeRBACReady resources have the RBAC policy of their release generated and applied.
+	TypeRBACReady = "RBACReady"
+
+	// TypeReleaseDeployed resources have the desired release rendered and deployed.
+	TypeReleaseDeployed = "ReleaseDeployed"
+
+	// TypeDrifted resources have objects whose live state differs from the release manifest.
+	TypeDrifted = "Drifted"
+
+	// TypeResourcesHealthy resources have all the objects rendered by the release healthy.
+	TypeResourcesHealthy = "ResourcesHealthy"
+
+	// TypeHooksSucceeded resources have all the Helm hooks of the latest release revision that ran succeeded.
+	TypeHooksSucceeded = "HooksSucceeded"
+
+	// TypeRolledBack resources have been rolled back to a previous revision on request.
+	TypeRolledBack = "RolledBack"
+
+	// TypeUpgradePending resources have an upgrade that is deferred.
+	TypeUpgradePending = "UpgradePending"
+
+	// TypeWaitingForDependencies resources have an install or upgrade that is deferred
+	// until the compositions they depend on are available.
+	TypeWaitingForDependencies = "WaitingForDependencies"
+
+	// TypeReleaseConflict resources have a release name already claimed by the release of another composition.
+	TypeReleaseConflict = "ReleaseConflict"
+
+	// TypeReleaseAdopted resources have adopted, or tried to adopt, an existing release.
+	TypeReleaseAdopted = "ReleaseAdopted"
+
+	// TypeReleaseNameMigrated resources have their release moved from the pre-0.20 release name
+	// to the UID-suffixed one, or are being moved.
+	TypeReleaseNameMigrated = "ReleaseNameMigrated"
+)
+
 const (
 	ReasonReconcileGracefullyPaused = "ReconcileGracefullyPaused"
+
+	ReasonChartResolved         = "ChartResolved"
+	ReasonChartResolutionFailed = "ChartResolutionFailed"
+
+	ReasonRBACApplied          = "RBACApplied"
+	ReasonRBACGenerationFailed = "RBACGenerationFailed"
+	ReasonRBACApplyFailed      = "RBACApplyFailed"
+
+	ReasonReleaseDeployed = "ReleaseDeployed"
+	ReasonRenderFailed    = "RenderFailed"
+	ReasonInstallFailed   = "InstallFailed"
+	ReasonUpgradeFailed   = "UpgradeFailed"
+
+	ReasonDriftDetected = "DriftDetected"
+	ReasonNoDrift       = "NoDrift"
+
+	ReasonResourcesHealthy   = "ResourcesHealthy"
+	ReasonResourcesUnhealthy = "ResourcesUnhealthy"
+
+	ReasonHooksSucceeded = "HooksSucceeded"
+	ReasonHookFailed     = "HookFailed"
+
+	ReasonProgressing = "Progressing"
+	ReasonFailed      = "Failed"
+
+	ReasonRolledBack     = "RolledBack"
+	ReasonRollbackFailed = "RollbackFailed"
+
+	ReasonRolloutThrottled = "RolloutThrottled"
+	ReasonRolloutHalted    = "RolloutHalted"
+
+	ReasonOutsideMaintenanceWindow = "OutsideMaintenanceWindow"
+	ReasonInvalidMaintenanceWindow = "InvalidMaintenanceWindow"
+
+	ReasonDependenciesNotReady = "DependenciesNotReady"
+	ReasonInvalidDependencies  = "InvalidDependencies"
+
+	ReasonReleaseOwnedByOther = "ReleaseOwnedByOther"
+
+	ReasonReleaseAdopted  = "ReleaseAdopted"
+	ReasonAdoptionRefused = "AdoptionRefused"
+
+	ReasonReleaseNameMigrating       = "ReleaseNameMigrating"
+	ReasonReleaseNameMigrated        = "ReleaseNameMigrated"
+	ReasonReleaseNameMigrationFailed = "ReleaseNameMigrationFailed"
 )
 
 // ReconcilePaused returns a condition that indicates reconciliation on
@@ -19,3 +104,344 @@ func ReconcileGracefullyPaused() metav1.Condition {
 		Reason:             ReasonReconcileGracefullyPaused,
 	}
 }
+
+// ChartResolved returns a condition that indicates the chart of the
+// CompositionDefinition has been resolved.
+func ChartResolved() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeChartResolved,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartResolved,
+	}
+}
+
+// ChartResolutionFailed returns a condition that indicates the chart of the
+// CompositionDefinition could not be resolved.
+func ChartResolutionFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeChartResolved,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonChartResolutionFailed,
+	}
+}
+
+// RBACReady returns a condition that indicates the RBAC policy
+// of the release has been generated and applied.
+func RBACReady() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeRBACReady,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRBACApplied,
+	}
+}
+
+// RBACGenerationFailed returns a condition that indicates the RBAC policy
+// of the release could not be generated by the chart inspector.
+func RBACGenerationFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeRBACReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRBACGenerationFailed,
+	}
+}
+
+// RBACApplyFailed returns a condition that indicates the RBAC policy
+// of the release could not be applied.
+func RBACApplyFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeRBACReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRBACApplyFailed,
+	}
+}
+
+// ReleaseDeployed returns a condition that indicates the desired release
+// has been deployed.
+func ReleaseDeployed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseDeployed,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReleaseDeployed,
+	}
+}
+
+// RenderFailed returns a condition that indicates the desired release
+// could not be rendered with the values of the composition.
+func RenderFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseDeployed,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRenderFailed,
+	}
+}
+
+// InstallFailed returns a condition that indicates the install
+// of the release failed.
+func InstallFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseDeployed,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInstallFailed,
+	}
+}
+
+// UpgradeFailed returns a condition that indicates the upgrade
+// of the release failed.
+func UpgradeFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseDeployed,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonUpgradeFailed,
+	}
+}
+
+// Drifted returns a condition that indicates some of the objects rendered
+// by the release have been changed in the cluster.
+func Drifted() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeDrifted,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDriftDetected,
+	}
+}
+
+// NotDrifted returns a condition that indicates the live state of the objects
+// rendered by the release matches the release manifest.
+func NotDrifted() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeDrifted,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonNoDrift,
+	}
+}
+
+// ResourcesHealthy returns a condition that indicates all the objects
+// rendered by the release are healthy.
+func ResourcesHealthy() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeResourcesHealthy,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonResourcesHealthy,
+	}
+}
+
+// ResourcesUnhealthy returns a condition that indicates some of the objects
+// rendered by the release are not healthy.
+func ResourcesUnhealthy() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeResourcesHealthy,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonResourcesUnhealthy,
+	}
+}
+
+// HooksSucceeded returns a condition that indicates the Helm hooks
+// of the latest release revision that ran succeeded.
+func HooksSucceeded() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeHooksSucceeded,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonHooksSucceeded,
+	}
+}
+
+// HookFailed returns a condition that indicates some of the Helm hooks
+// of the latest release revision failed.
+func HookFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeHooksSucceeded,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonHookFailed,
+	}
+}
+
+// Progressing returns a condition that indicates the release has been applied
+// and the controller is waiting for its resources to be ready.
+func Progressing() metav1.Condition {
+	return metav1.Condition{
+		Type:               condition.TypeReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonProgressing,
+	}
+}
+
+// Failed returns a condition that indicates the resources of the release
+// did not become ready within the expected time.
+func Failed() metav1.Condition {
+	return metav1.Condition{
+		Type:               condition.TypeReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonFailed,
+	}
+}
+
+// RolledBack returns a condition that indicates the release has been rolled back
+// to the requested revision and upgrades are paused.
+func RolledBack() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeRolledBack,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRolledBack,
+	}
+}
+
+// RollbackFailed returns a condition that indicates the rollback
+// to the requested revision failed.
+func RollbackFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeRolledBack,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRollbackFailed,
+	}
+}
+
+// RolloutThrottled returns a condition that indicates the upgrade to a new chart version
+// is deferred because too many compositions of the definition are upgrading.
+func RolloutThrottled() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeUpgradePending,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRolloutThrottled,
+	}
+}
+
+// RolloutHalted returns a condition that indicates the upgrade to a new chart version
+// is deferred because the rollout has been halted after too many failures.
+func RolloutHalted() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeUpgradePending,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonRolloutHalted,
+	}
+}
+
+// OutsideMaintenanceWindow returns a condition that indicates the upgrade
+// is deferred until the next maintenance window.
+func OutsideMaintenanceWindow() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeUpgradePending,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonOutsideMaintenanceWindow,
+	}
+}
+
+// InvalidMaintenanceWindow returns a condition that indicates the upgrade
+// is deferred because the maintenance window cannot be parsed.
+func InvalidMaintenanceWindow() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeUpgradePending,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInvalidMaintenanceWindow,
+	}
+}
+
+// DependenciesNotReady returns a condition that indicates the install or upgrade
+// is deferred until the compositions the resource depends on are available.
+func DependenciesNotReady() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeWaitingForDependencies,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDependenciesNotReady,
+	}
+}
+
+// InvalidDependencies returns a condition that indicates the install or upgrade
+// is deferred because the dependencies of the resource are invalid or form a cycle.
+func InvalidDependencies() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeWaitingForDependencies,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonInvalidDependencies,
+	}
+}
+
+// ReleaseOwnedByOther returns a condition that indicates the release is owned
+// by another composition and is left untouched.
+func ReleaseOwnedByOther() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseConflict,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReleaseOwnedByOther,
+	}
+}
+
+// ReleaseAdopted returns a condition that indicates an existing release
+// has been adopted by the resource.
+func ReleaseAdopted() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseAdopted,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReleaseAdopted,
+	}
+}
+
+// AdoptionRefused returns a condition that indicates the release to adopt
+// does not exist or has been installed from another chart.
+func AdoptionRefused() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseAdopted,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonAdoptionRefused,
+	}
+}
+
+// ReleaseNameMigrating returns a condition that indicates the release is being moved
+// to the UID-suffixed release name.
+func ReleaseNameMigrating() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseNameMigrated,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReleaseNameMigrating,
+	}
+}
+
+// ReleaseNameMigrated returns a condition that indicates the release has been moved
+// to the UID-suffixed release name.
+func ReleaseNameMigrated() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseNameMigrated,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReleaseNameMigrated,
+	}
+}
+
+// ReleaseNameMigrationFailed returns a condition that indicates the release could not
+// be moved to the UID-suffixed release name.
+func ReleaseNameMigrationFailed() metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReleaseNameMigrated,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonReleaseNameMigrationFailed,
+	}
+}
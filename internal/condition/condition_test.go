@@ -42,3 +42,287 @@ func TestReasonReconcileGracefullyPausedConstant(t *testing.T) {
 		t.Errorf("Expected constant to be %s, got %s", expected, ReasonReconcileGracefullyPaused)
 	}
 }
+
+func TestDrifted(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{name: "drifted", cond: Drifted(), status: metav1.ConditionTrue, reason: ReasonDriftDetected},
+		{name: "not drifted", cond: NotDrifted(), status: metav1.ConditionFalse, reason: ReasonNoDrift},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeDrifted {
+				t.Errorf("Expected Type to be %s, got %s", TypeDrifted, tt.cond.Type)
+			}
+			if tt.cond.Status != tt.status {
+				t.Errorf("Expected Status to be %s, got %s", tt.status, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+			if tt.cond.LastTransitionTime.IsZero() {
+				t.Error("Expected LastTransitionTime to be set, got zero time")
+			}
+		})
+	}
+}
+
+func TestResourcesHealthy(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{name: "healthy", cond: ResourcesHealthy(), status: metav1.ConditionTrue, reason: ReasonResourcesHealthy},
+		{name: "unhealthy", cond: ResourcesUnhealthy(), status: metav1.ConditionFalse, reason: ReasonResourcesUnhealthy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeResourcesHealthy {
+				t.Errorf("Expected Type to be %s, got %s", TypeResourcesHealthy, tt.cond.Type)
+			}
+			if tt.cond.Status != tt.status {
+				t.Errorf("Expected Status to be %s, got %s", tt.status, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestWaitConditions(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		reason string
+	}{
+		{name: "progressing", cond: Progressing(), reason: ReasonProgressing},
+		{name: "failed", cond: Failed(), reason: ReasonFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != condition.TypeReady {
+				t.Errorf("Expected Type to be %s, got %s", condition.TypeReady, tt.cond.Type)
+			}
+			if tt.cond.Status != metav1.ConditionFalse {
+				t.Errorf("Expected Status to be %s, got %s", metav1.ConditionFalse, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestRolledBack(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{name: "rolled back", cond: RolledBack(), status: metav1.ConditionTrue, reason: ReasonRolledBack},
+		{name: "rollback failed", cond: RollbackFailed(), status: metav1.ConditionFalse, reason: ReasonRollbackFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeRolledBack {
+				t.Errorf("Expected Type to be %s, got %s", TypeRolledBack, tt.cond.Type)
+			}
+			if tt.cond.Status != tt.status {
+				t.Errorf("Expected Status to be %s, got %s", tt.status, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestUpgradePending(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		reason string
+	}{
+		{name: "rollout throttled", cond: RolloutThrottled(), reason: ReasonRolloutThrottled},
+		{name: "rollout halted", cond: RolloutHalted(), reason: ReasonRolloutHalted},
+		{name: "outside maintenance window", cond: OutsideMaintenanceWindow(), reason: ReasonOutsideMaintenanceWindow},
+		{name: "invalid maintenance window", cond: InvalidMaintenanceWindow(), reason: ReasonInvalidMaintenanceWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeUpgradePending {
+				t.Errorf("Expected Type to be %s, got %s", TypeUpgradePending, tt.cond.Type)
+			}
+			if tt.cond.Status != metav1.ConditionTrue {
+				t.Errorf("Expected Status to be %s, got %s", metav1.ConditionTrue, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestWaitingForDependencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		reason string
+	}{
+		{name: "dependencies not ready", cond: DependenciesNotReady(), reason: ReasonDependenciesNotReady},
+		{name: "invalid dependencies", cond: InvalidDependencies(), reason: ReasonInvalidDependencies},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeWaitingForDependencies {
+				t.Errorf("Expected Type to be %s, got %s", TypeWaitingForDependencies, tt.cond.Type)
+			}
+			if tt.cond.Status != metav1.ConditionTrue {
+				t.Errorf("Expected Status to be %s, got %s", metav1.ConditionTrue, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestHooksSucceeded(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{name: "succeeded", cond: HooksSucceeded(), status: metav1.ConditionTrue, reason: ReasonHooksSucceeded},
+		{name: "failed", cond: HookFailed(), status: metav1.ConditionFalse, reason: ReasonHookFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeHooksSucceeded {
+				t.Errorf("Expected Type to be %s, got %s", TypeHooksSucceeded, tt.cond.Type)
+			}
+			if tt.cond.Status != tt.status {
+				t.Errorf("Expected Status to be %s, got %s", tt.status, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestReleaseOwnedByOther(t *testing.T) {
+	cond := ReleaseOwnedByOther()
+	if cond.Type != TypeReleaseConflict {
+		t.Errorf("Expected Type to be %s, got %s", TypeReleaseConflict, cond.Type)
+	}
+	if cond.Status != metav1.ConditionTrue {
+		t.Errorf("Expected Status to be %s, got %s", metav1.ConditionTrue, cond.Status)
+	}
+	if cond.Reason != ReasonReleaseOwnedByOther {
+		t.Errorf("Expected Reason to be %s, got %s", ReasonReleaseOwnedByOther, cond.Reason)
+	}
+}
+
+func TestReleaseAdopted(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{name: "adopted", cond: ReleaseAdopted(), status: metav1.ConditionTrue, reason: ReasonReleaseAdopted},
+		{name: "refused", cond: AdoptionRefused(), status: metav1.ConditionFalse, reason: ReasonAdoptionRefused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeReleaseAdopted {
+				t.Errorf("Expected Type to be %s, got %s", TypeReleaseAdopted, tt.cond.Type)
+			}
+			if tt.cond.Status != tt.status {
+				t.Errorf("Expected Status to be %s, got %s", tt.status, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestReleaseNameMigrated(t *testing.T) {
+	tests := []struct {
+		name   string
+		cond   metav1.Condition
+		status metav1.ConditionStatus
+		reason string
+	}{
+		{name: "migrating", cond: ReleaseNameMigrating(), status: metav1.ConditionFalse, reason: ReasonReleaseNameMigrating},
+		{name: "migrated", cond: ReleaseNameMigrated(), status: metav1.ConditionTrue, reason: ReasonReleaseNameMigrated},
+		{name: "failed", cond: ReleaseNameMigrationFailed(), status: metav1.ConditionFalse, reason: ReasonReleaseNameMigrationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != TypeReleaseNameMigrated {
+				t.Errorf("Expected Type to be %s, got %s", TypeReleaseNameMigrated, tt.cond.Type)
+			}
+			if tt.cond.Status != tt.status {
+				t.Errorf("Expected Status to be %s, got %s", tt.status, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
+
+func TestReconcileSteps(t *testing.T) {
+	tests := []struct {
+		name     string
+		cond     metav1.Condition
+		condType string
+		status   metav1.ConditionStatus
+		reason   string
+	}{
+		{name: "chart resolved", cond: ChartResolved(), condType: TypeChartResolved, status: metav1.ConditionTrue, reason: ReasonChartResolved},
+		{name: "chart resolution failed", cond: ChartResolutionFailed(), condType: TypeChartResolved, status: metav1.ConditionFalse, reason: ReasonChartResolutionFailed},
+		{name: "rbac ready", cond: RBACReady(), condType: TypeRBACReady, status: metav1.ConditionTrue, reason: ReasonRBACApplied},
+		{name: "rbac generation failed", cond: RBACGenerationFailed(), condType: TypeRBACReady, status: metav1.ConditionFalse, reason: ReasonRBACGenerationFailed},
+		{name: "rbac apply failed", cond: RBACApplyFailed(), condType: TypeRBACReady, status: metav1.ConditionFalse, reason: ReasonRBACApplyFailed},
+		{name: "release deployed", cond: ReleaseDeployed(), condType: TypeReleaseDeployed, status: metav1.ConditionTrue, reason: ReasonReleaseDeployed},
+		{name: "render failed", cond: RenderFailed(), condType: TypeReleaseDeployed, status: metav1.ConditionFalse, reason: ReasonRenderFailed},
+		{name: "install failed", cond: InstallFailed(), condType: TypeReleaseDeployed, status: metav1.ConditionFalse, reason: ReasonInstallFailed},
+		{name: "upgrade failed", cond: UpgradeFailed(), condType: TypeReleaseDeployed, status: metav1.ConditionFalse, reason: ReasonUpgradeFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cond.Type != tt.condType {
+				t.Errorf("Expected Type to be %s, got %s", tt.condType, tt.cond.Type)
+			}
+			if tt.cond.Status != tt.status {
+				t.Errorf("Expected Status to be %s, got %s", tt.status, tt.cond.Status)
+			}
+			if tt.cond.Reason != tt.reason {
+				t.Errorf("Expected Reason to be %s, got %s", tt.reason, tt.cond.Reason)
+			}
+		})
+	}
+}
@@ -1,7 +1,11 @@
 package meta
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/krateoplatformops/unstructured-runtime/pkg/meta"
@@ -31,17 +35,111 @@ const (
 	// that indicates the time when the reconciliation was gracefully paused.
 	// This is used to track how long the resource has been paused.
 	AnnotationKeyReconciliationGracefullyPausedTime = "krateo.io/gracefully-paused-time"
+
+	// AnnotationKeyReconciliationGracefullyPausedDuration is the key in the annotations map that sets
+	// how long the graceful pause lasts (e.g. "2h"), starting from the time it began.
+	AnnotationKeyReconciliationGracefullyPausedDuration = "krateo.io/gracefully-paused-duration"
+
+	// AnnotationKeyReconciliationGracefullyPausedUntil is the key in the annotations map that sets
+	// the RFC3339 deadline of the graceful pause. It takes precedence over the duration.
+	AnnotationKeyReconciliationGracefullyPausedUntil = "krateo.io/gracefully-paused-until"
+
+	// AnnotationKeyReconciliationGracefullyPausedBy is the key in the annotations map
+	// that tells who gracefully paused the resource.
+	AnnotationKeyReconciliationGracefullyPausedBy = "krateo.io/gracefully-paused-by"
+
+	// AnnotationKeyReconciliationGracefullyPausedReason is the key in the annotations map
+	// that tells why the resource has been gracefully paused.
+	AnnotationKeyReconciliationGracefullyPausedReason = "krateo.io/gracefully-paused-reason"
+
+	// AnnotationKeySelfHeal is the key in the annotations map that enables or disables
+	// the self-healing of drifted resources. When set, it overrides the value of the CompositionDefinition.
+	AnnotationKeySelfHeal = "krateo.io/self-heal"
+
+	// AnnotationKeyWait is the key in the annotations map that enables or disables waiting
+	// for the resources of the release to be ready on install and upgrade.
+	// When set, it overrides the value of the CompositionDefinition.
+	AnnotationKeyWait = "krateo.io/wait"
+
+	// AnnotationKeyWaitTimeout is the key in the annotations map that sets how long to wait
+	// for the resources of the release to be ready (e.g. "10m").
+	AnnotationKeyWaitTimeout = "krateo.io/wait-timeout"
+
+	// AnnotationKeyAtomic is the key in the annotations map that enables or disables the rollback
+	// of failed upgrades to the last deployed revision. When set, it overrides the value of the CompositionDefinition.
+	AnnotationKeyAtomic = "krateo.io/atomic"
+
+	// AnnotationKeyRollbackToRevision is the key in the annotations map that requests the rollback
+	// of the release to the given revision. Upgrades are paused until the annotation is removed or the spec changes.
+	AnnotationKeyRollbackToRevision = "krateo.io/rollback-to-revision"
+
+	// AnnotationKeyChartVersionConstraint is the key in the annotations map that pins the chart version
+	// of the composition within a semver constraint (e.g. ">=1.2 <1.3"). The highest published version
+	// satisfying it is used instead of the version of the CompositionDefinition.
+	AnnotationKeyChartVersionConstraint = "krateo.io/chart-version-constraint"
+
+	// AnnotationKeyValuesFromRevision is the key in the annotations map set by the controller
+	// when a ConfigMap or Secret referenced by the valuesFrom of the composition changes,
+	// so that the composition is reconciled with the new values.
+	AnnotationKeyValuesFromRevision = "krateo.io/values-from-revision"
+
+	// AnnotationKeyMaintenanceWindowSchedule is the key in the annotations map that sets the cron expression
+	// of the start of the maintenance window. Upgrades are deferred outside the window.
+	// When set, it overrides the maintenance window of the CompositionDefinition.
+	AnnotationKeyMaintenanceWindowSchedule = "krateo.io/maintenance-window-schedule"
+
+	// AnnotationKeyMaintenanceWindowDuration is the key in the annotations map that sets
+	// how long the maintenance window stays open (e.g. "4h").
+	AnnotationKeyMaintenanceWindowDuration = "krateo.io/maintenance-window-duration"
+
+	// AnnotationKeyDependsOn is the key in the annotations map that lists the compositions this one depends on,
+	// as a YAML or JSON list of references with group, version, resource, name and namespace.
+	// Install and upgrade are deferred until every dependency is available.
+	AnnotationKeyDependsOn = "krateo.io/depends-on"
+
+	// AnnotationKeyPrefixDependent is the prefix of the annotations set by the controller on a composition
+	// for every composition that depends on it, so that it is not deleted while its dependents exist.
+	AnnotationKeyPrefixDependent = "dependents.krateo.io/"
+
+	// AnnotationKeyAdoptRelease is the key in the annotations map that names an existing Helm release,
+	// in the namespace of the composition, to adopt on create instead of installing a new one.
+	AnnotationKeyAdoptRelease = "krateo.io/adopt-release"
 )
 
+// ReleaseNameMaxLength is the maximum length of a Helm release name.
+const ReleaseNameMaxLength = 53
+
+// releaseNameHashLength is the length of the hash of the name appended to truncated release names.
+const releaseNameHashLength = 8
+
+// CalculateReleaseName returns the release name of the composition, composed of its name and the first
+// 8 characters of its UID. Names too long to fit in a Helm release name are truncated and followed by a hash
+// of the full name, so that the result is stable and compositions sharing the same prefix do not collide.
 func CalculateReleaseName(o runtime.Object) string {
 	obj := o.(metav1.Object)
 	uid := obj.GetUID()
 	if uid == "" {
 		// Generate random string if UID is not set
-		return fmt.Sprintf("%s-%s", obj.GetName(), rand.SafeEncodeString(rand.String(8)))
+		return composeReleaseName(obj.GetName(), rand.SafeEncodeString(rand.String(8)))
 	}
 	hashstr := rand.SafeEncodeString(string(obj.GetUID())[:8])
-	return fmt.Sprintf("%s-%s", obj.GetName(), hashstr)
+	return composeReleaseName(obj.GetName(), hashstr)
+}
+
+// composeReleaseName joins the name and the suffix, truncating the name when the result would exceed
+// the maximum length of a Helm release name.
+func composeReleaseName(name, suffix string) string {
+	releaseName := fmt.Sprintf("%s-%s", name, suffix)
+	if len(releaseName) <= ReleaseNameMaxLength {
+		return releaseName
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:releaseNameHashLength]
+	prefix := name[:ReleaseNameMaxLength-len(suffix)-releaseNameHashLength-2]
+	// A release name must start and end with an alphanumeric character, also around the separators
+	prefix = strings.TrimRight(prefix, "-.")
+	return fmt.Sprintf("%s-%s-%s", prefix, hash, suffix)
 }
 
 func GetReleaseName(o metav1.Object) string {
@@ -50,17 +148,28 @@ func GetReleaseName(o metav1.Object) string {
 
 // Set the release name as a label on the Composition resource.
 // Release name will be "name" if the annotation has not been already populated.
+// A stored release name longer than Helm allows cannot name an existing release, so it is replaced.
 func SetReleaseName(o metav1.Object, name string) {
 	mglabels := o.GetLabels()
 	if mglabels == nil {
 		mglabels = make(map[string]string)
 	}
-	if _, ok := mglabels[ReleaseNameLabel]; !ok {
+	if current, ok := mglabels[ReleaseNameLabel]; !ok || len(current) > ReleaseNameMaxLength {
 		mglabels[ReleaseNameLabel] = name
 	}
 	o.SetLabels(mglabels)
 }
 
+// ReplaceReleaseName sets the release name label on the Composition resource, replacing the current one.
+func ReplaceReleaseName(o metav1.Object, name string) {
+	mglabels := o.GetLabels()
+	if mglabels == nil {
+		mglabels = make(map[string]string)
+	}
+	mglabels[ReleaseNameLabel] = name
+	o.SetLabels(mglabels)
+}
+
 type CompositionDefinitionInfo struct {
 	Namespace string
 	Name      string
@@ -107,3 +216,132 @@ func GetGracefullyPausedTime(o metav1.Object) (time.Time, bool) {
 	}
 	return pausedTime, true
 }
+
+// GetGracefullyPausedResumeTime returns the time when the graceful pause expires and whether it is time-boxed.
+// The deadline set with AnnotationKeyReconciliationGracefullyPausedUntil takes precedence over the
+// duration set with AnnotationKeyReconciliationGracefullyPausedDuration, which is counted from the pause time.
+func GetGracefullyPausedResumeTime(o metav1.Object) (time.Time, bool) {
+	annotations := o.GetAnnotations()
+	if val, ok := annotations[AnnotationKeyReconciliationGracefullyPausedUntil]; ok {
+		until, err := time.Parse(time.RFC3339, val)
+		if err == nil {
+			return until, true
+		}
+	}
+
+	val, ok := annotations[AnnotationKeyReconciliationGracefullyPausedDuration]
+	if !ok {
+		return time.Time{}, false
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return time.Time{}, false
+	}
+	pausedTime, ok := GetGracefullyPausedTime(o)
+	if !ok {
+		return time.Time{}, false
+	}
+	return pausedTime.Add(d), true
+}
+
+// RemoveGracefullyPaused removes the graceful pause annotation together with the ones describing the pause.
+func RemoveGracefullyPaused(o metav1.Object) {
+	meta.RemoveAnnotations(o,
+		AnnotationKeyReconciliationGracefullyPaused,
+		AnnotationKeyReconciliationGracefullyPausedTime,
+		AnnotationKeyReconciliationGracefullyPausedDuration,
+		AnnotationKeyReconciliationGracefullyPausedUntil,
+		AnnotationKeyReconciliationGracefullyPausedBy,
+		AnnotationKeyReconciliationGracefullyPausedReason,
+	)
+}
+
+// GetSelfHeal returns the value of the AnnotationKeySelfHeal annotation
+// and whether the annotation is set to a valid boolean.
+func GetSelfHeal(o metav1.Object) (bool, bool) {
+	return getBoolAnnotation(o, AnnotationKeySelfHeal)
+}
+
+// GetWait returns the value of the AnnotationKeyWait annotation
+// and whether the annotation is set to a valid boolean.
+func GetWait(o metav1.Object) (bool, bool) {
+	return getBoolAnnotation(o, AnnotationKeyWait)
+}
+
+// GetAtomic returns the value of the AnnotationKeyAtomic annotation
+// and whether the annotation is set to a valid boolean.
+func GetAtomic(o metav1.Object) (bool, bool) {
+	return getBoolAnnotation(o, AnnotationKeyAtomic)
+}
+
+// GetRollbackToRevision returns the value of the AnnotationKeyRollbackToRevision annotation
+// and whether the annotation is set to a valid revision number.
+func GetRollbackToRevision(o metav1.Object) (int, bool) {
+	val, ok := o.GetAnnotations()[AnnotationKeyRollbackToRevision]
+	if !ok {
+		return 0, false
+	}
+	rev, err := strconv.Atoi(val)
+	if err != nil || rev < 1 {
+		return 0, false
+	}
+	return rev, true
+}
+
+// GetMaintenanceWindow returns the values of the AnnotationKeyMaintenanceWindowSchedule and
+// AnnotationKeyMaintenanceWindowDuration annotations and whether the schedule is set.
+func GetMaintenanceWindow(o metav1.Object) (schedule string, duration string, ok bool) {
+	annotations := o.GetAnnotations()
+	schedule, ok = annotations[AnnotationKeyMaintenanceWindowSchedule]
+	if !ok || schedule == "" {
+		return "", "", false
+	}
+	return schedule, annotations[AnnotationKeyMaintenanceWindowDuration], true
+}
+
+// GetChartVersionConstraint returns the value of the AnnotationKeyChartVersionConstraint annotation
+// and whether it is set to a non-empty value.
+func GetChartVersionConstraint(o metav1.Object) (string, bool) {
+	val := strings.TrimSpace(o.GetAnnotations()[AnnotationKeyChartVersionConstraint])
+	return val, val != ""
+}
+
+// GetDependsOn returns the value of the AnnotationKeyDependsOn annotation
+// and whether it is set to a non-empty value.
+func GetDependsOn(o metav1.Object) (string, bool) {
+	val := strings.TrimSpace(o.GetAnnotations()[AnnotationKeyDependsOn])
+	return val, val != ""
+}
+
+// GetAdoptRelease returns the value of the AnnotationKeyAdoptRelease annotation
+// and whether it is set to a non-empty value.
+func GetAdoptRelease(o metav1.Object) (string, bool) {
+	val := strings.TrimSpace(o.GetAnnotations()[AnnotationKeyAdoptRelease])
+	return val, val != ""
+}
+
+// GetWaitTimeout returns the value of the AnnotationKeyWaitTimeout annotation
+// and whether the annotation is set to a valid positive duration.
+func GetWaitTimeout(o metav1.Object) (time.Duration, bool) {
+	val, ok := o.GetAnnotations()[AnnotationKeyWaitTimeout]
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+func getBoolAnnotation(o metav1.Object, key string) (bool, bool) {
+	val, ok := o.GetAnnotations()[key]
+	if !ok {
+		return false, false
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, false
+	}
+	return b, true
+}
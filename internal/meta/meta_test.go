@@ -2,12 +2,15 @@ package meta
 
 import (
 	"fmt"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
@@ -94,6 +97,16 @@ func TestSetReleaseName(t *testing.T) {
 				"other-label":    "value",
 			},
 		},
+		{
+			name: "overwrite release name longer than helm allows",
+			initialLabels: map[string]string{
+				ReleaseNameLabel: strings.Repeat("a", 45) + "-abcdefgh",
+			},
+			releaseName: "new-release",
+			expectedLabels: map[string]string{
+				ReleaseNameLabel: "new-release",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -505,3 +518,366 @@ func TestCalculateReleaseName_UIDNotFound(t *testing.T) {
 		t.Fatalf("CalculateReleaseName result %q does not have expected prefix %q", releaseName, "no-uid-resource-")
 	}
 }
+
+func TestCalculateReleaseName_LongNames(t *testing.T) {
+	validReleaseName := regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+	uid := types.UID("5a47edd9-c710-4b4b-b5ea-b6cdf9fc1f58")
+	suffix := "-" + rand.SafeEncodeString("5a47edd9")
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: strings.Repeat("a", 44), expected: strings.Repeat("a", 44) + suffix},
+		{name: strings.Repeat("a", 45)},
+		{name: strings.Repeat("a", 34) + "-b-" + strings.Repeat("c", 30)},
+		{name: strings.Repeat("a", 34) + ".b." + strings.Repeat("c", 30)},
+		{name: strings.Repeat("a", 253)},
+	}
+
+	names := map[string]string{}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d characters", len(tt.name)), func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetName(tt.name)
+			obj.SetUID(uid)
+
+			releaseName := CalculateReleaseName(&obj)
+			if tt.expected != "" && releaseName != tt.expected {
+				t.Fatalf("CalculateReleaseName() = %q, want %q", releaseName, tt.expected)
+			}
+			if len(releaseName) > ReleaseNameMaxLength {
+				t.Fatalf("Release name %q exceeds %d characters", releaseName, ReleaseNameMaxLength)
+			}
+			if !validReleaseName.MatchString(releaseName) {
+				t.Fatalf("Release name %q is not a valid Helm release name", releaseName)
+			}
+			if !strings.HasSuffix(releaseName, suffix) {
+				t.Fatalf("Release name %q does not end with the UID suffix", releaseName)
+			}
+			if releaseName != CalculateReleaseName(&obj) {
+				t.Fatalf("CalculateReleaseName not deterministic for %q", tt.name)
+			}
+			if other, ok := names[releaseName]; ok {
+				t.Fatalf("Release name %q of %q collides with %q", releaseName, tt.name, other)
+			}
+			names[releaseName] = tt.name
+		})
+	}
+}
+
+func TestGetSelfHeal(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+		expectedSet bool
+	}{
+		{
+			name:        "self heal enabled",
+			annotations: map[string]string{AnnotationKeySelfHeal: "true"},
+			expected:    true,
+			expectedSet: true,
+		},
+		{
+			name:        "self heal disabled",
+			annotations: map[string]string{AnnotationKeySelfHeal: "false"},
+			expected:    false,
+			expectedSet: true,
+		},
+		{
+			name:        "invalid value",
+			annotations: map[string]string{AnnotationKeySelfHeal: "maybe"},
+			expected:    false,
+			expectedSet: false,
+		},
+		{
+			name:        "nil annotations",
+			annotations: nil,
+			expected:    false,
+			expectedSet: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			result, set := GetSelfHeal(&obj)
+			if result != tt.expected || set != tt.expectedSet {
+				t.Errorf("GetSelfHeal() = (%v, %v), want (%v, %v)", result, set, tt.expected, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestGetWaitTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    time.Duration
+		expectedSet bool
+	}{
+		{
+			name:        "valid timeout",
+			annotations: map[string]string{AnnotationKeyWaitTimeout: "10m"},
+			expected:    10 * time.Minute,
+			expectedSet: true,
+		},
+		{
+			name:        "invalid timeout",
+			annotations: map[string]string{AnnotationKeyWaitTimeout: "ten minutes"},
+			expected:    0,
+			expectedSet: false,
+		},
+		{
+			name:        "negative timeout",
+			annotations: map[string]string{AnnotationKeyWaitTimeout: "-1m"},
+			expected:    0,
+			expectedSet: false,
+		},
+		{
+			name:        "nil annotations",
+			annotations: nil,
+			expected:    0,
+			expectedSet: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			result, set := GetWaitTimeout(&obj)
+			if result != tt.expected || set != tt.expectedSet {
+				t.Errorf("GetWaitTimeout() = (%v, %v), want (%v, %v)", result, set, tt.expected, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestGetRollbackToRevision(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    int
+		expectedSet bool
+	}{
+		{name: "valid revision", annotations: map[string]string{AnnotationKeyRollbackToRevision: "3"}, expected: 3, expectedSet: true},
+		{name: "zero revision", annotations: map[string]string{AnnotationKeyRollbackToRevision: "0"}, expected: 0, expectedSet: false},
+		{name: "not a number", annotations: map[string]string{AnnotationKeyRollbackToRevision: "latest"}, expected: 0, expectedSet: false},
+		{name: "nil annotations", annotations: nil, expected: 0, expectedSet: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			result, set := GetRollbackToRevision(&obj)
+			if result != tt.expected || set != tt.expectedSet {
+				t.Errorf("GetRollbackToRevision() = (%v, %v), want (%v, %v)", result, set, tt.expected, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestGetMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		name             string
+		annotations      map[string]string
+		expectedSchedule string
+		expectedDuration string
+		expectedSet      bool
+	}{
+		{
+			name: "schedule and duration",
+			annotations: map[string]string{
+				AnnotationKeyMaintenanceWindowSchedule: "0 2 * * 6",
+				AnnotationKeyMaintenanceWindowDuration: "4h",
+			},
+			expectedSchedule: "0 2 * * 6",
+			expectedDuration: "4h",
+			expectedSet:      true,
+		},
+		{
+			name:             "schedule only",
+			annotations:      map[string]string{AnnotationKeyMaintenanceWindowSchedule: "@daily"},
+			expectedSchedule: "@daily",
+			expectedSet:      true,
+		},
+		{name: "duration only", annotations: map[string]string{AnnotationKeyMaintenanceWindowDuration: "4h"}},
+		{name: "empty schedule", annotations: map[string]string{AnnotationKeyMaintenanceWindowSchedule: ""}},
+		{name: "nil annotations", annotations: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			schedule, duration, set := GetMaintenanceWindow(&obj)
+			if schedule != tt.expectedSchedule || duration != tt.expectedDuration || set != tt.expectedSet {
+				t.Errorf("GetMaintenanceWindow() = (%q, %q, %v), want (%q, %q, %v)", schedule, duration, set, tt.expectedSchedule, tt.expectedDuration, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestGetGracefullyPausedResumeTime(t *testing.T) {
+	pausedAt := time.Date(2025, 3, 8, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    time.Time
+		expectedSet bool
+	}{
+		{
+			name: "duration from the pause time",
+			annotations: map[string]string{
+				AnnotationKeyReconciliationGracefullyPausedTime:     pausedAt.Format(time.RFC3339),
+				AnnotationKeyReconciliationGracefullyPausedDuration: "2h",
+			},
+			expected:    pausedAt.Add(2 * time.Hour),
+			expectedSet: true,
+		},
+		{
+			name: "deadline takes precedence",
+			annotations: map[string]string{
+				AnnotationKeyReconciliationGracefullyPausedTime:     pausedAt.Format(time.RFC3339),
+				AnnotationKeyReconciliationGracefullyPausedDuration: "2h",
+				AnnotationKeyReconciliationGracefullyPausedUntil:    "2025-03-09T08:00:00Z",
+			},
+			expected:    time.Date(2025, 3, 9, 8, 0, 0, 0, time.UTC),
+			expectedSet: true,
+		},
+		{
+			name:        "duration before the pause began",
+			annotations: map[string]string{AnnotationKeyReconciliationGracefullyPausedDuration: "2h"},
+		},
+		{
+			name: "invalid duration",
+			annotations: map[string]string{
+				AnnotationKeyReconciliationGracefullyPausedTime:     pausedAt.Format(time.RFC3339),
+				AnnotationKeyReconciliationGracefullyPausedDuration: "-2h",
+			},
+		},
+		{name: "not time-boxed", annotations: map[string]string{AnnotationKeyReconciliationGracefullyPaused: "true"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			result, set := GetGracefullyPausedResumeTime(&obj)
+			if !result.Equal(tt.expected) || set != tt.expectedSet {
+				t.Errorf("GetGracefullyPausedResumeTime() = (%v, %v), want (%v, %v)", result, set, tt.expected, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestRemoveGracefullyPaused(t *testing.T) {
+	obj := unstructured.Unstructured{}
+	obj.SetAnnotations(map[string]string{
+		AnnotationKeyReconciliationGracefullyPaused:         "true",
+		AnnotationKeyReconciliationGracefullyPausedTime:     "2025-03-08T10:00:00Z",
+		AnnotationKeyReconciliationGracefullyPausedDuration: "2h",
+		AnnotationKeyReconciliationGracefullyPausedBy:       "jane",
+		AnnotationKeyReconciliationGracefullyPausedReason:   "db migration",
+		"other": "value",
+	})
+
+	RemoveGracefullyPaused(&obj)
+
+	if !reflect.DeepEqual(obj.GetAnnotations(), map[string]string{"other": "value"}) {
+		t.Errorf("RemoveGracefullyPaused() left annotations %v", obj.GetAnnotations())
+	}
+}
+
+func TestGetChartVersionConstraint(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+		expectedSet bool
+	}{
+		{name: "range", annotations: map[string]string{AnnotationKeyChartVersionConstraint: ">=1.2 <1.3"}, expected: ">=1.2 <1.3", expectedSet: true},
+		{name: "surrounding spaces", annotations: map[string]string{AnnotationKeyChartVersionConstraint: " ~1.2 "}, expected: "~1.2", expectedSet: true},
+		{name: "empty", annotations: map[string]string{AnnotationKeyChartVersionConstraint: ""}, expected: "", expectedSet: false},
+		{name: "nil annotations", annotations: nil, expected: "", expectedSet: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			result, set := GetChartVersionConstraint(&obj)
+			if result != tt.expected || set != tt.expectedSet {
+				t.Errorf("GetChartVersionConstraint() = (%q, %v), want (%q, %v)", result, set, tt.expected, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestGetDependsOn(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+		expectedSet bool
+	}{
+		{name: "list", annotations: map[string]string{AnnotationKeyDependsOn: "- name: db\n"}, expected: "- name: db", expectedSet: true},
+		{name: "blank", annotations: map[string]string{AnnotationKeyDependsOn: "  "}, expected: "", expectedSet: false},
+		{name: "nil annotations", annotations: nil, expected: "", expectedSet: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			result, set := GetDependsOn(&obj)
+			if result != tt.expected || set != tt.expectedSet {
+				t.Errorf("GetDependsOn() = (%q, %v), want (%q, %v)", result, set, tt.expected, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestGetAdoptRelease(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    string
+		expectedSet bool
+	}{
+		{name: "release", annotations: map[string]string{AnnotationKeyAdoptRelease: " postgresql "}, expected: "postgresql", expectedSet: true},
+		{name: "blank", annotations: map[string]string{AnnotationKeyAdoptRelease: ""}, expected: "", expectedSet: false},
+		{name: "nil annotations", annotations: nil, expected: "", expectedSet: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := unstructured.Unstructured{}
+			obj.SetAnnotations(tt.annotations)
+			result, set := GetAdoptRelease(&obj)
+			if result != tt.expected || set != tt.expectedSet {
+				t.Errorf("GetAdoptRelease() = (%q, %v), want (%q, %v)", result, set, tt.expected, tt.expectedSet)
+			}
+		})
+	}
+}
+
+func TestReplaceReleaseName(t *testing.T) {
+	obj := unstructured.Unstructured{}
+	ReplaceReleaseName(&obj, "demo")
+	if got := GetReleaseName(&obj); got != "demo" {
+		t.Errorf("GetReleaseName() = %q, want %q", got, "demo")
+	}
+
+	obj.SetLabels(map[string]string{ReleaseNameLabel: "demo-12345678", "other-label": "value"})
+	ReplaceReleaseName(&obj, "postgresql")
+	expected := map[string]string{ReleaseNameLabel: "postgresql", "other-label": "value"}
+	if !reflect.DeepEqual(obj.GetLabels(), expected) {
+		t.Errorf("Expected labels %v, got %v", expected, obj.GetLabels())
+	}
+}
@@ -0,0 +1,99 @@
+package adoption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/clientpool"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Chart identifies the chart of a release or of a package.
+type Chart struct {
+	Name    string
+	Version string
+}
+
+func (c Chart) String() string {
+	return fmt.Sprintf("%s-%s", c.Name, c.Version)
+}
+
+// Source is the chart package of a CompositionDefinition.
+type Source struct {
+	// URL is the HTTP repository, the OCI reference or the archive of the chart.
+	URL     string
+	Version string
+	// Repo is the name of the chart in the repository.
+	Repo                  string
+	Username              string
+	Password              string
+	InsecureSkipTLSverify bool
+}
+
+// Inspector returns the charts of the releases to adopt and of the packages they are verified against.
+type Inspector interface {
+	// ReleaseChart returns the chart of the latest revision of the release, nil if the release does not exist.
+	ReleaseChart(namespace, releaseName string) (*Chart, error)
+
+	// PackageChart returns the chart of the package, reading the metadata of the downloaded archive.
+	PackageChart(ctx context.Context, src Source) (*Chart, error)
+}
+
+func NewInspector(store clientpool.ReleaseStore) Inspector {
+	return &inspector{store: store}
+}
+
+type inspector struct {
+	store clientpool.ReleaseStore
+}
+
+// ReleaseChart reads the release from the Helm release storage.
+func (i *inspector) ReleaseChart(namespace, releaseName string) (*Chart, error) {
+	store, err := i.store.Releases(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rel, err := store.Last(releaseName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting release %s: %w", releaseName, err)
+	}
+	if rel.Chart == nil || rel.Chart.Metadata == nil {
+		return nil, fmt.Errorf("release %s has no chart metadata", releaseName)
+	}
+	return &Chart{Name: rel.Chart.Metadata.Name, Version: rel.Chart.Metadata.Version}, nil
+}
+
+func (i *inspector) PackageChart(ctx context.Context, src Source) (*Chart, error) {
+	reader, _, err := getter.Get(ctx, src.URL,
+		getter.WithVersion(src.Version),
+		getter.WithRepo(src.Repo),
+		getter.WithCredentials(src.Username, src.Password),
+		getter.WithInsecureSkipVerifyTLS(src.InsecureSkipTLSverify),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("getting chart %s: %w", src.URL, err)
+	}
+	ch, err := loader.LoadArchive(reader)
+	if err != nil {
+		return nil, fmt.Errorf("loading chart %s: %w", src.URL, err)
+	}
+	return &Chart{Name: ch.Metadata.Name, Version: ch.Metadata.Version}, nil
+}
+
+// Verify checks that the release has been installed from the same chart as the package, so that it can
+// be adopted and upgraded with it. The chart versions may differ, the upgrade moves the release to the
+// version of the package.
+func Verify(release, pkg *Chart) error {
+	if release.Name != pkg.Name {
+		return fmt.Errorf("release chart %s differs from the chart %s of the composition definition", release, pkg)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package adoption
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		release Chart
+		pkg     Chart
+		wantErr string
+	}{
+		{name: "same chart", release: Chart{Name: "postgresql", Version: "1.2.0"}, pkg: Chart{Name: "postgresql", Version: "1.2.0"}},
+		{name: "other version", release: Chart{Name: "postgresql", Version: "1.1.0"}, pkg: Chart{Name: "postgresql", Version: "1.2.0"}},
+		{
+			name:    "other chart",
+			release: Chart{Name: "mysql", Version: "1.2.0"},
+			pkg:     Chart{Name: "postgresql", Version: "1.2.0"},
+			wantErr: "release chart mysql-1.2.0 differs from the chart postgresql-1.2.0 of the composition definition",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(&tt.release, &tt.pkg)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPackageChart(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "postgresql", Version: "1.2.0"},
+	}, dir)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+
+	ch, err := NewInspector(nil).PackageChart(context.Background(), Source{URL: srv.URL + "/" + filepath.Base(archive)})
+	require.NoError(t, err)
+	assert.Equal(t, &Chart{Name: "postgresql", Version: "1.2.0"}, ch)
+
+	_, err = NewInspector(nil).PackageChart(context.Background(), Source{URL: srv.URL + "/missing-1.0.0.tgz"})
+	assert.Error(t, err)
+}
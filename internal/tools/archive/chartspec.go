@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/maintenance"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/outputs"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rollout"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/valuesfrom"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// chartSpec is the 'spec.chart' of a composition definition.
+type chartSpec struct {
+	URL                   string                 `json:"url,omitempty"`
+	Version               string                 `json:"version,omitempty"`
+	Repo                  string                 `json:"repo,omitempty"`
+	Credentials           *chartCredentials      `json:"credentials,omitempty"`
+	InsecureSkipTLSverify bool                   `json:"insecureSkipTLSverify,omitempty"`
+	SelfHeal              bool                   `json:"selfHeal,omitempty"`
+	Wait                  bool                   `json:"wait,omitempty"`
+	WaitTimeout           string                 `json:"waitTimeout,omitempty"`
+	Atomic                bool                   `json:"atomic,omitempty"`
+	Rollout               *rollout.Policy        `json:"rollout,omitempty"`
+	ValuesFrom            []valuesfrom.Reference `json:"valuesFrom,omitempty"`
+	Outputs               []outputs.Output       `json:"outputs,omitempty"`
+	OutputsSecret         bool                   `json:"outputsSecret,omitempty"`
+	MaintenanceWindow     *maintenance.Spec      `json:"maintenanceWindow,omitempty"`
+}
+
+type chartCredentials struct {
+	Username    string            `json:"username,omitempty"`
+	PasswordRef *secretKeyRefSpec `json:"passwordRef,omitempty"`
+}
+
+type secretKeyRefSpec struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+}
+
+// decodeChartSpec decodes and validates 'spec.chart' of the composition definition.
+func decodeChartSpec(compositionDefinition *unstructured.Unstructured) (*chartSpec, error) {
+	chart, ok, err := unstructured.NestedMap(compositionDefinition.UnstructuredContent(), "spec", "chart")
+	if err != nil {
+		return nil, fmt.Errorf("reading 'spec.chart': %w", err)
+	}
+	spec := &chartSpec{}
+	if !ok {
+		return spec, nil
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(chart, spec)
+	if err != nil {
+		return nil, fmt.Errorf("converting 'spec.chart': %w", err)
+	}
+
+	for i, out := range spec.Outputs {
+		if out.Name == "" || out.JSONPath == "" {
+			return nil, fmt.Errorf("'spec.chart.outputs[%d]': name and jsonPath are required", i)
+		}
+	}
+	if spec.MaintenanceWindow != nil && spec.MaintenanceWindow.Schedule == "" {
+		spec.MaintenanceWindow = nil
+	}
+	if _, err := spec.waitTimeout(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// waitTimeout parses WaitTimeout, zero when unset.
+func (s *chartSpec) waitTimeout() (time.Duration, error) {
+	if s.WaitTimeout == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s.WaitTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("parsing 'spec.chart.waitTimeout': %w", err)
+	}
+	return d, nil
+}
@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/maintenance"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rollout"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDecodeChartSpec(t *testing.T) {
+	definition := func(chart map[string]any) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"spec": map[string]any{"chart": chart},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		chart    map[string]any
+		expected *chartSpec
+		timeout  time.Duration
+		wantErr  bool
+	}{
+		{
+			name: "all fields",
+			chart: map[string]any{
+				"url":     "oci://registry/chart",
+				"version": "1.0.0",
+				"credentials": map[string]any{
+					"username":    "user",
+					"passwordRef": map[string]any{"name": "creds", "namespace": "demo", "key": "password"},
+				},
+				"wait":              true,
+				"waitTimeout":       "90s",
+				"rollout":           map[string]any{"maxFailures": int64(2)},
+				"maintenanceWindow": map[string]any{"schedule": "0 2 * * *", "duration": "1h"},
+			},
+			expected: &chartSpec{
+				URL:     "oci://registry/chart",
+				Version: "1.0.0",
+				Credentials: &chartCredentials{
+					Username:    "user",
+					PasswordRef: &secretKeyRefSpec{Name: "creds", Namespace: "demo", Key: "password"},
+				},
+				Wait:              true,
+				WaitTimeout:       "90s",
+				Rollout:           &rollout.Policy{MaxFailures: 2},
+				MaintenanceWindow: &maintenance.Spec{Schedule: "0 2 * * *", Duration: "1h"},
+			},
+			timeout: 90 * time.Second,
+		},
+		{
+			name:     "empty maintenance schedule",
+			chart:    map[string]any{"url": "oci://registry/chart", "maintenanceWindow": map[string]any{"duration": "1h"}},
+			expected: &chartSpec{URL: "oci://registry/chart"},
+		},
+		{
+			name:    "invalid wait timeout",
+			chart:   map[string]any{"url": "oci://registry/chart", "waitTimeout": "soon"},
+			wantErr: true,
+		},
+		{
+			name:    "output without jsonPath",
+			chart:   map[string]any{"url": "oci://registry/chart", "outputs": []any{map[string]any{"name": "endpoint"}}},
+			wantErr: true,
+		},
+		{
+			name:    "wrong type",
+			chart:   map[string]any{"url": "oci://registry/chart", "wait": "yes"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := decodeChartSpec(definition(tt.chart))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, spec)
+			timeout, err := spec.waitTimeout()
+			require.NoError(t, err)
+			assert.Equal(t, tt.timeout, timeout)
+		})
+	}
+}
@@ -5,9 +5,16 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"time"
 
 	compositionMeta "github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/chartversion"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/maintenance"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/outputs"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/rollout"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/valuesfrom"
 
+	"github.com/krateoplatformops/plumbing/env"
 	"github.com/krateoplatformops/unstructured-runtime/pkg/logging"
 	"github.com/krateoplatformops/unstructured-runtime/pkg/pluralizer"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -17,6 +24,10 @@ import (
 	"k8s.io/client-go/rest"
 )
 
+// chartVersionCacheTTL is how long the versions published for a chart are cached
+// when resolving version constraints.
+var chartVersionCacheTTL = env.Duration("CHART_VERSION_CACHE_TTL", 5*time.Minute)
+
 type CompositionDefinitionInfo struct {
 	Namespace string
 	Name      string
@@ -32,9 +43,13 @@ type Info struct {
 	// URL of the helm chart package that is being requested.
 	URL string `json:"url"`
 
-	// Version of the chart release.
+	// Version of the chart release. It is empty when the version constraint has not been resolved,
+	// see Getter.WithoutVersionResolution.
 	Version string `json:"version,omitempty"`
 
+	// VersionConstraint is the semver constraint Version has been resolved from, if any.
+	VersionConstraint string `json:"versionConstraint,omitempty"`
+
 	// Repo is the repository name.
 	Repo string `json:"repo,omitempty"`
 
@@ -44,6 +59,34 @@ type Info struct {
 	// InsecureSkipTLSverify indicates whether to skip TLS verification.
 	InsecureSkipTLSverify bool `json:"insecureSkipTLSverify,omitempty"`
 
+	// SelfHeal indicates whether drifted resources should be re-applied from the release manifest.
+	SelfHeal bool `json:"selfHeal,omitempty"`
+
+	// Wait indicates whether install and upgrade should wait for the resources of the release to be ready.
+	Wait bool `json:"wait,omitempty"`
+
+	// Atomic indicates whether failed upgrades should be rolled back to the last deployed revision.
+	Atomic bool `json:"atomic,omitempty"`
+
+	// Rollout limits how a new chart version is rolled out to the compositions of the definition, if set.
+	Rollout *rollout.Policy `json:"rollout,omitempty"`
+
+	// ValuesFrom lists the ConfigMaps and Secrets, in the namespace of the composition,
+	// whose values are merged under the values of the composition spec.
+	ValuesFrom []valuesfrom.Reference `json:"valuesFrom,omitempty"`
+
+	// Outputs lists the values read from the live objects of the release and published in the composition status.
+	Outputs []outputs.Output `json:"outputs,omitempty"`
+
+	// OutputsSecret indicates whether all the outputs should be mirrored into a Secret.
+	OutputsSecret bool `json:"outputsSecret,omitempty"`
+
+	// MaintenanceWindow restricts upgrades to a recurring time window, if set.
+	MaintenanceWindow *maintenance.Spec `json:"maintenanceWindow,omitempty"`
+
+	// WaitTimeout is how long to wait for the resources of the release to be ready, if set.
+	WaitTimeout time.Duration `json:"waitTimeout,omitempty"`
+
 	// CompositionDefinitionInfo is the information about the composition definition.
 	CompositionDefinitionInfo *CompositionDefinitionInfo `json:"compositionDefinitionInfo,omitempty"`
 }
@@ -61,8 +104,11 @@ func (i *Info) IsHTTP() bool {
 }
 
 type Getter interface {
-	Get(un *unstructured.Unstructured) (*Info, error)
+	Get(ctx context.Context, un *unstructured.Unstructured) (*Info, error)
 	WithLogger(logger logging.Logger) Getter
+	// WithoutVersionResolution returns a Getter that leaves the chart version constraint unresolved,
+	// for the callers that do not need the version (e.g. delete) and must not depend on the registry.
+	WithoutVersionResolution() Getter
 }
 
 func Static(chart string) Getter {
@@ -79,6 +125,7 @@ func Dynamic(cfg *rest.Config, pluralizer pluralizer.PluralizerInterface) (Gette
 		dynamicClient: dyn,
 		logger:        logging.NewNopLogger(),
 		pluralizer:    pluralizer,
+		versions:      chartversion.NewResolver(chartversion.NewLister(), chartVersionCacheTTL),
 	}, nil
 }
 
@@ -94,7 +141,11 @@ func (pig staticGetter) WithLogger(logger logging.Logger) Getter {
 	}
 }
 
-func (pig staticGetter) Get(_ *unstructured.Unstructured) (*Info, error) {
+func (pig staticGetter) WithoutVersionResolution() Getter {
+	return pig
+}
+
+func (pig staticGetter) Get(_ context.Context, _ *unstructured.Unstructured) (*Info, error) {
 	return &Info{
 		URL: pig.chartName,
 	}, nil
@@ -106,6 +157,8 @@ type dynamicGetter struct {
 	dynamicClient dynamic.Interface
 	logger        logging.Logger
 	pluralizer    pluralizer.PluralizerInterface
+	versions      *chartversion.Resolver
+	skipVersions  bool
 }
 
 func (g *dynamicGetter) WithLogger(logger logging.Logger) Getter {
@@ -116,10 +169,22 @@ func (g *dynamicGetter) WithLogger(logger logging.Logger) Getter {
 		dynamicClient: g.dynamicClient,
 		logger:        logger,
 		pluralizer:    g.pluralizer,
+		versions:      g.versions,
+		skipVersions:  g.skipVersions,
+	}
+}
+
+func (g *dynamicGetter) WithoutVersionResolution() Getter {
+	return &dynamicGetter{
+		dynamicClient: g.dynamicClient,
+		logger:        g.logger,
+		pluralizer:    g.pluralizer,
+		versions:      g.versions,
+		skipVersions:  true,
 	}
 }
 
-func (g *dynamicGetter) Get(uns *unstructured.Unstructured) (*Info, error) {
+func (g *dynamicGetter) Get(ctx context.Context, uns *unstructured.Unstructured) (*Info, error) {
 	if uns == nil {
 		return nil, fmt.Errorf("unstructured object is nil")
 	}
@@ -164,7 +229,7 @@ func (g *dynamicGetter) Get(uns *unstructured.Unstructured) (*Info, error) {
 		g.logger.Debug("Getting composition definition", "compositionDefinitionName", cdInfo.Name, "compositionDefinitionNamespace", cdInfo.Namespace, "compositionDefinitionGVR", cdInfo.GVR.String())
 		compositionDefinition, err = g.dynamicClient.Resource(cdInfo.GVR).
 			Namespace(cdInfo.Namespace).
-			Get(context.Background(), cdInfo.Name, metav1.GetOptions{})
+			Get(ctx, cdInfo.Name, metav1.GetOptions{})
 		if err != nil {
 			g.logger.Warn("Error getting composition definition", "error", err.Error(), "compositionDefinitionName", cdInfo.Name, "compositionDefinitionNamespace", cdInfo.Namespace, "gvr", cdInfo.GVR.String())
 			compositionDefinition = nil
@@ -184,63 +249,68 @@ func (g *dynamicGetter) Get(uns *unstructured.Unstructured) (*Info, error) {
 	if compositionDefinition == nil {
 		// Search for the composition definition in the namespace of the unstructured object
 		g.logger.Debug("Searching for composition definition")
-		compositionDefinition, err = g.searchCompositionDefinition(gvr, uns)
+		compositionDefinition, err = g.searchCompositionDefinition(ctx, gvr, uns)
 		if err != nil {
 			return nil, fmt.Errorf("error searching for composition definition in namespace '%s': %w", uns.GetNamespace(), err)
 		}
 	}
 
-	packageUrl, ok, err := unstructured.NestedString(compositionDefinition.UnstructuredContent(), "spec", "chart", "url")
+	chart, err := decodeChartSpec(compositionDefinition)
 	if err != nil {
-		g.logger.Debug("Failed to resolve 'status.packageUrl'", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
+		g.logger.Debug("Failed to resolve 'spec.chart'", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
 		return nil, err
 	}
-	if !ok {
+	waitTimeout, _ := chart.waitTimeout()
+	packageUrl, packageVersion, repo := chart.URL, chart.Version, chart.Repo
+	if packageUrl == "" {
 		return nil,
 			fmt.Errorf("missing 'status.packageUrl' in definition for '%v' in namespace: %s", gvr, uns.GetNamespace())
 	}
 
 	g.logger.Debug("PackageUrl for", "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace(), "url", packageUrl)
 
-	packageVersion, _, err := unstructured.NestedString(compositionDefinition.UnstructuredContent(), "spec", "chart", "version")
-	if err != nil {
-		g.logger.Debug("Failed to resolve 'spec.chart.version'", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
-		return nil, err
+	var username, password string
+	if chart.Credentials != nil {
+		username = chart.Credentials.Username
 	}
-	repo, _, err := unstructured.NestedString(compositionDefinition.UnstructuredContent(), "spec", "chart", "repo")
-	if err != nil {
-		g.logger.Debug("Failed to resolve 'spec.chart.repo'", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
-		return nil, err
+	if chart.Credentials != nil && chart.Credentials.PasswordRef != nil {
+		ref := chart.Credentials.PasswordRef
+		password, err = GetSecret(ctx, g.dynamicClient, SecretKeySelector{
+			Name:      ref.Name,
+			Namespace: ref.Namespace,
+			Key:       ref.Key,
+		})
+		if err != nil {
+			g.logger.Debug("Failed to resolve secret", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
+			return nil, err
+		}
 	}
 
-	username, _, err := unstructured.NestedString(compositionDefinition.UnstructuredContent(), "spec", "chart", "credentials", "username")
-	if err != nil {
-		g.logger.Debug("Failed to resolve 'spec.chart.credentials.username'", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
-		return nil, err
+	// A constraint on the composition takes precedence over the version of the definition,
+	// which can be a constraint itself (e.g. "~1.1") unless the chart is a plain archive
+	var versionConstraint string
+	if packageVersion != "" && !chartversion.IsExact(packageVersion) && !strings.HasSuffix(packageUrl, ".tgz") {
+		versionConstraint = packageVersion
 	}
-
-	passwordRef, _, err := unstructured.NestedStringMap(compositionDefinition.UnstructuredContent(), "spec", "chart", "credentials", "passwordRef")
-	if err != nil {
-		g.logger.Debug("Failed to resolve 'spec.chart.credentials.passwordRef'", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
-		return nil, err
+	if constraint, ok := compositionMeta.GetChartVersionConstraint(uns); ok {
+		versionConstraint = constraint
 	}
-
-	var password string
-	if passwordRef != nil {
-		password, err = GetSecret(context.Background(), g.dynamicClient, SecretKeySelector{
-			Name:      passwordRef["name"],
-			Namespace: passwordRef["namespace"],
-			Key:       passwordRef["key"],
-		})
+	if versionConstraint != "" && g.skipVersions {
+		g.logger.Debug("Chart version constraint left unresolved", "constraint", versionConstraint)
+		packageVersion = ""
+	} else if versionConstraint != "" {
+		packageVersion, err = g.versions.Resolve(ctx, chartversion.Source{
+			URL:                   packageUrl,
+			Repo:                  repo,
+			Username:              username,
+			Password:              password,
+			InsecureSkipTLSverify: chart.InsecureSkipTLSverify,
+		}, versionConstraint)
 		if err != nil {
-			g.logger.Debug("Failed to resolve secret", "error", err.Error(), "compositionDefinitionName", passwordRef["compositionDefinitionName"], "compositionDefinitionNamespace", passwordRef["compositionDefinitionNamespace"])
-			return nil, err
+			g.logger.Debug("Failed to resolve chart version constraint", "error", err.Error(), "constraint", versionConstraint, "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
+			return nil, fmt.Errorf("resolving chart version constraint %q: %w", versionConstraint, err)
 		}
-	}
-	insecureSkipTLSverify, _, err := unstructured.NestedBool(compositionDefinition.UnstructuredContent(), "spec", "chart", "insecureSkipTLSverify")
-	if err != nil {
-		g.logger.Debug("Failed to resolve 'spec.chart.insecureSkipTLSverify'", "error", err.Error(), "compositionDefinitionName", compositionDefinition.GetName(), "compositionDefinitionNamespace", compositionDefinition.GetNamespace())
-		return nil, err
+		g.logger.Debug("Resolved chart version constraint", "constraint", versionConstraint, "version", packageVersion)
 	}
 
 	compositionDefinitionGVR, err := g.pluralizer.GVKtoGVR(compositionDefinition.GroupVersionKind())
@@ -250,14 +320,24 @@ func (g *dynamicGetter) Get(uns *unstructured.Unstructured) (*Info, error) {
 	}
 
 	return &Info{
-		URL:     packageUrl,
-		Version: packageVersion,
-		Repo:    repo,
+		URL:               packageUrl,
+		Version:           packageVersion,
+		VersionConstraint: versionConstraint,
+		Repo:              repo,
 		Auth: &Auth{
 			Username: username,
 			Password: password,
 		},
-		InsecureSkipTLSverify: insecureSkipTLSverify,
+		InsecureSkipTLSverify: chart.InsecureSkipTLSverify,
+		SelfHeal:              chart.SelfHeal,
+		Wait:                  chart.Wait,
+		WaitTimeout:           waitTimeout,
+		Atomic:                chart.Atomic,
+		Rollout:               chart.Rollout,
+		MaintenanceWindow:     chart.MaintenanceWindow,
+		ValuesFrom:            chart.ValuesFrom,
+		Outputs:               chart.Outputs,
+		OutputsSecret:         chart.OutputsSecret,
 		CompositionDefinitionInfo: &CompositionDefinitionInfo{
 			Name:      compositionDefinition.GetName(),
 			Namespace: compositionDefinition.GetNamespace(),
@@ -295,14 +375,14 @@ func GetSecret(ctx context.Context, client dynamic.Interface, secretKeySelector
 	return string(bkey), nil
 }
 
-func (g *dynamicGetter) searchCompositionDefinition(gvr schema.GroupVersionResource, mg *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+func (g *dynamicGetter) searchCompositionDefinition(ctx context.Context, gvr schema.GroupVersionResource, mg *unstructured.Unstructured) (*unstructured.Unstructured, error) {
 	gvrForDefinitions := schema.GroupVersionResource{
 		Group:    "core.krateo.io",
 		Version:  "v1alpha1",
 		Resource: "compositiondefinitions",
 	}
 	all, err := g.dynamicClient.Resource(gvrForDefinitions).
-		List(context.Background(), metav1.ListOptions{})
+		List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -266,7 +266,7 @@ func testGetterFunctionality(ctx context.Context, t *testing.T, c *envconf.Confi
 			require.NoError(t, err, "Should be able to create dynamic getter")
 
 			// Test the getter
-			info, err := gt.Get(uns)
+			info, err := gt.Get(context.Background(), uns)
 
 			if tt.expectError {
 				assert.Error(t, err, "Should return an error")
@@ -342,7 +342,7 @@ func testStaticGetter(ctx context.Context, t *testing.T, c *envconf.Config) cont
 			require.NotNil(t, getter, "Static getter should not be nil")
 
 			// Test with empty unstructured (static getter ignores input)
-			info, err := getter.Get(&unstructured.Unstructured{})
+			info, err := getter.Get(context.Background(), &unstructured.Unstructured{})
 			require.NoError(t, err, "Static getter should not return error")
 			require.NotNil(t, info, "Info should not be nil")
 
@@ -420,7 +420,7 @@ func testErrorConditions(ctx context.Context, t *testing.T, c *envconf.Config) c
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			info, err := getter.Get(tc.composition)
+			info, err := getter.Get(context.Background(), tc.composition)
 
 			if tc.expectError {
 				assert.Error(t, err, "Should return an error for %s", tc.name)
@@ -443,7 +443,7 @@ func testEdgeCases(ctx context.Context, t *testing.T, c *envconf.Config) context
 
 	// Test with nil input
 	t.Run("nil_input", func(t *testing.T) {
-		info, err := getter.Get(nil)
+		info, err := getter.Get(context.Background(), nil)
 		assert.Error(t, err, "Should return error for nil input")
 		assert.Nil(t, info, "Info should be nil for nil input")
 	})
@@ -451,7 +451,7 @@ func testEdgeCases(ctx context.Context, t *testing.T, c *envconf.Config) context
 	// Test with empty unstructured
 	t.Run("empty_unstructured", func(t *testing.T) {
 		empty := &unstructured.Unstructured{}
-		info, err := getter.Get(empty)
+		info, err := getter.Get(context.Background(), empty)
 		assert.Error(t, err, "Should return error for empty unstructured")
 		assert.Nil(t, info, "Info should be nil for empty unstructured")
 	})
@@ -0,0 +1,254 @@
+package chartversion
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/krateoplatformops/plumbing/helm/getter"
+	"github.com/krateoplatformops/plumbing/helm/getter/repo"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// Source is the chart whose published versions are looked up.
+type Source struct {
+	// URL is the HTTP repository or the OCI reference of the chart.
+	URL string
+	// Repo is the name of the chart in the repository.
+	Repo                  string
+	Username              string
+	Password              string
+	InsecureSkipTLSverify bool
+}
+
+// Lister lists the versions of a chart published in a repository.
+type Lister interface {
+	List(ctx context.Context, src Source) ([]string, error)
+}
+
+// IsExact reports whether the version is an exact semantic version rather than a constraint.
+func IsExact(version string) bool {
+	_, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+	return err == nil
+}
+
+// Resolver resolves version constraints to the highest published version that satisfies them.
+// The versions published for a chart are cached for the configured TTL, so that the repository
+// is not looked up on every reconciliation. The cache is keyed by the chart and the user reading
+// it, passwords are not kept as keys.
+type Resolver struct {
+	lister Lister
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[cacheKey]cacheEntry
+}
+
+type cacheKey struct {
+	url                   string
+	repo                  string
+	username              string
+	insecureSkipTLSverify bool
+}
+
+type cacheEntry struct {
+	versions []string
+	expires  time.Time
+}
+
+// NewResolver returns a Resolver listing the versions with the given lister.
+// A TTL lower or equal to zero disables the cache.
+func NewResolver(lister Lister, ttl time.Duration) *Resolver {
+	return &Resolver{
+		lister: lister,
+		ttl:    ttl,
+		now:    time.Now,
+		cache:  map[cacheKey]cacheEntry{},
+	}
+}
+
+// Resolve returns the highest version of the chart that satisfies the constraint.
+// Exact versions are returned as they are, without looking up the repository.
+func (r *Resolver) Resolve(ctx context.Context, src Source, constraint string) (string, error) {
+	if IsExact(constraint) {
+		return constraint, nil
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+
+	versions, err := r.versions(ctx, src)
+	if err != nil {
+		return "", fmt.Errorf("listing versions of chart %s: %w", chartRef(src), err)
+	}
+	return highest(c, versions, constraint)
+}
+
+// versions returns the versions published for the chart, from the cache while they are fresh.
+func (r *Resolver) versions(ctx context.Context, src Source) ([]string, error) {
+	if r.ttl <= 0 {
+		return r.lister.List(ctx, src)
+	}
+
+	key := cacheKey{
+		url:                   src.URL,
+		repo:                  src.Repo,
+		username:              src.Username,
+		insecureSkipTLSverify: src.InsecureSkipTLSverify,
+	}
+	r.mu.Lock()
+	entry, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && r.now().Before(entry.expires) {
+		return entry.versions, nil
+	}
+
+	versions, err := r.lister.List(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.cache[key] = cacheEntry{versions: versions, expires: r.now().Add(r.ttl)}
+	r.mu.Unlock()
+	return versions, nil
+}
+
+// highest returns the highest version satisfying the constraint, as it is published.
+// Versions that are not semantic versions are ignored.
+func highest(c *semver.Constraints, versions []string, constraint string) (string, error) {
+	var best *semver.Version
+	var bestRaw string
+	for _, raw := range versions {
+		v, err := semver.NewVersion(raw)
+		if err != nil || !c.Check(v) {
+			continue
+		}
+		if best == nil || v.GreaterThan(best) {
+			best, bestRaw = v, raw
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no published version satisfies constraint %q", constraint)
+	}
+	return bestRaw, nil
+}
+
+func chartRef(src Source) string {
+	if src.Repo == "" {
+		return src.URL
+	}
+	return strings.TrimSuffix(src.URL, "/") + "/" + src.Repo
+}
+
+// NewLister returns a Lister reading the index.yaml of HTTP repositories and the tags of OCI repositories.
+func NewLister() Lister {
+	return &registryLister{timeout: 30 * time.Second}
+}
+
+type registryLister struct {
+	timeout time.Duration
+}
+
+func (l *registryLister) List(ctx context.Context, src Source) ([]string, error) {
+	switch {
+	case strings.HasPrefix(src.URL, "oci://"):
+		return l.listTags(ctx, src)
+	case strings.HasSuffix(src.URL, ".tgz"):
+		return nil, fmt.Errorf("version constraints are not supported for chart archives")
+	case strings.HasPrefix(src.URL, "http://") || strings.HasPrefix(src.URL, "https://"):
+		return l.listIndex(ctx, src)
+	}
+	return nil, fmt.Errorf("unsupported chart url %q", src.URL)
+}
+
+func (l *registryLister) httpClient(insecure bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &http.Client{Transport: transport, Timeout: l.timeout}
+}
+
+// listIndex reads the versions of the chart from the index.yaml of the HTTP repository.
+func (l *registryLister) listIndex(ctx context.Context, src Source) ([]string, error) {
+	uri := strings.TrimSuffix(src.URL, "/") + "/index.yaml"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request for %s: %w", uri, err)
+	}
+	if src.Username != "" && src.Password != "" {
+		req.SetBasicAuth(src.Username, src.Password)
+	}
+
+	resp, err := l.httpClient(src.InsecureSkipTLSverify).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", uri, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", uri, resp.Status)
+	}
+
+	idx, err := repo.Load(io.LimitReader(resp.Body, getter.MaxResponseSize), uri, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", uri, err)
+	}
+	entries, ok := idx.Entries[src.Repo]
+	if !ok {
+		return nil, fmt.Errorf("chart %q not found in %s", src.Repo, uri)
+	}
+	versions := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e != nil && e.Metadata != nil {
+			versions = append(versions, e.Version)
+		}
+	}
+	return versions, nil
+}
+
+// listTags reads the tags of the OCI repository of the chart. OCI tags cannot contain '+', so Helm
+// pushes the build metadata of a version with '_' instead, which is translated back here.
+func (l *registryLister) listTags(ctx context.Context, src Source) ([]string, error) {
+	ref := strings.TrimPrefix(chartRef(src), "oci://")
+	r, err := remote.NewRepository(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository reference %q: %w", ref, err)
+	}
+	registry := strings.ToLower(r.Reference.Registry)
+	r.PlainHTTP = strings.HasPrefix(registry, "localhost") || strings.HasPrefix(registry, "127.0.0.1") || strings.HasPrefix(registry, "[::1]")
+
+	client := &auth.Client{
+		Client: l.httpClient(src.InsecureSkipTLSverify),
+		Cache:  auth.NewCache(),
+	}
+	if src.Username != "" && src.Password != "" {
+		client.Credential = auth.StaticCredential(r.Reference.Registry, auth.Credential{
+			Username: src.Username,
+			Password: src.Password,
+		})
+	}
+	r.Client = client
+
+	var tags []string
+	err = r.Tags(ctx, "", func(page []string) error {
+		for _, tag := range page {
+			tags = append(tags, strings.ReplaceAll(tag, "_", "+"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing tags of %s: %w", ref, err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,183 @@
+package chartversion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLister struct {
+	versions []string
+	calls    int
+}
+
+func (f *fakeLister) List(_ context.Context, _ Source) ([]string, error) {
+	f.calls++
+	return f.versions, nil
+}
+
+func TestIsExact(t *testing.T) {
+	tests := []struct {
+		version string
+		exact   bool
+	}{
+		{version: "1.2.3", exact: true},
+		{version: "v1.2.3", exact: true},
+		{version: "1.2.3-rc.1", exact: true},
+		{version: "1.2", exact: false},
+		{version: "~1.2", exact: false},
+		{version: ">=1.2 <1.3", exact: false},
+		{version: "", exact: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			assert.Equal(t, tt.exact, IsExact(tt.version))
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	lister := &fakeLister{versions: []string{"1.1.0", "1.2.0", "1.2.7", "v1.2.9", "1.3.0-rc.1", "1.3.0", "2.0.0", "latest"}}
+
+	tests := []struct {
+		name       string
+		constraint string
+		expected   string
+		err        string
+	}{
+		{name: "range", constraint: ">=1.2 <1.3", expected: "v1.2.9"},
+		{name: "tilde", constraint: "~1.2", expected: "v1.2.9"},
+		{name: "caret", constraint: "^1.0", expected: "1.3.0"},
+		{name: "wildcard", constraint: "1.1.x", expected: "1.1.0"},
+		{name: "exact", constraint: "1.0.0", expected: "1.0.0"},
+		{name: "no match", constraint: "^3.0", err: `no published version satisfies constraint "^3.0"`},
+		{name: "invalid", constraint: "one point two", err: `invalid version constraint "one point two"`},
+	}
+
+	r := NewResolver(lister, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(context.Background(), Source{URL: "https://charts.example.com", Repo: "demo"}, tt.constraint)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestResolve_Cache(t *testing.T) {
+	lister := &fakeLister{versions: []string{"1.1.0", "1.1.3"}}
+	now := time.Date(2025, 3, 8, 10, 0, 0, 0, time.UTC)
+
+	r := NewResolver(lister, 5*time.Minute)
+	r.now = func() time.Time { return now }
+	src := Source{URL: "https://charts.example.com", Repo: "demo"}
+
+	got, err := r.Resolve(context.Background(), src, "~1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.3", got)
+
+	// A new patch release is not seen until the cached versions expire
+	lister.versions = append(lister.versions, "1.1.4")
+	got, err = r.Resolve(context.Background(), src, "^1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.3", got)
+	assert.Equal(t, 1, lister.calls)
+
+	// A rotated password reuses the cached versions of the same user
+	_, err = r.Resolve(context.Background(), Source{URL: "https://charts.example.com", Repo: "demo", Password: "rotated"}, "~1.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, lister.calls)
+
+	// Other charts are looked up on their own
+	_, err = r.Resolve(context.Background(), Source{URL: "https://charts.example.com", Repo: "other"}, "~1.1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, lister.calls)
+
+	now = now.Add(5 * time.Minute)
+	got, err = r.Resolve(context.Background(), src, "~1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.4", got)
+	assert.Equal(t, 3, lister.calls)
+
+	// Exact versions never look up the repository
+	got, err = r.Resolve(context.Background(), src, "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", got)
+	assert.Equal(t, 3, lister.calls)
+}
+
+func TestRegistryLister_Index(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/index.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "user" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `apiVersion: v1
+entries:
+  demo:
+  - name: demo
+    version: 1.2.0
+  - name: demo
+    version: 1.10.0
+  other:
+  - name: other
+    version: 9.9.9
+`)
+	}))
+	defer srv.Close()
+
+	l := NewLister()
+	versions, err := l.List(context.Background(), Source{URL: srv.URL + "/", Repo: "demo", Username: "user", Password: "secret"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1.2.0", "1.10.0"}, versions)
+
+	_, err = l.List(context.Background(), Source{URL: srv.URL, Repo: "missing", Username: "user", Password: "secret"})
+	assert.ErrorContains(t, err, `chart "missing" not found`)
+
+	_, err = l.List(context.Background(), Source{URL: srv.URL, Repo: "demo"})
+	assert.ErrorContains(t, err, "401")
+}
+
+func TestRegistryLister_Tags(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/charts/demo/tags/list" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"name": "charts/demo",
+			"tags": []string{"1.0.0", "1.1.0", "1.1.0_build.2", "latest"},
+		})
+	}))
+	defer srv.Close()
+
+	host := strings.TrimPrefix(srv.URL, "http://")
+	versions, err := NewLister().List(context.Background(), Source{URL: "oci://" + host + "/charts", Repo: "demo"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.0.0", "1.1.0", "1.1.0+build.2", "latest"}, versions)
+}
+
+func TestRegistryLister_Unsupported(t *testing.T) {
+	_, err := NewLister().List(context.Background(), Source{URL: "https://charts.example.com/demo-1.0.0.tgz"})
+	assert.ErrorContains(t, err, "not supported for chart archives")
+}
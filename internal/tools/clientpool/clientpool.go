@@ -0,0 +1,280 @@
+package clientpool
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	helm "github.com/krateoplatformops/plumbing/helm/v3"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/storage"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// maxIdlePerNamespace bounds the Helm clients kept idle for a namespace and verbosity, roughly the
+// number of workers that may reconcile compositions of the same namespace at the same time.
+const maxIdlePerNamespace = 4
+
+// ReleaseStore returns the Helm release storage of a namespace.
+type ReleaseStore interface {
+	Releases(namespace string) (*storage.Storage, error)
+}
+
+// Pool shares the Kubernetes and Helm clients of the composition handler across reconciles.
+//
+// The dynamic client and the Helm release storage of each namespace are safe for concurrent use and
+// are built once. Helm clients are bound to a
+// namespace and keep state between actions, Helm caches the capabilities of the cluster in its
+// action configuration, so each one is leased to a single reconcile at a time and given back when
+// done. Idle clients are recycled once older than the TTL, so that charts checking .Capabilities
+// eventually see the API versions installed in the meantime. A zero TTL disables the reuse of
+// Helm clients. Helm clients log the actions only for verbose compositions, so the idle ones are
+// kept apart by verbosity.
+type Pool struct {
+	cfg     *rest.Config
+	ttl     time.Duration
+	newHelm func(namespace string, verbose bool) (helmconfig.Client, error)
+	now     func() time.Time
+
+	dynMu sync.Mutex
+	dyn   dynamic.Interface
+
+	storesMu sync.Mutex
+	stores   map[string]*storage.Storage
+
+	mu   sync.Mutex
+	idle map[helmKey][]*entry
+}
+
+type helmKey struct {
+	namespace string
+	verbose   bool
+}
+
+type entry struct {
+	client  helmconfig.Client
+	created time.Time
+}
+
+// New returns a pool of clients built with the config. The client-side rate limit of the config applies
+// to each shared client, hence to the requests of all the reconciles together.
+func New(cfg *rest.Config, ttl time.Duration) *Pool {
+	cfg = rest.CopyConfig(cfg)
+	return &Pool{
+		cfg: cfg,
+		ttl: ttl,
+		newHelm: func(namespace string, verbose bool) (helmconfig.Client, error) {
+			return helm.NewClient(cfg, helm.WithNamespace(namespace), helm.WithLogger(helmLog(verbose)), helm.WithCache())
+		},
+		now:    time.Now,
+		stores: map[string]*storage.Storage{},
+		idle:   map[helmKey][]*entry{},
+	}
+}
+
+// Dynamic returns the dynamic client shared by every reconcile.
+func (p *Pool) Dynamic() (dynamic.Interface, error) {
+	p.dynMu.Lock()
+	defer p.dynMu.Unlock()
+
+	if p.dyn == nil {
+		dyn, err := dynamic.NewForConfig(p.cfg)
+		if err != nil {
+			return nil, err
+		}
+		p.dyn = dyn
+	}
+	return p.dyn, nil
+}
+
+// WithDynamic makes the pool share the given dynamic client instead of building one from the config.
+func (p *Pool) WithDynamic(dyn dynamic.Interface) *Pool {
+	p.dynMu.Lock()
+	defer p.dynMu.Unlock()
+	p.dyn = dyn
+	return p
+}
+
+// Releases returns the Helm release storage of the namespace, for the lookups that only read or rewrite
+// release records. The storage driver is selected with the HELM_DRIVER environment variable, as the
+// Helm client does.
+func (p *Pool) Releases(namespace string) (*storage.Storage, error) {
+	p.storesMu.Lock()
+	defer p.storesMu.Unlock()
+
+	if store, ok := p.stores[namespace]; ok {
+		return store, nil
+	}
+	actionConfig := new(action.Configuration)
+	err := actionConfig.Init(helm.NewRESTClientGetter(namespace, nil, p.cfg), namespace, os.Getenv("HELM_DRIVER"), debugLog)
+	if err != nil {
+		return nil, fmt.Errorf("initializing helm action config: %w", err)
+	}
+	p.stores[namespace] = actionConfig.Releases
+	return actionConfig.Releases, nil
+}
+
+func debugLog(format string, v ...interface{}) {
+	slog.Debug(fmt.Sprintf(format, v...))
+}
+
+// helmLog returns the logger of the Helm actions, which are only logged for verbose compositions.
+func helmLog(verbose bool) func(format string, v ...interface{}) {
+	if verbose {
+		return debugLog
+	}
+	return func(format string, v ...interface{}) {}
+}
+
+// Helm leases a Helm client bound to the namespace, reusing an idle one of the same verbosity when
+// available. The lease must be released once the reconcile is done with it.
+func (p *Pool) Helm(namespace string, verbose bool) (*Lease, error) {
+	now := p.now()
+	key := helmKey{namespace: namespace, verbose: verbose}
+
+	p.mu.Lock()
+	var reused *entry
+	idle := p.idle[key]
+	for len(idle) > 0 && reused == nil {
+		last := idle[len(idle)-1]
+		idle = idle[:len(idle)-1]
+		if p.expired(last, now) {
+			last.client.Close()
+			continue
+		}
+		reused = last
+	}
+	p.setIdle(key, idle)
+	p.mu.Unlock()
+
+	if reused != nil {
+		return &Lease{Client: reused.client, pool: p, key: key, created: reused.created}, nil
+	}
+
+	hc, err := p.newHelm(namespace, verbose)
+	if err != nil {
+		return nil, fmt.Errorf("creating helm client: %w", err)
+	}
+	return &Lease{Client: hc, pool: p, key: key, created: now}, nil
+}
+
+// Idle returns the number of idle Helm clients.
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, idle := range p.idle {
+		n += len(idle)
+	}
+	return n
+}
+
+// Invalidate discards the idle Helm clients of the namespace.
+func (p *Pool) Invalidate(namespace string) {
+	p.mu.Lock()
+	var idle []*entry
+	for _, verbose := range []bool{false, true} {
+		key := helmKey{namespace: namespace, verbose: verbose}
+		idle = append(idle, p.idle[key]...)
+		delete(p.idle, key)
+	}
+	p.mu.Unlock()
+
+	for _, e := range idle {
+		e.client.Close()
+	}
+}
+
+// Close discards every idle Helm client.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = map[helmKey][]*entry{}
+	p.mu.Unlock()
+
+	for _, entries := range idle {
+		for _, e := range entries {
+			e.client.Close()
+		}
+	}
+}
+
+func (p *Pool) giveBack(key helmKey, e *entry) {
+	now := p.now()
+	if p.expired(e, now) {
+		e.client.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Sweep the namespaces not reconciled since their clients expired
+	for k, idle := range p.idle {
+		kept := idle[:0]
+		for _, i := range idle {
+			if p.expired(i, now) {
+				i.client.Close()
+				continue
+			}
+			kept = append(kept, i)
+		}
+		p.setIdle(k, kept)
+	}
+
+	idle := p.idle[key]
+	if len(idle) >= maxIdlePerNamespace {
+		e.client.Close()
+		return
+	}
+	p.idle[key] = append(idle, e)
+}
+
+func (p *Pool) expired(e *entry, now time.Time) bool {
+	return p.ttl <= 0 || now.Sub(e.created) >= p.ttl
+}
+
+func (p *Pool) setIdle(key helmKey, idle []*entry) {
+	if len(idle) == 0 {
+		delete(p.idle, key)
+		return
+	}
+	p.idle[key] = idle
+}
+
+// Lease is a Helm client leased to a single reconcile.
+type Lease struct {
+	helmconfig.Client
+
+	pool     *Pool
+	key      helmKey
+	created  time.Time
+	discard  bool
+	released bool
+}
+
+// Invalidate discards the client, and the idle clients of its namespace, instead of giving it back
+// on release. It is meant for failed actions whose cause may be a stale state of the client.
+func (l *Lease) Invalidate() {
+	l.discard = true
+}
+
+// Release gives the client back to the pool. Releasing a lease more than once has no effect.
+func (l *Lease) Release() {
+	if l.released {
+		return
+	}
+	l.released = true
+
+	if l.discard {
+		l.pool.Invalidate(l.key.namespace)
+		l.Client.Close()
+		return
+	}
+	l.pool.giveBack(l.key, &entry{client: l.Client, created: l.created})
+}
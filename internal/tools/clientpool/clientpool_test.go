@@ -0,0 +1,304 @@
+package clientpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+	helm "github.com/krateoplatformops/plumbing/helm/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+type fakeHelmClient struct {
+	helmconfig.Client
+	namespace string
+	verbose   bool
+	closed    int
+}
+
+func (f *fakeHelmClient) Close() error {
+	f.closed++
+	return nil
+}
+
+func newTestPool(ttl time.Duration) (*Pool, *[]*fakeHelmClient, *time.Time) {
+	created := []*fakeHelmClient{}
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	p := New(&rest.Config{Host: "https://127.0.0.1:6443"}, ttl)
+	p.now = func() time.Time { return now }
+	p.newHelm = func(namespace string, verbose bool) (helmconfig.Client, error) {
+		hc := &fakeHelmClient{namespace: namespace, verbose: verbose}
+		created = append(created, hc)
+		return hc, nil
+	}
+	return p, &created, &now
+}
+
+func TestPoolHelm(t *testing.T) {
+	t.Run("reuses released clients of the namespace", func(t *testing.T) {
+		p, created, _ := newTestPool(time.Minute)
+
+		first, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		first.Release()
+		first.Release()
+		assert.Equal(t, 1, p.Idle())
+
+		second, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		other, err := p.Helm("other", false)
+		require.NoError(t, err)
+
+		assert.Same(t, first.Client, second.Client)
+		assert.Len(t, *created, 2)
+		assert.Equal(t, "other", other.Client.(*fakeHelmClient).namespace)
+		assert.Zero(t, p.Idle())
+	})
+
+	t.Run("keeps the clients of verbose compositions apart", func(t *testing.T) {
+		p, created, _ := newTestPool(time.Minute)
+
+		quiet, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		quiet.Release()
+
+		verbose, err := p.Helm("demo-system", true)
+		require.NoError(t, err)
+		assert.NotSame(t, quiet.Client, verbose.Client)
+		assert.True(t, verbose.Client.(*fakeHelmClient).verbose)
+		verbose.Release()
+		assert.Len(t, *created, 2)
+		assert.Equal(t, 2, p.Idle())
+
+		p.Invalidate("demo-system")
+		assert.Zero(t, p.Idle())
+	})
+
+	t.Run("never leases a client twice at the same time", func(t *testing.T) {
+		p, created, _ := newTestPool(time.Minute)
+
+		first, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		second, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+
+		assert.NotSame(t, first.Client, second.Client)
+		assert.Len(t, *created, 2)
+	})
+
+	t.Run("recycles expired clients", func(t *testing.T) {
+		p, created, now := newTestPool(time.Minute)
+
+		first, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		stale, err := p.Helm("other", false)
+		require.NoError(t, err)
+		stale.Release()
+		*now = now.Add(30 * time.Second)
+		first.Release()
+		assert.Equal(t, 2, p.Idle())
+
+		*now = now.Add(45 * time.Second)
+		second, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		assert.NotSame(t, first.Client, second.Client)
+		assert.Equal(t, 1, (*created)[0].closed)
+
+		// The idle client of the other namespace expired as well and is swept
+		second.Release()
+		assert.Equal(t, 1, (*created)[1].closed)
+		assert.Equal(t, 1, p.Idle())
+	})
+
+	t.Run("discards invalidated clients", func(t *testing.T) {
+		p, created, _ := newTestPool(time.Minute)
+
+		idle, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		failed, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		idle.Release()
+
+		failed.Invalidate()
+		failed.Release()
+		assert.Zero(t, p.Idle())
+		for _, hc := range *created {
+			assert.Equal(t, 1, hc.closed)
+		}
+	})
+
+	t.Run("bounds the idle clients of a namespace", func(t *testing.T) {
+		p, created, _ := newTestPool(time.Minute)
+
+		leases := make([]*Lease, 0, maxIdlePerNamespace+1)
+		for range maxIdlePerNamespace + 1 {
+			l, err := p.Helm("demo-system", false)
+			require.NoError(t, err)
+			leases = append(leases, l)
+		}
+		for _, l := range leases {
+			l.Release()
+		}
+		assert.Equal(t, maxIdlePerNamespace, p.Idle())
+		assert.Equal(t, 1, (*created)[maxIdlePerNamespace].closed)
+	})
+
+	t.Run("zero ttl disables reuse", func(t *testing.T) {
+		p, created, _ := newTestPool(0)
+
+		first, err := p.Helm("demo-system", false)
+		require.NoError(t, err)
+		first.Release()
+		assert.Zero(t, p.Idle())
+		assert.Equal(t, 1, (*created)[0].closed)
+	})
+
+	t.Run("creation error", func(t *testing.T) {
+		p, _, _ := newTestPool(time.Minute)
+		p.newHelm = func(string, bool) (helmconfig.Client, error) { return nil, errors.New("boom") }
+
+		_, err := p.Helm("demo-system", false)
+		assert.EqualError(t, err, "creating helm client: boom")
+	})
+}
+
+func TestPoolDynamic(t *testing.T) {
+	p := New(&rest.Config{Host: "https://127.0.0.1:6443"}, time.Minute)
+
+	first, err := p.Dynamic()
+	require.NoError(t, err)
+	second, err := p.Dynamic()
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+}
+
+func TestPoolReleases(t *testing.T) {
+	t.Setenv("HELM_DRIVER", "memory")
+	p := New(&rest.Config{Host: "https://127.0.0.1:6443"}, time.Minute)
+
+	first, err := p.Releases("demo-system")
+	require.NoError(t, err)
+	second, err := p.Releases("demo-system")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	other, err := p.Releases("other")
+	require.NoError(t, err)
+	assert.NotSame(t, first, other)
+
+	t.Setenv("HELM_DRIVER", "unknown")
+	_, err = p.Releases("unknown")
+	assert.Error(t, err)
+}
+
+// newAPIServer returns a minimal API server, serving an empty Helm release storage and a chart
+// with a single ConfigMap, and the number of API requests it received.
+func newAPIServer(b *testing.B) (*rest.Config, string, *atomic.Int64) {
+	b.Helper()
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "demo", Version: "1.0.0"},
+		Templates: []*chart.File{
+			{Name: "templates/configmap.yaml", Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: demo\ndata:\n  key: value\n")},
+		},
+	}
+	archive, err := chartutil.Save(ch, b.TempDir())
+	require.NoError(b, err)
+	tgz, err := os.ReadFile(archive)
+	require.NoError(b, err)
+
+	calls := &atomic.Int64{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/charts/demo-1.0.0.tgz" {
+			w.Write(tgz)
+			return
+		}
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/version":
+			fmt.Fprint(w, `{"major":"1","minor":"33","gitVersion":"v1.33.0"}`)
+		case "/api":
+			fmt.Fprint(w, `{"kind":"APIVersions","versions":["v1"],"serverAddressByClientCIDRs":[]}`)
+		case "/apis":
+			fmt.Fprint(w, `{"kind":"APIGroupList","apiVersion":"v1","groups":[]}`)
+		case "/api/v1":
+			fmt.Fprint(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[`+
+				`{"name":"configmaps","singularName":"configmap","namespaced":true,"kind":"ConfigMap","verbs":["get","list","create"]},`+
+				`{"name":"secrets","singularName":"secret","namespaced":true,"kind":"Secret","verbs":["get","list","create"]}]}`)
+		case "/api/v1/namespaces/demo-system/secrets":
+			fmt.Fprint(w, `{"kind":"SecretList","apiVersion":"v1","metadata":{},"items":[]}`)
+		case "/apis/composition.krateo.io/v1-2-0/namespaces/demo-system/fireworksapps":
+			fmt.Fprint(w, `{"kind":"FireworksappList","apiVersion":"composition.krateo.io/v1-2-0","metadata":{},"items":[]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+		}
+	}))
+	b.Cleanup(srv.Close)
+	return &rest.Config{Host: srv.URL}, srv.URL + "/charts/demo-1.0.0.tgz", calls
+}
+
+// reconcile does with the clients what a reconcile of a composition does: it reads the composition
+// and its release, then renders the release with a server-side dry-run.
+func reconcile(b *testing.B, dyn dynamic.Interface, hc helmconfig.Client, chartURL string) {
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-2-0", Resource: "fireworksapps"}
+	_, err := dyn.Resource(gvr).Namespace("demo-system").List(context.Background(), metav1.ListOptions{})
+	require.NoError(b, err)
+	rel, err := hc.GetRelease(context.Background(), "demo", &helmconfig.GetConfig{})
+	require.NoError(b, err)
+	require.Nil(b, rel)
+	_, err = hc.Install(context.Background(), "demo", chartURL, &helmconfig.InstallConfig{
+		ActionConfig: &helmconfig.ActionConfig{DryRun: helmconfig.DryRunServer},
+	})
+	require.NoError(b, err)
+}
+
+func BenchmarkReconcileClients(b *testing.B) {
+	b.Run("new clients", func(b *testing.B) {
+		cfg, chartURL, calls := newAPIServer(b)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			dyn, err := dynamic.NewForConfig(cfg)
+			require.NoError(b, err)
+			hc, err := helm.NewClient(cfg, helm.WithNamespace("demo-system"), helm.WithCache())
+			require.NoError(b, err)
+			reconcile(b, dyn, hc, chartURL)
+			hc.Close()
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "apicalls/op")
+	})
+
+	b.Run("pooled clients", func(b *testing.B) {
+		cfg, chartURL, calls := newAPIServer(b)
+		// Clients built per reconcile are never throttled by their own rate limiter, nor must the shared ones be here
+		cfg.QPS = -1
+		p := New(cfg, time.Hour)
+		defer p.Close()
+		b.ReportAllocs()
+		b.ResetTimer()
+		for range b.N {
+			dyn, err := p.Dynamic()
+			require.NoError(b, err)
+			hc, err := p.Helm("demo-system", false)
+			require.NoError(b, err)
+			reconcile(b, dyn, hc, chartURL)
+			hc.Release()
+		}
+		b.ReportMetric(float64(calls.Load())/float64(b.N), "apicalls/op")
+	})
+}
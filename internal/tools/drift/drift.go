@@ -0,0 +1,226 @@
+package drift
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Object describes a rendered object whose live state differs from the release manifest.
+type Object struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+	// Missing is true when the object is part of the release but does not exist in the cluster.
+	Missing bool `json:"missing,omitempty"`
+	// Paths lists the fields owned by the release that have been changed in the cluster.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// ignoredTopLevel are the fields that are never owned by Helm, even if they appear in a manifest.
+var ignoredTopLevel = map[string]struct{}{
+	"status": {},
+}
+
+// ignoredMetadata are the metadata fields populated by the API server.
+var ignoredMetadata = map[string]struct{}{
+	"creationTimestamp": {},
+	"deletionTimestamp": {},
+	"generation":        {},
+	"managedFields":     {},
+	"resourceVersion":   {},
+	"selfLink":          {},
+	"uid":               {},
+}
+
+// Diff returns the sorted list of field paths that are set in desired and have a different value in live.
+// Only the fields present in desired are compared, so fields defaulted or added by the API server
+// and other controllers are not reported as drift.
+func Diff(desired, live map[string]any) []string {
+	desired = normalize(desired)
+	live = normalize(live)
+
+	var paths []string
+	for k, dv := range desired {
+		if _, ok := ignoredTopLevel[k]; ok {
+			continue
+		}
+		if k == "metadata" {
+			dm, _ := dv.(map[string]any)
+			lm, _ := live[k].(map[string]any)
+			for mk, mv := range dm {
+				if _, ok := ignoredMetadata[mk]; ok {
+					continue
+				}
+				paths = append(paths, diffValue("metadata."+mk, "metadata", mk, mv, lm[mk])...)
+			}
+			continue
+		}
+		paths = append(paths, diffValue(k, "", k, dv, live[k])...)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+// diffValue compares the values of the field, whose parent field is given to tell quantities apart.
+func diffValue(path, parent, field string, desired, live any) []string {
+	if desired == nil {
+		return nil
+	}
+
+	switch dv := desired.(type) {
+	case map[string]any:
+		lv, ok := live.(map[string]any)
+		if !ok {
+			if len(dv) == 0 && live == nil {
+				return nil
+			}
+			return []string{path}
+		}
+		var paths []string
+		for k, v := range dv {
+			paths = append(paths, diffValue(path+"."+k, field, k, v, lv[k])...)
+		}
+		return paths
+	case []any:
+		lv, ok := live.([]any)
+		if !ok {
+			if len(dv) == 0 && live == nil {
+				return nil
+			}
+			return []string{path}
+		}
+		if len(dv) != len(lv) {
+			return []string{path}
+		}
+		var paths []string
+		for i := range dv {
+			paths = append(paths, diffValue(path+"["+strconv.Itoa(i)+"]", parent, field, dv[i], lv[i])...)
+		}
+		return paths
+	}
+
+	if scalarEqual(desired, live, quantityField(parent, field)) {
+		return nil
+	}
+	return []string{path}
+}
+
+// scalarEqual compares two scalar values tolerating the representations the API server may return
+// for the same value: numbers of different types and, for quantity fields only, quantities.
+func scalarEqual(desired, live any, quantity bool) bool {
+	if reflect.DeepEqual(desired, live) {
+		return true
+	}
+
+	df, dok := toFloat(desired)
+	lf, lok := toFloat(live)
+	if dok && lok {
+		return df == lf
+	}
+
+	if !quantity {
+		return false
+	}
+	dq, dok := toQuantity(desired)
+	lq, lok := toQuantity(live)
+	if dok && lok {
+		return dq.Cmp(lq) == 0
+	}
+
+	return false
+}
+
+// quantityParents are the fields whose values are resource quantities, such as the limits
+// and requests of a container or the hard limits of a ResourceQuota.
+var quantityParents = map[string]struct{}{
+	"allocatable": {},
+	"capacity":    {},
+	"hard":        {},
+	"limits":      {},
+	"overhead":    {},
+	"requests":    {},
+}
+
+// quantityField reports whether the field holds a resource quantity, given the name of its parent field.
+func quantityField(parent, field string) bool {
+	if field == "sizeLimit" {
+		return true
+	}
+	_, ok := quantityParents[parent]
+	return ok
+}
+
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func toQuantity(v any) (resource.Quantity, bool) {
+	var s string
+	switch n := v.(type) {
+	case string:
+		s = n
+	default:
+		f, ok := toFloat(v)
+		if !ok {
+			return resource.Quantity{}, false
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return resource.Quantity{}, false
+	}
+	return q, true
+}
+
+// normalize rewrites the fields that are never returned as-is by the API server.
+// At the moment this folds Secret 'stringData' into 'data', as the API server does on write.
+func normalize(obj map[string]any) map[string]any {
+	if obj == nil {
+		return map[string]any{}
+	}
+	if obj["kind"] != "Secret" || obj["apiVersion"] != "v1" {
+		return obj
+	}
+	sd, ok := obj["stringData"].(map[string]any)
+	if !ok {
+		return obj
+	}
+
+	out := make(map[string]any, len(obj))
+	for k, v := range obj {
+		if k != "stringData" {
+			out[k] = v
+		}
+	}
+	data := map[string]any{}
+	if d, ok := obj["data"].(map[string]any); ok {
+		for k, v := range d {
+			data[k] = v
+		}
+	}
+	for k, v := range sd {
+		data[k] = base64.StdEncoding.EncodeToString([]byte(fmt.Sprint(v)))
+	}
+	out["data"] = data
+	return out
+}
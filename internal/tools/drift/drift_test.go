@@ -0,0 +1,148 @@
+package drift
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  map[string]any
+		live     map[string]any
+		expected []string
+	}{
+		{
+			name: "no drift with server populated fields",
+			desired: map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]any{"name": "demo", "labels": map[string]any{"app": "demo"}},
+				"spec":       map[string]any{"replicas": int64(2)},
+			},
+			live: map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata": map[string]any{
+					"name":            "demo",
+					"namespace":       "default",
+					"resourceVersion": "123",
+					"uid":             "abc",
+					"labels":          map[string]any{"app": "demo", "extra": "x"},
+				},
+				"spec":   map[string]any{"replicas": int64(2), "revisionHistoryLimit": int64(10)},
+				"status": map[string]any{"readyReplicas": int64(2)},
+			},
+		},
+		{
+			name: "changed scalar and label",
+			desired: map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"app": "demo"}},
+				"spec":     map[string]any{"replicas": int64(2)},
+			},
+			live: map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"app": "other"}},
+				"spec":     map[string]any{"replicas": int64(5)},
+			},
+			expected: []string{"metadata.labels.app", "spec.replicas"},
+		},
+		{
+			name: "list element changed",
+			desired: map[string]any{
+				"spec": map[string]any{"containers": []any{
+					map[string]any{"name": "app", "image": "nginx:1.25"},
+				}},
+			},
+			live: map[string]any{
+				"spec": map[string]any{"containers": []any{
+					map[string]any{"name": "app", "image": "nginx:latest", "imagePullPolicy": "Always"},
+				}},
+			},
+			expected: []string{"spec.containers[0].image"},
+		},
+		{
+			name: "list length changed",
+			desired: map[string]any{
+				"spec": map[string]any{"ports": []any{int64(80)}},
+			},
+			live: map[string]any{
+				"spec": map[string]any{"ports": []any{int64(80), int64(443)}},
+			},
+			expected: []string{"spec.ports"},
+		},
+		{
+			name: "equivalent quantities and numbers",
+			desired: map[string]any{
+				"spec": map[string]any{
+					"resources": map[string]any{"limits": map[string]any{"cpu": "0.5", "memory": "1Gi", "nvidia.com/gpu": int64(1)}},
+					"volume":    map[string]any{"sizeLimit": "1Gi"},
+					"weight":    float64(3),
+				},
+			},
+			live: map[string]any{
+				"spec": map[string]any{
+					"resources": map[string]any{"limits": map[string]any{"cpu": "500m", "memory": "1024Mi", "nvidia.com/gpu": "1"}},
+					"volume":    map[string]any{"sizeLimit": "1024Mi"},
+					"weight":    int64(3),
+				},
+			},
+		},
+		{
+			name: "quantity-like strings outside quantity fields",
+			desired: map[string]any{
+				"kind": "ConfigMap",
+				"data": map[string]any{"version": "1.0", "size": "1Gi"},
+				"spec": map[string]any{"replicas": "3"},
+			},
+			live: map[string]any{
+				"kind": "ConfigMap",
+				"data": map[string]any{"version": "1", "size": "1024Mi"},
+				"spec": map[string]any{"replicas": int64(3)},
+			},
+			expected: []string{"data.size", "data.version", "spec.replicas"},
+		},
+		{
+			name: "empty desired collections match missing live fields",
+			desired: map[string]any{
+				"spec": map[string]any{"selector": map[string]any{}, "items": []any{}, "nothing": nil},
+			},
+			live: map[string]any{
+				"spec": map[string]any{},
+			},
+		},
+		{
+			name: "secret string data folded into data",
+			desired: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"stringData": map[string]any{"password": "s3cr3t"},
+			},
+			live: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"data":       map[string]any{"password": "czNjcjN0"},
+			},
+		},
+		{
+			name: "secret data changed",
+			desired: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"stringData": map[string]any{"password": "s3cr3t"},
+			},
+			live: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Secret",
+				"data":       map[string]any{"password": "b3RoZXI="},
+			},
+			expected: []string{"data.password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Diff(tt.desired, tt.live))
+		})
+	}
+}
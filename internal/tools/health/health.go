@@ -0,0 +1,286 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Status is the health of a single resource.
+type Status string
+
+const (
+	// StatusHealthy resources are ready to serve.
+	StatusHealthy Status = "Healthy"
+	// StatusProgressing resources are still converging towards their desired state.
+	StatusProgressing Status = "Progressing"
+	// StatusDegraded resources failed to reach their desired state.
+	StatusDegraded Status = "Degraded"
+	// StatusMissing resources are part of the release but do not exist in the cluster.
+	StatusMissing Status = "Missing"
+	// StatusUnknown resources could not be evaluated.
+	StatusUnknown Status = "Unknown"
+)
+
+// Result is the outcome of the evaluation of a resource.
+type Result struct {
+	Status  Status
+	Message string
+}
+
+// IsHealthy reports whether the result is healthy.
+func (r Result) IsHealthy() bool {
+	return r.Status == StatusHealthy
+}
+
+var endpointSlicesGVR = schema.GroupVersionResource{
+	Group:    "discovery.k8s.io",
+	Version:  "v1",
+	Resource: "endpointslices",
+}
+
+// Evaluator computes the health of live resources.
+// The dynamic client is used to look up related objects, like the EndpointSlices of a Service.
+type Evaluator struct {
+	dynamicClient dynamic.Interface
+}
+
+func NewEvaluator(dyn dynamic.Interface) *Evaluator {
+	return &Evaluator{dynamicClient: dyn}
+}
+
+// Evaluate returns the health of the given live object.
+// Built-in workload kinds are evaluated with kind specific rules, any other object
+// is evaluated through its 'Ready' condition, if present.
+func (e *Evaluator) Evaluate(ctx context.Context, obj *unstructured.Unstructured) Result {
+	if obj == nil {
+		return Result{Status: StatusMissing, Message: "resource not found"}
+	}
+
+	gk := obj.GroupVersionKind().GroupKind()
+	switch gk {
+	case schema.GroupKind{Group: "apps", Kind: "Deployment"}:
+		return deploymentHealth(obj)
+	case schema.GroupKind{Group: "apps", Kind: "StatefulSet"}:
+		return statefulSetHealth(obj)
+	case schema.GroupKind{Group: "apps", Kind: "DaemonSet"}:
+		return daemonSetHealth(obj)
+	case schema.GroupKind{Group: "batch", Kind: "Job"}:
+		return jobHealth(obj)
+	case schema.GroupKind{Kind: "PersistentVolumeClaim"}:
+		return pvcHealth(obj)
+	case schema.GroupKind{Kind: "Service"}:
+		return e.serviceHealth(ctx, obj)
+	}
+	return readyConditionHealth(obj)
+}
+
+func deploymentHealth(obj *unstructured.Unstructured) Result {
+	if res, ok := generationObserved(obj); !ok {
+		return res
+	}
+	if cond := findCondition(obj, "Progressing"); cond != nil && cond["reason"] == "ProgressDeadlineExceeded" {
+		return Result{Status: StatusDegraded, Message: fmt.Sprintf("deployment exceeded its progress deadline: %v", cond["message"])}
+	}
+
+	replicas := int64Field(obj, 1, "spec", "replicas")
+	updated := int64Field(obj, 0, "status", "updatedReplicas")
+	available := int64Field(obj, 0, "status", "availableReplicas")
+	total := int64Field(obj, 0, "status", "replicas")
+
+	switch {
+	case updated < replicas:
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("%d of %d replicas are updated", updated, replicas)}
+	case total > updated:
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("%d old replicas are pending termination", total-updated)}
+	case available < updated:
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("%d of %d updated replicas are available", available, updated)}
+	}
+	return Result{Status: StatusHealthy}
+}
+
+func statefulSetHealth(obj *unstructured.Unstructured) Result {
+	if res, ok := generationObserved(obj); !ok {
+		return res
+	}
+
+	replicas := int64Field(obj, 1, "spec", "replicas")
+	ready := int64Field(obj, 0, "status", "readyReplicas")
+	updated := int64Field(obj, 0, "status", "updatedReplicas")
+
+	if ready < replicas {
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("%d of %d replicas are ready", ready, replicas)}
+	}
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return Result{Status: StatusHealthy}
+	}
+	if updated < replicas {
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("%d of %d replicas are updated", updated, replicas)}
+	}
+	current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if current != update {
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("rolling update from revision %s to %s in progress", current, update)}
+	}
+	return Result{Status: StatusHealthy}
+}
+
+func daemonSetHealth(obj *unstructured.Unstructured) Result {
+	if res, ok := generationObserved(obj); !ok {
+		return res
+	}
+
+	desired := int64Field(obj, 0, "status", "desiredNumberScheduled")
+	updated := int64Field(obj, 0, "status", "updatedNumberScheduled")
+	available := int64Field(obj, 0, "status", "numberAvailable")
+
+	if updated < desired {
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("%d of %d pods are updated", updated, desired)}
+	}
+	if available < desired {
+		return Result{Status: StatusProgressing, Message: fmt.Sprintf("%d of %d pods are available", available, desired)}
+	}
+	return Result{Status: StatusHealthy}
+}
+
+func jobHealth(obj *unstructured.Unstructured) Result {
+	if cond := findCondition(obj, "Failed"); cond != nil && cond["status"] == string(metav1.ConditionTrue) {
+		return Result{Status: StatusDegraded, Message: fmt.Sprintf("job failed: %v", cond["message"])}
+	}
+	if cond := findCondition(obj, "Complete"); cond != nil && cond["status"] == string(metav1.ConditionTrue) {
+		return Result{Status: StatusHealthy}
+	}
+	return Result{Status: StatusProgressing, Message: "job has not completed yet"}
+}
+
+func pvcHealth(obj *unstructured.Unstructured) Result {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch phase {
+	case "Bound":
+		return Result{Status: StatusHealthy}
+	case "Lost":
+		return Result{Status: StatusDegraded, Message: "persistent volume claim lost its volume"}
+	}
+	return Result{Status: StatusProgressing, Message: fmt.Sprintf("persistent volume claim is %s", phaseOrUnknown(phase))}
+}
+
+func (e *Evaluator) serviceHealth(ctx context.Context, obj *unstructured.Unstructured) Result {
+	svcType, _, _ := unstructured.NestedString(obj.Object, "spec", "type")
+	if svcType == "ExternalName" {
+		return Result{Status: StatusHealthy}
+	}
+	if svcType == "LoadBalancer" {
+		ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+		if len(ingress) == 0 {
+			return Result{Status: StatusProgressing, Message: "waiting for load balancer ingress"}
+		}
+	}
+
+	// Services without a selector have their endpoints managed externally
+	selector, _, _ := unstructured.NestedMap(obj.Object, "spec", "selector")
+	if len(selector) == 0 || e.dynamicClient == nil {
+		return Result{Status: StatusHealthy}
+	}
+
+	slices, err := e.dynamicClient.Resource(endpointSlicesGVR).Namespace(obj.GetNamespace()).List(ctx, metav1.ListOptions{
+		LabelSelector: "kubernetes.io/service-name=" + obj.GetName(),
+	})
+	if err != nil {
+		return Result{Status: StatusUnknown, Message: fmt.Sprintf("listing endpoint slices: %s", err.Error())}
+	}
+	for _, slice := range slices.Items {
+		endpoints, _, _ := unstructured.NestedSlice(slice.Object, "endpoints")
+		for _, ep := range endpoints {
+			m, ok := ep.(map[string]any)
+			if !ok {
+				continue
+			}
+			ready, found, _ := unstructured.NestedBool(m, "conditions", "ready")
+			// A nil ready condition must be interpreted as ready
+			if !found || ready {
+				return Result{Status: StatusHealthy}
+			}
+		}
+	}
+	return Result{Status: StatusProgressing, Message: "service has no ready endpoints"}
+}
+
+func readyConditionHealth(obj *unstructured.Unstructured) Result {
+	cond := findCondition(obj, "Ready")
+	if cond == nil {
+		return Result{Status: StatusHealthy}
+	}
+	switch cond["status"] {
+	case string(metav1.ConditionTrue):
+		return Result{Status: StatusHealthy}
+	case string(metav1.ConditionFalse):
+		return Result{Status: StatusDegraded, Message: conditionMessage(cond)}
+	}
+	return Result{Status: StatusProgressing, Message: conditionMessage(cond)}
+}
+
+// generationObserved returns false with a progressing result if the controller
+// of the object has not yet observed its latest generation.
+func generationObserved(obj *unstructured.Unstructured) (Result, bool) {
+	observed := int64Field(obj, 0, "status", "observedGeneration")
+	if obj.GetGeneration() > 0 && observed < obj.GetGeneration() {
+		return Result{Status: StatusProgressing, Message: "waiting for the latest generation to be observed"}, false
+	}
+	return Result{}, true
+}
+
+func findCondition(obj *unstructured.Unstructured, condType string) map[string]any {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		if m["type"] == condType {
+			return m
+		}
+	}
+	return nil
+}
+
+func conditionMessage(cond map[string]any) string {
+	reason, _ := cond["reason"].(string)
+	message, _ := cond["message"].(string)
+	switch {
+	case reason != "" && message != "":
+		return reason + ": " + message
+	case message != "":
+		return message
+	}
+	return reason
+}
+
+func int64Field(obj *unstructured.Unstructured, def int64, fields ...string) int64 {
+	v, found, err := unstructured.NestedFieldNoCopy(obj.Object, fields...)
+	if err != nil || !found {
+		return def
+	}
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case int:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return def
+}
+
+func phaseOrUnknown(phase string) string {
+	if phase == "" {
+		return "Unknown"
+	}
+	return phase
+}
@@ -0,0 +1,182 @@
+package health
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newObject(apiVersion, kind string, generation int64, spec, status map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]any{"name": "demo", "namespace": "demo-system"},
+	}}
+	if generation > 0 {
+		obj.SetGeneration(generation)
+	}
+	if spec != nil {
+		obj.Object["spec"] = spec
+	}
+	if status != nil {
+		obj.Object["status"] = status
+	}
+	return obj
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		obj      *unstructured.Unstructured
+		expected Status
+	}{
+		{
+			name:     "missing object",
+			obj:      nil,
+			expected: StatusMissing,
+		},
+		{
+			name: "deployment rolled out",
+			obj: newObject("apps/v1", "Deployment", 2, map[string]any{"replicas": int64(2)},
+				map[string]any{"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)}),
+			expected: StatusHealthy,
+		},
+		{
+			name: "deployment generation not observed",
+			obj: newObject("apps/v1", "Deployment", 3, map[string]any{"replicas": int64(2)},
+				map[string]any{"observedGeneration": int64(2), "replicas": int64(2), "updatedReplicas": int64(2), "availableReplicas": int64(2)}),
+			expected: StatusProgressing,
+		},
+		{
+			name: "deployment rolling out",
+			obj: newObject("apps/v1", "Deployment", 1, map[string]any{"replicas": int64(3)},
+				map[string]any{"observedGeneration": int64(1), "replicas": int64(3), "updatedReplicas": int64(3), "availableReplicas": int64(1)}),
+			expected: StatusProgressing,
+		},
+		{
+			name: "deployment progress deadline exceeded",
+			obj: newObject("apps/v1", "Deployment", 1, map[string]any{"replicas": int64(1)},
+				map[string]any{"observedGeneration": int64(1), "conditions": []any{
+					map[string]any{"type": "Progressing", "status": "False", "reason": "ProgressDeadlineExceeded"},
+				}}),
+			expected: StatusDegraded,
+		},
+		{
+			name: "statefulset ready",
+			obj: newObject("apps/v1", "StatefulSet", 1, map[string]any{"replicas": int64(2)},
+				map[string]any{"observedGeneration": int64(1), "readyReplicas": int64(2), "updatedReplicas": int64(2), "currentRevision": "r1", "updateRevision": "r1"}),
+			expected: StatusHealthy,
+		},
+		{
+			name: "statefulset revision pending",
+			obj: newObject("apps/v1", "StatefulSet", 1, map[string]any{"replicas": int64(2)},
+				map[string]any{"observedGeneration": int64(1), "readyReplicas": int64(2), "updatedReplicas": int64(2), "currentRevision": "r1", "updateRevision": "r2"}),
+			expected: StatusProgressing,
+		},
+		{
+			name: "daemonset available",
+			obj: newObject("apps/v1", "DaemonSet", 1, nil,
+				map[string]any{"observedGeneration": int64(1), "desiredNumberScheduled": int64(3), "updatedNumberScheduled": int64(3), "numberAvailable": int64(3)}),
+			expected: StatusHealthy,
+		},
+		{
+			name: "job complete",
+			obj: newObject("batch/v1", "Job", 0, nil, map[string]any{"conditions": []any{
+				map[string]any{"type": "Complete", "status": "True"},
+			}}),
+			expected: StatusHealthy,
+		},
+		{
+			name: "job failed",
+			obj: newObject("batch/v1", "Job", 0, nil, map[string]any{"conditions": []any{
+				map[string]any{"type": "Failed", "status": "True", "message": "BackoffLimitExceeded"},
+			}}),
+			expected: StatusDegraded,
+		},
+		{
+			name:     "job running",
+			obj:      newObject("batch/v1", "Job", 0, nil, map[string]any{"active": int64(1)}),
+			expected: StatusProgressing,
+		},
+		{
+			name:     "pvc bound",
+			obj:      newObject("v1", "PersistentVolumeClaim", 0, nil, map[string]any{"phase": "Bound"}),
+			expected: StatusHealthy,
+		},
+		{
+			name:     "pvc pending",
+			obj:      newObject("v1", "PersistentVolumeClaim", 0, nil, map[string]any{"phase": "Pending"}),
+			expected: StatusProgressing,
+		},
+		{
+			name:     "service without selector",
+			obj:      newObject("v1", "Service", 0, map[string]any{"type": "ClusterIP"}, nil),
+			expected: StatusHealthy,
+		},
+		{
+			name:     "load balancer without ingress",
+			obj:      newObject("v1", "Service", 0, map[string]any{"type": "LoadBalancer"}, map[string]any{}),
+			expected: StatusProgressing,
+		},
+		{
+			name: "custom resource ready",
+			obj: newObject("example.krateo.io/v1", "Widget", 0, nil, map[string]any{"conditions": []any{
+				map[string]any{"type": "Ready", "status": "True"},
+			}}),
+			expected: StatusHealthy,
+		},
+		{
+			name: "custom resource not ready",
+			obj: newObject("example.krateo.io/v1", "Widget", 0, nil, map[string]any{"conditions": []any{
+				map[string]any{"type": "Ready", "status": "False", "reason": "Unavailable"},
+			}}),
+			expected: StatusDegraded,
+		},
+		{
+			name:     "object without status",
+			obj:      newObject("v1", "ConfigMap", 0, nil, nil),
+			expected: StatusHealthy,
+		},
+	}
+
+	e := NewEvaluator(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := e.Evaluate(context.Background(), tt.obj)
+			assert.Equal(t, tt.expected, res.Status, res.Message)
+		})
+	}
+}
+
+func TestEvaluateServiceEndpoints(t *testing.T) {
+	slice := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "discovery.k8s.io/v1",
+		"kind":       "EndpointSlice",
+		"metadata": map[string]any{
+			"name":      "demo-abcde",
+			"namespace": "demo-system",
+			"labels":    map[string]any{"kubernetes.io/service-name": "demo"},
+		},
+		"endpoints": []any{
+			map[string]any{"addresses": []any{"10.0.0.1"}, "conditions": map[string]any{"ready": false}},
+		},
+	}}
+	listKinds := map[schema.GroupVersionResource]string{endpointSlicesGVR: "EndpointSliceList"}
+	svc := newObject("v1", "Service", 0, map[string]any{"type": "ClusterIP", "selector": map[string]any{"app": "demo"}}, nil)
+
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, slice)
+	res := NewEvaluator(dyn).Evaluate(context.Background(), svc)
+	assert.Equal(t, StatusProgressing, res.Status)
+
+	_ = unstructured.SetNestedField(slice.Object, []any{
+		map[string]any{"addresses": []any{"10.0.0.1"}, "conditions": map[string]any{"ready": true}},
+	}, "endpoints")
+	dyn = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, slice)
+	res = NewEvaluator(dyn).Evaluate(context.Background(), svc)
+	assert.Equal(t, StatusHealthy, res.Status)
+}
@@ -0,0 +1,101 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/clientpool"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/processor"
+	helmconfig "github.com/krateoplatformops/plumbing/helm"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// Entry is a revision of a Helm release.
+type Entry struct {
+	Revision     int    `json:"revision"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+	Digest       string `json:"digest,omitempty"`
+	Status       string `json:"status"`
+	Deployed     string `json:"deployed,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Lister returns the revisions of a release from the Helm release storage.
+type Lister interface {
+	List(namespace, releaseName string) ([]*release.Release, error)
+}
+
+func NewLister(store clientpool.ReleaseStore) Lister {
+	return &lister{store: store}
+}
+
+type lister struct {
+	store clientpool.ReleaseStore
+}
+
+// List returns every revision of the release, in no particular order.
+func (l *lister) List(namespace, releaseName string) ([]*release.Release, error) {
+	store, err := l.store.Releases(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rels, err := store.History(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("getting history of release %s: %w", releaseName, err)
+	}
+	return rels, nil
+}
+
+// Latest returns the newest revision among the releases, nil if there is none.
+func Latest(rels []*release.Release) *release.Release {
+	var latest *release.Release
+	for _, rel := range rels {
+		if rel != nil && (latest == nil || rel.Version > latest.Version) {
+			latest = rel
+		}
+	}
+	return latest
+}
+
+// FromReleases converts the Helm releases to history entries, sorted by revision
+// from the newest to the oldest and trimmed to max entries. A max lower than 1 keeps all of them.
+func FromReleases(rels []*release.Release, max int) ([]Entry, error) {
+	entries := make([]Entry, 0, len(rels))
+	for _, rel := range rels {
+		if rel == nil {
+			continue
+		}
+
+		digest, err := processor.ComputeReleaseDigest(&helmconfig.Release{Manifest: rel.Manifest})
+		if err != nil {
+			return nil, fmt.Errorf("computing digest of revision %d: %w", rel.Version, err)
+		}
+
+		e := Entry{
+			Revision: rel.Version,
+			Digest:   digest,
+		}
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			e.ChartVersion = rel.Chart.Metadata.Version
+		}
+		if rel.Info != nil {
+			e.Status = rel.Info.Status.String()
+			e.Description = rel.Info.Description
+			if !rel.Info.LastDeployed.IsZero() {
+				e.Deployed = rel.Info.LastDeployed.UTC().Format(time.RFC3339)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Revision > entries[j].Revision
+	})
+	if max > 0 && len(entries) > max {
+		entries = entries[:max]
+	}
+	return entries, nil
+}
@@ -0,0 +1,73 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+func newRelease(revision int, version string, status release.Status, manifest string) *release.Release {
+	return &release.Release{
+		Name:     "demo",
+		Version:  revision,
+		Manifest: manifest,
+		Chart:    &chart.Chart{Metadata: &chart.Metadata{Name: "demo", Version: version}},
+		Info: &release.Info{
+			Status:       status,
+			Description:  "Upgrade complete",
+			LastDeployed: helmtime.Time{Time: time.Date(2024, 5, 1, 10, revision, 0, 0, time.UTC)},
+		},
+	}
+}
+
+func TestFromReleases(t *testing.T) {
+	rels := []*release.Release{
+		newRelease(1, "1.0.0", release.StatusSuperseded, "kind: ConfigMap"),
+		newRelease(3, "1.1.0", release.StatusDeployed, "kind: Secret"),
+		newRelease(2, "1.0.1", release.StatusSuperseded, ""),
+	}
+
+	entries, err := FromReleases(rels, 2)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, 3, entries[0].Revision)
+	assert.Equal(t, "1.1.0", entries[0].ChartVersion)
+	assert.Equal(t, "deployed", entries[0].Status)
+	assert.Equal(t, "Upgrade complete", entries[0].Description)
+	assert.Equal(t, "2024-05-01T10:03:00Z", entries[0].Deployed)
+	assert.NotEmpty(t, entries[0].Digest)
+
+	assert.Equal(t, 2, entries[1].Revision)
+	assert.Empty(t, entries[1].Digest)
+}
+
+func TestFromReleases_Unbounded(t *testing.T) {
+	rels := []*release.Release{
+		newRelease(1, "1.0.0", release.StatusSuperseded, ""),
+		nil,
+		newRelease(2, "1.0.1", release.StatusFailed, ""),
+	}
+
+	entries, err := FromReleases(rels, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "failed", entries[0].Status)
+}
+
+func TestLatest(t *testing.T) {
+	assert.Nil(t, Latest(nil))
+
+	rels := []*release.Release{
+		newRelease(2, "1.0.1", release.StatusSuperseded, ""),
+		nil,
+		newRelease(3, "1.1.0", release.StatusFailed, ""),
+		newRelease(1, "1.0.0", release.StatusSuperseded, ""),
+	}
+	assert.Equal(t, 3, Latest(rels).Version)
+}
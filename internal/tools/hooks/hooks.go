@@ -0,0 +1,64 @@
+package hooks
+
+import (
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// Annotation marks the objects of a chart that are Helm hooks rather than release resources.
+const Annotation = release.HookAnnotation
+
+// Outcomes of the last run of a hook.
+const (
+	OutcomeRunning   = string(release.HookPhaseRunning)
+	OutcomeSucceeded = string(release.HookPhaseSucceeded)
+	OutcomeFailed    = string(release.HookPhaseFailed)
+)
+
+// Hook is a Helm hook of the latest revision of a release, with the outcome of its last run.
+type Hook struct {
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"`
+	Phases  []string `json:"phases"`
+	LastRun string   `json:"lastRun,omitempty"`
+	Outcome string   `json:"outcome,omitempty"`
+}
+
+// IsHook reports whether the annotations mark the object as a Helm hook.
+func IsHook(annotations map[string]string) bool {
+	_, ok := annotations[Annotation]
+	return ok
+}
+
+// FromRelease converts the hooks of the Helm release, in the order Helm runs them.
+func FromRelease(rel *release.Release) []Hook {
+	if rel == nil {
+		return nil
+	}
+
+	res := make([]Hook, 0, len(rel.Hooks))
+	for _, h := range rel.Hooks {
+		if h == nil {
+			continue
+		}
+
+		hook := Hook{
+			Name:    h.Name,
+			Kind:    h.Kind,
+			Phases:  make([]string, 0, len(h.Events)),
+			Outcome: string(h.LastRun.Phase),
+		}
+		for _, ev := range h.Events {
+			hook.Phases = append(hook.Phases, string(ev))
+		}
+		if !h.LastRun.StartedAt.IsZero() {
+			hook.LastRun = h.LastRun.StartedAt.UTC().Format(time.RFC3339)
+		}
+		if hook.Outcome == string(release.HookPhaseUnknown) {
+			hook.Outcome = ""
+		}
+		res = append(res, hook)
+	}
+	return res
+}
@@ -0,0 +1,44 @@
+package hooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+func TestFromRelease(t *testing.T) {
+	started := helmtime.Time{Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	rel := &release.Release{
+		Hooks: []*release.Hook{
+			{
+				Name:    "demo-migrate",
+				Kind:    "Job",
+				Events:  []release.HookEvent{release.HookPreInstall, release.HookPreUpgrade},
+				LastRun: release.HookExecution{StartedAt: started, CompletedAt: started, Phase: release.HookPhaseFailed},
+			},
+			nil,
+			{
+				Name:    "demo-cleanup",
+				Kind:    "Job",
+				Events:  []release.HookEvent{release.HookPreDelete},
+				LastRun: release.HookExecution{Phase: release.HookPhaseUnknown},
+			},
+		},
+	}
+
+	assert.Equal(t, []Hook{
+		{Name: "demo-migrate", Kind: "Job", Phases: []string{"pre-install", "pre-upgrade"}, LastRun: "2024-05-01T10:00:00Z", Outcome: OutcomeFailed},
+		{Name: "demo-cleanup", Kind: "Job", Phases: []string{"pre-delete"}},
+	}, FromRelease(rel))
+
+	assert.Nil(t, FromRelease(nil))
+}
+
+func TestIsHook(t *testing.T) {
+	assert.True(t, IsHook(map[string]string{"helm.sh/hook": "pre-upgrade"}))
+	assert.False(t, IsHook(map[string]string{"app": "demo"}))
+	assert.False(t, IsHook(nil))
+}
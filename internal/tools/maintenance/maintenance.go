@@ -0,0 +1,56 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Spec is the declaration of a recurring maintenance window.
+type Spec struct {
+	// Schedule is a standard 5 fields cron expression for the start of the window.
+	// The time zone can be set with the 'CRON_TZ=' prefix, UTC is used otherwise.
+	Schedule string `json:"schedule"`
+
+	// Duration is how long the window stays open after each start (e.g. "4h").
+	Duration string `json:"duration"`
+}
+
+// Window is a parsed maintenance window.
+type Window struct {
+	schedule cron.Schedule
+	duration time.Duration
+}
+
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Parse validates the spec and returns the maintenance window it declares.
+func Parse(spec Spec) (*Window, error) {
+	schedule, err := parser.Parse(spec.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("parsing schedule %q: %w", spec.Schedule, err)
+	}
+	duration, err := time.ParseDuration(spec.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("parsing duration %q: %w", spec.Duration, err)
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive, got %q", spec.Duration)
+	}
+	return &Window{schedule: schedule, duration: duration}, nil
+}
+
+// Active reports whether the window is open at the given time,
+// that is a window started less than its duration ago.
+func (w *Window) Active(now time.Time) bool {
+	// Schedules without an explicit time zone are evaluated in UTC
+	now = now.UTC()
+	start := w.schedule.Next(now.Add(-w.duration))
+	return !start.After(now)
+}
+
+// NextStart returns the next time the window opens after the given time.
+func (w *Window) NextStart(now time.Time) time.Time {
+	return w.schedule.Next(now.UTC())
+}
@@ -0,0 +1,69 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Spec
+		wantErr bool
+	}{
+		{name: "valid", spec: Spec{Schedule: "0 2 * * *", Duration: "3h"}},
+		{name: "with time zone", spec: Spec{Schedule: "CRON_TZ=Europe/Rome 0 2 * * 1-5", Duration: "30m"}},
+		{name: "descriptor", spec: Spec{Schedule: "@daily", Duration: "1h"}},
+		{name: "invalid schedule", spec: Spec{Schedule: "every night", Duration: "3h"}, wantErr: true},
+		{name: "invalid duration", spec: Spec{Schedule: "0 2 * * *", Duration: "all night"}, wantErr: true},
+		{name: "zero duration", spec: Spec{Schedule: "0 2 * * *", Duration: "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w, err := Parse(Spec{Schedule: "0 2 * * *", Duration: "3h"})
+	require.NoError(t, err)
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+		next   time.Time
+	}{
+		{name: "before the window", now: day.Add(1 * time.Hour), active: false, next: day.Add(2 * time.Hour)},
+		{name: "at the start", now: day.Add(2 * time.Hour), active: true, next: day.Add(26 * time.Hour)},
+		{name: "inside the window", now: day.Add(4 * time.Hour), active: true, next: day.Add(26 * time.Hour)},
+		{name: "at the end", now: day.Add(5 * time.Hour), active: false, next: day.Add(26 * time.Hour)},
+		{name: "after the window", now: day.Add(12 * time.Hour), active: false, next: day.Add(26 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.active, w.Active(tt.now))
+			assert.Equal(t, tt.next, w.NextStart(tt.now))
+		})
+	}
+}
+
+func TestWindow_AcrossMidnight(t *testing.T) {
+	w, err := Parse(Spec{Schedule: "0 22 * * *", Duration: "4h"})
+	require.NoError(t, err)
+
+	assert.True(t, w.Active(time.Date(2024, 5, 2, 1, 30, 0, 0, time.UTC)))
+	assert.False(t, w.Active(time.Date(2024, 5, 2, 2, 30, 0, 0, time.UTC)))
+}
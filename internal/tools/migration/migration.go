@@ -0,0 +1,77 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/clientpool"
+
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+// Renamer renames releases in the Helm release storage.
+type Renamer interface {
+	Rename(namespace, from, to string) (int, error)
+}
+
+func NewRenamer(store clientpool.ReleaseStore) Renamer {
+	return &renamer{store: store}
+}
+
+type renamer struct {
+	store clientpool.ReleaseStore
+}
+
+// Rename moves the release to the new name in the Helm release storage of the namespace.
+func (r *renamer) Rename(namespace, from, to string) (int, error) {
+	store, err := r.store.Releases(namespace)
+	if err != nil {
+		return 0, err
+	}
+	return Rename(store, from, to)
+}
+
+// Rename moves every revision of the release to the new name and returns how many have been moved.
+// Only the release records are rewritten, the objects deployed by the release are left untouched.
+// The revisions are copied before the old ones are deleted, so that an interrupted rename can be run
+// again: revisions already copied are recognized by their manifest, while a different release already
+// holding the new name is never overwritten. Nothing is moved when the release does not exist.
+func Rename(store *storage.Storage, from, to string) (int, error) {
+	revisions, err := store.History(from)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("getting history of release %s: %w", from, err)
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Version < revisions[j].Version })
+
+	for _, rev := range revisions {
+		moved := *rev
+		moved.Name = to
+		err = store.Create(&moved)
+		if errors.Is(err, driver.ErrReleaseExists) {
+			existing, getErr := store.Get(to, rev.Version)
+			if getErr != nil {
+				return 0, fmt.Errorf("getting revision %d of release %s: %w", rev.Version, to, getErr)
+			}
+			if existing.Manifest != rev.Manifest {
+				return 0, fmt.Errorf("release %s already exists with a different revision %d", to, rev.Version)
+			}
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("copying revision %d of release %s to %s: %w", rev.Version, from, to, err)
+		}
+	}
+
+	for _, rev := range revisions {
+		_, err = store.Delete(from, rev.Version)
+		if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+			return 0, fmt.Errorf("deleting revision %d of release %s: %w", rev.Version, from, err)
+		}
+	}
+	return len(revisions), nil
+}
@@ -0,0 +1,89 @@
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
+
+func newRelease(name string, version int, manifest string) *release.Release {
+	return &release.Release{
+		Name:      name,
+		Namespace: "demo-system",
+		Version:   version,
+		Manifest:  manifest,
+		Info:      &release.Info{Status: release.StatusSuperseded},
+		Chart:     &chart.Chart{Metadata: &chart.Metadata{Name: "demo", Version: "1.0.0"}},
+	}
+}
+
+func newStore(t *testing.T, rels ...*release.Release) *storage.Storage {
+	t.Helper()
+	store := storage.Init(driver.NewMemory())
+	for _, rel := range rels {
+		require.NoError(t, store.Create(rel))
+	}
+	return store
+}
+
+func versions(t *testing.T, store *storage.Storage, name string) []int {
+	t.Helper()
+	revisions, err := store.History(name)
+	if err != nil {
+		require.ErrorIs(t, err, driver.ErrReleaseNotFound)
+		return nil
+	}
+	res := make([]int, 0, len(revisions))
+	for _, rev := range revisions {
+		res = append(res, rev.Version)
+	}
+	return res
+}
+
+func TestRename(t *testing.T) {
+	t.Run("moves every revision", func(t *testing.T) {
+		store := newStore(t, newRelease("demo", 1, "v1"), newRelease("demo", 2, "v2"))
+
+		moved, err := Rename(store, "demo", "demo-b5a47edd")
+		require.NoError(t, err)
+		assert.Equal(t, 2, moved)
+		assert.Empty(t, versions(t, store, "demo"))
+		assert.ElementsMatch(t, []int{1, 2}, versions(t, store, "demo-b5a47edd"))
+
+		rel, err := store.Get("demo-b5a47edd", 2)
+		require.NoError(t, err)
+		assert.Equal(t, "demo-b5a47edd", rel.Name)
+		assert.Equal(t, "v2", rel.Manifest)
+	})
+
+	t.Run("nothing to move", func(t *testing.T) {
+		store := newStore(t)
+
+		moved, err := Rename(store, "demo", "demo-b5a47edd")
+		require.NoError(t, err)
+		assert.Zero(t, moved)
+	})
+
+	t.Run("resumes an interrupted rename", func(t *testing.T) {
+		store := newStore(t, newRelease("demo", 1, "v1"), newRelease("demo", 2, "v2"), newRelease("demo-b5a47edd", 1, "v1"))
+
+		moved, err := Rename(store, "demo", "demo-b5a47edd")
+		require.NoError(t, err)
+		assert.Equal(t, 2, moved)
+		assert.Empty(t, versions(t, store, "demo"))
+		assert.ElementsMatch(t, []int{1, 2}, versions(t, store, "demo-b5a47edd"))
+	})
+
+	t.Run("never overwrites another release", func(t *testing.T) {
+		store := newStore(t, newRelease("demo", 1, "v1"), newRelease("demo-b5a47edd", 1, "other"))
+
+		_, err := Rename(store, "demo", "demo-b5a47edd")
+		require.EqualError(t, err, "release demo-b5a47edd already exists with a different revision 1")
+		assert.Equal(t, []int{1}, versions(t, store, "demo"))
+	})
+}
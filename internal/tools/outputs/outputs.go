@@ -0,0 +1,146 @@
+package outputs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Selector selects one of the objects rendered by the release.
+type Selector struct {
+	// APIVersion of the object (e.g. "v1").
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the object (e.g. "Service").
+	Kind string `json:"kind"`
+
+	// Name of the object, if set.
+	Name string `json:"name,omitempty"`
+
+	// MatchLabels the object must have, if set.
+	MatchLabels map[string]string `json:"matchLabels,omitempty"`
+}
+
+// Matches reports whether the object is selected.
+func (s *Selector) Matches(obj *unstructured.Unstructured) bool {
+	if obj.GetAPIVersion() != s.APIVersion || obj.GetKind() != s.Kind {
+		return false
+	}
+	if s.Name != "" && obj.GetName() != s.Name {
+		return false
+	}
+	return labels.SelectorFromSet(s.MatchLabels).Matches(labels.Set(obj.GetLabels()))
+}
+
+// Output is a named value read with a JSONPath expression from the live state
+// of an object rendered by the release.
+type Output struct {
+	// Name of the output, used as key in the status and in the Secret.
+	Name string `json:"name"`
+
+	// Selector of the object to read the value from. The first rendered object that matches is used.
+	Selector Selector `json:"selector"`
+
+	// JSONPath expression of the value (e.g. "{.spec.clusterIP}"), the braces are optional.
+	JSONPath string `json:"jsonPath"`
+
+	// Sensitive outputs are only published in the Secret, never in the status.
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+// LiveFunc returns the live state of an object rendered by the release.
+type LiveFunc func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+
+// Resolve evaluates the outputs against the live state of the objects they select.
+// The outputs that cannot be resolved (e.g. a field not populated yet) are left out of the result
+// and reported in the returned error, together with the ones that could be resolved.
+func Resolve(ctx context.Context, rendered []unstructured.Unstructured, outs []Output, live LiveFunc) (map[string]string, error) {
+	values := make(map[string]string, len(outs))
+	var errs []error
+	for i := range outs {
+		out := &outs[i]
+		val, err := resolve(ctx, rendered, out, live)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("output %q: %w", out.Name, err))
+			continue
+		}
+		values[out.Name] = val
+	}
+	return values, errors.Join(errs...)
+}
+
+func resolve(ctx context.Context, rendered []unstructured.Unstructured, out *Output, live LiveFunc) (string, error) {
+	var selected *unstructured.Unstructured
+	for i := range rendered {
+		if out.Selector.Matches(&rendered[i]) {
+			selected = &rendered[i]
+			break
+		}
+	}
+	if selected == nil {
+		return "", fmt.Errorf("no rendered %s %s matches the selector", out.Selector.APIVersion, out.Selector.Kind)
+	}
+
+	obj, err := live(ctx, selected)
+	if err != nil {
+		return "", fmt.Errorf("getting %s %s: %w", selected.GetKind(), selected.GetName(), err)
+	}
+	return Evaluate(obj.Object, out.JSONPath)
+}
+
+// Evaluate returns the value found at the JSONPath expression in the object.
+// Strings are returned as they are, other values are JSON encoded; multiple results are separated by a space.
+func Evaluate(obj map[string]any, expr string) (string, error) {
+	jp := jsonpath.New("output").AllowMissingKeys(true)
+	err := jp.Parse(relaxed(expr))
+	if err != nil {
+		return "", fmt.Errorf("parsing JSONPath %q: %w", expr, err)
+	}
+	results, err := jp.FindResults(obj)
+	if err != nil {
+		return "", fmt.Errorf("evaluating JSONPath %q: %w", expr, err)
+	}
+
+	var vals []string
+	for _, res := range results {
+		for _, v := range res {
+			if !v.IsValid() || !v.CanInterface() {
+				continue
+			}
+			switch x := v.Interface().(type) {
+			case nil:
+				continue
+			case string:
+				vals = append(vals, x)
+			default:
+				b, err := json.Marshal(x)
+				if err != nil {
+					return "", fmt.Errorf("encoding value at %q: %w", expr, err)
+				}
+				vals = append(vals, string(b))
+			}
+		}
+	}
+	if len(vals) == 0 {
+		return "", fmt.Errorf("no value found at %q", expr)
+	}
+	return strings.Join(vals, " "), nil
+}
+
+// relaxed wraps the expression in braces and adds the leading dot, if missing.
+func relaxed(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+		return expr
+	}
+	if !strings.HasPrefix(expr, ".") {
+		expr = "." + expr
+	}
+	return "{" + expr + "}"
+}
@@ -0,0 +1,120 @@
+package outputs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newObject(apiVersion, kind, name string, labels map[string]any, fields map[string]any) unstructured.Unstructured {
+	obj := map[string]any{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]any{"name": name, "labels": labels},
+	}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	return unstructured.Unstructured{Object: obj}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	obj := newObject("v1", "Service", "demo-web", map[string]any{"app": "web", "tier": "frontend"}, nil)
+
+	tests := []struct {
+		name     string
+		selector Selector
+		expected bool
+	}{
+		{name: "kind", selector: Selector{APIVersion: "v1", Kind: "Service"}, expected: true},
+		{name: "name", selector: Selector{APIVersion: "v1", Kind: "Service", Name: "demo-web"}, expected: true},
+		{name: "labels", selector: Selector{APIVersion: "v1", Kind: "Service", MatchLabels: map[string]string{"app": "web"}}, expected: true},
+		{name: "other kind", selector: Selector{APIVersion: "v1", Kind: "ConfigMap"}, expected: false},
+		{name: "other version", selector: Selector{APIVersion: "v2", Kind: "Service"}, expected: false},
+		{name: "other name", selector: Selector{APIVersion: "v1", Kind: "Service", Name: "demo-api"}, expected: false},
+		{name: "other labels", selector: Selector{APIVersion: "v1", Kind: "Service", MatchLabels: map[string]string{"app": "api"}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.selector.Matches(&obj))
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	obj := map[string]any{
+		"spec": map[string]any{
+			"clusterIP": "10.0.0.1",
+			"ports": []any{
+				map[string]any{"name": "http", "port": int64(80)},
+				map[string]any{"name": "https", "port": int64(443)},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "braces", expr: "{.spec.clusterIP}", expected: "10.0.0.1"},
+		{name: "leading dot", expr: ".spec.clusterIP", expected: "10.0.0.1"},
+		{name: "bare", expr: "spec.clusterIP", expected: "10.0.0.1"},
+		{name: "number", expr: "{.spec.ports[0].port}", expected: "80"},
+		{name: "filter", expr: `{.spec.ports[?(@.name=="https")].port}`, expected: "443"},
+		{name: "multiple results", expr: "{.spec.ports[*].name}", expected: "http https"},
+		{name: "object", expr: "{.spec.ports[0]}", expected: `{"name":"http","port":80}`},
+		{name: "missing", expr: "{.status.loadBalancer.ingress[0].hostname}", wantErr: true},
+		{name: "invalid", expr: "{.spec[}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			val, err := Evaluate(obj, tt.expr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, val)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	rendered := []unstructured.Unstructured{
+		newObject("v1", "ConfigMap", "demo-config", nil, nil),
+		newObject("v1", "Service", "demo-web", map[string]any{"app": "web"}, nil),
+	}
+	liveState := map[string]unstructured.Unstructured{
+		"demo-web": newObject("v1", "Service", "demo-web", nil, map[string]any{
+			"spec": map[string]any{"clusterIP": "10.0.0.1"},
+		}),
+	}
+	live := func(_ context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+		l, ok := liveState[obj.GetName()]
+		if !ok {
+			return nil, fmt.Errorf("not found")
+		}
+		return &l, nil
+	}
+
+	values, err := Resolve(context.Background(), rendered, []Output{
+		{Name: "ip", Selector: Selector{APIVersion: "v1", Kind: "Service", MatchLabels: map[string]string{"app": "web"}}, JSONPath: ".spec.clusterIP"},
+		{Name: "hostname", Selector: Selector{APIVersion: "v1", Kind: "Service"}, JSONPath: ".status.loadBalancer.ingress[0].hostname"},
+		{Name: "config", Selector: Selector{APIVersion: "v1", Kind: "ConfigMap"}, JSONPath: ".data.key"},
+		{Name: "secret", Selector: Selector{APIVersion: "v1", Kind: "Secret"}, JSONPath: ".data.password"},
+	}, live)
+
+	assert.Equal(t, map[string]string{"ip": "10.0.0.1"}, values)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `output "hostname": no value found`)
+	assert.Contains(t, err.Error(), `output "config": getting ConfigMap demo-config: not found`)
+	assert.Contains(t, err.Error(), `output "secret": no rendered v1 Secret matches the selector`)
+}
@@ -0,0 +1,59 @@
+package ownership
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Cache remembers the latest revision of each release found owned by a composition, so that the
+// resyncs of an unchanged release do not read the release storage again. Only the ownership of the
+// asking composition is remembered: a release reinstalled under the same name and revision by
+// another composition is never mistaken for its own, as the UID of the owner differs.
+type Cache struct {
+	mu    sync.Mutex
+	owned map[string]int
+}
+
+func NewCache() *Cache {
+	return &Cache{owned: map[string]int{}}
+}
+
+// Owned reports whether the revision of the release has been found owned by the composition.
+// It is safe to call on a nil Cache.
+func (c *Cache) Owned(namespace, releaseName string, uid types.UID, revision int) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rev, ok := c.owned[cacheKey(namespace, releaseName, uid)]
+	return ok && rev == revision
+}
+
+// SetOwned records that the revision of the release is owned by the composition.
+// It is safe to call on a nil Cache.
+func (c *Cache) SetOwned(namespace, releaseName string, uid types.UID, revision int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.owned[cacheKey(namespace, releaseName, uid)] = revision
+}
+
+// Forget drops the ownership recorded for the release and the composition.
+// It is safe to call on a nil Cache.
+func (c *Cache) Forget(namespace, releaseName string, uid types.UID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.owned, cacheKey(namespace, releaseName, uid))
+}
+
+func cacheKey(namespace, releaseName string, uid types.UID) string {
+	return strings.Join([]string{namespace, releaseName, string(uid)}, "/")
+}
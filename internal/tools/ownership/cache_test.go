@@ -0,0 +1,32 @@
+package ownership
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCache(t *testing.T) {
+	const (
+		uid   = types.UID("0c2b4f4e-6f5e-4a8b-9d3a-2f1e0b7c9a11")
+		other = types.UID("5d1e7a0b-3c4f-4e2a-8b9c-7a6d5e4f3b21")
+	)
+
+	c := NewCache()
+	assert.False(t, c.Owned("demo-system", "demo", uid, 3))
+
+	c.SetOwned("demo-system", "demo", uid, 3)
+	assert.True(t, c.Owned("demo-system", "demo", uid, 3))
+	assert.False(t, c.Owned("demo-system", "demo", uid, 4), "a new revision must be looked up")
+	assert.False(t, c.Owned("demo-system", "demo", other, 3), "only the ownership of the composition is remembered")
+	assert.False(t, c.Owned("other-system", "demo", uid, 3))
+
+	c.Forget("demo-system", "demo", uid)
+	assert.False(t, c.Owned("demo-system", "demo", uid, 3))
+
+	var nilCache *Cache
+	nilCache.SetOwned("demo-system", "demo", uid, 3)
+	assert.False(t, nilCache.Owned("demo-system", "demo", uid, 3))
+	nilCache.Forget("demo-system", "demo", uid)
+}
@@ -0,0 +1,59 @@
+package ownership
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/clientpool"
+
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Label is the Helm release label holding the UID of the composition that owns the release.
+const Label = "krateo.io/composition-id"
+
+// Labels returns the Helm release labels that stamp the ownership of the composition with the given UID.
+func Labels(uid types.UID) map[string]string {
+	return map[string]string{Label: string(uid)}
+}
+
+// Getter returns the owner of a release from the Helm release storage.
+type Getter interface {
+	Owner(namespace, releaseName string) (string, error)
+}
+
+func NewGetter(store clientpool.ReleaseStore) Getter {
+	return &getter{store: store}
+}
+
+type getter struct {
+	store clientpool.ReleaseStore
+}
+
+// Owner returns the UID of the composition that owns the latest revision of the release.
+// It is empty when the release does not exist or has been installed without ownership.
+func (g *getter) Owner(namespace, releaseName string) (string, error) {
+	store, err := g.store.Releases(namespace)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := store.Last(releaseName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("getting release %s: %w", releaseName, err)
+	}
+	return FromRelease(rel), nil
+}
+
+// FromRelease returns the UID of the composition that owns the Helm release, if any.
+func FromRelease(rel *release.Release) string {
+	if rel == nil {
+		return ""
+	}
+	return rel.Labels[Label]
+}
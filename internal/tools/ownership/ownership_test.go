@@ -0,0 +1,17 @@
+package ownership
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestFromRelease(t *testing.T) {
+	rel := &release.Release{Labels: Labels("0c2b4f4e-6f5e-4a8b-9d3a-2f1e0b7c9a11")}
+	assert.Equal(t, "0c2b4f4e-6f5e-4a8b-9d3a-2f1e0b7c9a11", FromRelease(rel))
+
+	assert.Empty(t, FromRelease(&release.Release{}))
+	assert.Empty(t, FromRelease(&release.Release{Labels: map[string]string{"team": "platform"}}))
+	assert.Empty(t, FromRelease(nil))
+}
@@ -0,0 +1,151 @@
+package rollout
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy limits how a new chart version is rolled out to the compositions of a definition.
+type Policy struct {
+	// MaxUnavailable is the maximum number of compositions that may be upgrading,
+	// or upgraded but not ready yet, at the same time. Zero means no limit.
+	MaxUnavailable int `json:"maxUnavailable,omitempty"`
+
+	// MaxFailures is the number of failed upgrades that halts the rollout. Zero means no limit.
+	MaxFailures int `json:"maxFailures,omitempty"`
+}
+
+// Enabled reports whether the policy limits the rollout in any way.
+func (p *Policy) Enabled() bool {
+	return p != nil && (p.MaxUnavailable > 0 || p.MaxFailures > 0)
+}
+
+// Member is a composition taking part in the rollout.
+type Member struct {
+	UID string
+	// ChartVersion is the chart version the composition is running.
+	ChartVersion string
+	// Available is true when the composition is ready and its resources have been found healthy
+	// since its last upgrade.
+	Available bool
+	// FailedChartVersion is the chart version of the last failed upgrade, if any.
+	FailedChartVersion string
+}
+
+// Progress is the state of the rollout of a chart version.
+type Progress struct {
+	ChartVersion string `json:"chartVersion"`
+	Total        int    `json:"total"`
+	Updated      int    `json:"updated"`
+	Upgrading    int    `json:"upgrading"`
+	Failed       int    `json:"failed"`
+	Halted       bool   `json:"halted,omitempty"`
+}
+
+// Decision tells whether a composition may be upgraded.
+type Decision int
+
+const (
+	// Admit means the composition may be upgraded now.
+	Admit Decision = iota
+	// Throttle means too many compositions are upgrading, the upgrade must be retried later.
+	Throttle
+	// Halt means too many upgrades failed, the rollout is stopped.
+	Halt
+)
+
+// Compute returns the progress of the rollout of the target chart version.
+// Compositions whose upgrade is in flight, or upgraded but not available yet, are counted as upgrading.
+func Compute(target string, members []Member, inFlight map[string]time.Time) Progress {
+	p := Progress{ChartVersion: target, Total: len(members)}
+	for _, m := range members {
+		_, flying := inFlight[m.UID]
+		switch {
+		case m.ChartVersion == target:
+			p.Updated++
+			if flying || !m.Available {
+				p.Upgrading++
+			}
+		case flying:
+			p.Upgrading++
+		case m.FailedChartVersion == target:
+			p.Failed++
+		}
+	}
+	return p
+}
+
+// Decide returns whether one more composition may be upgraded according to the policy.
+func (p *Progress) Decide(policy Policy) Decision {
+	if policy.MaxFailures > 0 && p.Failed >= policy.MaxFailures {
+		return Halt
+	}
+	if policy.MaxUnavailable > 0 && p.Upgrading >= policy.MaxUnavailable {
+		return Throttle
+	}
+	return Admit
+}
+
+// Tracker keeps track of the upgrades admitted by this process that have not completed yet,
+// grouped by definition. Entries older than the TTL are considered completed, so that a lost
+// completion never blocks a rollout forever.
+type Tracker struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	inFlight map[string]map[string]time.Time
+	now      func() time.Time
+}
+
+func NewTracker(ttl time.Duration) *Tracker {
+	return &Tracker{
+		ttl:      ttl,
+		inFlight: map[string]map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// Admit computes the progress of the rollout and, if the policy allows it, records
+// the upgrade of the composition with the given UID as in flight.
+// Deciding and recording happen atomically, so concurrent workers cannot exceed the policy.
+func (t *Tracker) Admit(key, uid, target string, members []Member, policy Policy) (Progress, Decision) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	flying := t.inFlight[key]
+	now := t.now()
+	for k, started := range flying {
+		if now.Sub(started) > t.ttl {
+			delete(flying, k)
+		}
+	}
+
+	progress := Compute(target, members, flying)
+	decision := progress.Decide(policy)
+	switch decision {
+	case Admit:
+		if flying == nil {
+			flying = map[string]time.Time{}
+			t.inFlight[key] = flying
+		}
+		if _, ok := flying[uid]; !ok {
+			flying[uid] = now
+			progress.Upgrading++
+		}
+	case Halt:
+		progress.Halted = true
+	}
+	return progress, decision
+}
+
+// Done marks the upgrade of the composition with the given UID as completed.
+func (t *Tracker) Done(uid string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, flying := range t.inFlight {
+		delete(flying, uid)
+		if len(flying) == 0 {
+			delete(t.inFlight, key)
+		}
+	}
+}
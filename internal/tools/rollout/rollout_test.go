@@ -0,0 +1,98 @@
+package rollout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompute(t *testing.T) {
+	members := []Member{
+		{UID: "a", ChartVersion: "2.0.0", Available: true},
+		{UID: "b", ChartVersion: "2.0.0", Available: false},
+		{UID: "c", ChartVersion: "1.0.0", FailedChartVersion: "2.0.0"},
+		{UID: "d", ChartVersion: "1.0.0", FailedChartVersion: "1.5.0"},
+		{UID: "e", ChartVersion: "1.0.0"},
+	}
+
+	p := Compute("2.0.0", members, map[string]time.Time{"e": time.Now()})
+	assert.Equal(t, Progress{ChartVersion: "2.0.0", Total: 5, Updated: 2, Upgrading: 2, Failed: 1}, p)
+}
+
+func TestDecide(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress Progress
+		policy   Policy
+		expected Decision
+	}{
+		{name: "no limits", progress: Progress{Upgrading: 10, Failed: 10}, policy: Policy{}, expected: Admit},
+		{name: "below max unavailable", progress: Progress{Upgrading: 1}, policy: Policy{MaxUnavailable: 2}, expected: Admit},
+		{name: "max unavailable reached", progress: Progress{Upgrading: 2}, policy: Policy{MaxUnavailable: 2}, expected: Throttle},
+		{name: "max failures reached", progress: Progress{Failed: 3}, policy: Policy{MaxUnavailable: 2, MaxFailures: 3}, expected: Halt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.progress.Decide(tt.policy))
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	members := []Member{
+		{UID: "a", ChartVersion: "1.0.0"},
+		{UID: "b", ChartVersion: "1.0.0"},
+		{UID: "c", ChartVersion: "1.0.0"},
+	}
+	policy := Policy{MaxUnavailable: 2}
+
+	now := time.Now()
+	tr := NewTracker(time.Minute)
+	tr.now = func() time.Time { return now }
+
+	p, d := tr.Admit("ns/def", "a", "2.0.0", members, policy)
+	assert.Equal(t, Admit, d)
+	assert.Equal(t, 1, p.Upgrading)
+
+	_, d = tr.Admit("ns/def", "b", "2.0.0", members, policy)
+	assert.Equal(t, Admit, d)
+
+	p, d = tr.Admit("ns/def", "c", "2.0.0", members, policy)
+	assert.Equal(t, Throttle, d)
+	assert.Equal(t, 2, p.Upgrading)
+
+	// Other definitions are not affected
+	_, d = tr.Admit("ns/other", "x", "2.0.0", []Member{{UID: "x"}}, policy)
+	assert.Equal(t, Admit, d)
+
+	tr.Done("a")
+	_, d = tr.Admit("ns/def", "c", "2.0.0", members, policy)
+	assert.Equal(t, Admit, d)
+
+	// Upgrades never reported as done expire
+	now = now.Add(2 * time.Minute)
+	p, d = tr.Admit("ns/def", "a", "2.0.0", members, policy)
+	assert.Equal(t, Admit, d)
+	assert.Equal(t, 1, p.Upgrading)
+}
+
+func TestTrackerHalt(t *testing.T) {
+	members := []Member{
+		{UID: "a", ChartVersion: "1.0.0", FailedChartVersion: "2.0.0"},
+		{UID: "b", ChartVersion: "1.0.0"},
+	}
+
+	tr := NewTracker(time.Minute)
+	p, d := tr.Admit("ns/def", "b", "2.0.0", members, Policy{MaxFailures: 1})
+	assert.Equal(t, Halt, d)
+	assert.True(t, p.Halted)
+}
+
+func TestPolicyEnabled(t *testing.T) {
+	var p *Policy
+	assert.False(t, p.Enabled())
+	assert.False(t, (&Policy{}).Enabled())
+	assert.True(t, (&Policy{MaxUnavailable: 1}).Enabled())
+}
@@ -0,0 +1,199 @@
+package valuesfrom
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/krateoplatformops/plumbing/maps"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	KindConfigMap = "ConfigMap"
+	KindSecret    = "Secret"
+
+	// DefaultKey is the key read when the reference does not set one.
+	DefaultKey = "values.yaml"
+)
+
+// Reference points to a key of a ConfigMap or Secret, in the namespace of the composition,
+// holding Helm values.
+type Reference struct {
+	// Kind is either ConfigMap or Secret.
+	Kind string `json:"kind"`
+
+	// Name of the ConfigMap or Secret.
+	Name string `json:"name"`
+
+	// Key holding the values, "values.yaml" if not set.
+	Key string `json:"key,omitempty"`
+
+	// JSONPath selects a part of the content of the key, parsed as YAML (e.g. "{.shared.database}").
+	JSONPath string `json:"jsonPath,omitempty"`
+
+	// TargetPath is the dotted path (e.g. "database.password") where the part selected by the JSON path,
+	// or else the content of the key as a plain string, is set. When empty, the content of the key or
+	// the part selected by the JSON path must be a map of values, that is merged at the root.
+	TargetPath string `json:"targetPath,omitempty"`
+
+	// Optional tells to skip the reference when the object or the key does not exist.
+	Optional bool `json:"optional,omitempty"`
+}
+
+func (r *Reference) key() string {
+	if r.Key == "" {
+		return DefaultKey
+	}
+	return r.Key
+}
+
+func (r *Reference) gvr() (schema.GroupVersionResource, error) {
+	switch r.Kind {
+	case KindConfigMap:
+		return schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, nil
+	case KindSecret:
+		return schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, nil
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("unsupported kind %q, must be %s or %s", r.Kind, KindConfigMap, KindSecret)
+}
+
+// Load reads the referenced values from the namespace and deep merges them in order,
+// so that the values of a reference override the ones of the previous references.
+func Load(ctx context.Context, dyn dynamic.Interface, namespace string, refs []Reference) (map[string]any, error) {
+	values := map[string]any{}
+	for i := range refs {
+		ref := &refs[i]
+		content, ok, err := read(ctx, dyn, namespace, ref)
+		if err != nil {
+			return nil, fmt.Errorf("reading values from %s %s/%s: %w", ref.Kind, namespace, ref.Name, err)
+		}
+		if !ok {
+			if ref.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("key %q not found in %s %s/%s", ref.key(), ref.Kind, namespace, ref.Name)
+		}
+
+		var value any = content
+		if ref.JSONPath != "" || ref.TargetPath == "" {
+			value, err = parse(content, ref.JSONPath)
+			if err != nil {
+				return nil, fmt.Errorf("parsing values from %s %s/%s key %q: %w", ref.Kind, namespace, ref.Name, ref.key(), err)
+			}
+		}
+
+		if ref.TargetPath != "" {
+			fields := maps.ParsePath(ref.TargetPath)
+			if len(fields) == 0 {
+				return nil, fmt.Errorf("invalid target path %q", ref.TargetPath)
+			}
+			err = maps.SetNestedField(values, value, fields...)
+			if err != nil {
+				return nil, fmt.Errorf("setting values from %s %s/%s at %q: %w", ref.Kind, namespace, ref.Name, ref.TargetPath, err)
+			}
+			continue
+		}
+
+		parsed, ok := value.(map[string]any)
+		if !ok && value != nil {
+			return nil, fmt.Errorf("values from %s %s/%s key %q are not a map", ref.Kind, namespace, ref.Name, ref.key())
+		}
+		values = Merge(values, parsed)
+	}
+	return values, nil
+}
+
+// parse parses the content of a key as YAML and returns the single value selected by the JSON path, if any.
+func parse(content, path string) (any, error) {
+	var parsed any
+	err := yaml.Unmarshal([]byte(content), &parsed)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return parsed, nil
+	}
+
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	jp := jsonpath.New("valuesFrom")
+	err = jp.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON path %q: %w", path, err)
+	}
+	results, err := jp.FindResults(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("evaluating JSON path %q: %w", path, err)
+	}
+	if len(results) != 1 || len(results[0]) != 1 {
+		return nil, fmt.Errorf("JSON path %q must select a single value", path)
+	}
+	return results[0][0].Interface(), nil
+}
+
+// read returns the content of the referenced key and whether the object and the key exist.
+func read(ctx context.Context, dyn dynamic.Interface, namespace string, ref *Reference) (string, bool, error) {
+	gvr, err := ref.gvr()
+	if err != nil {
+		return "", false, err
+	}
+	obj, err := dyn.Resource(gvr).Namespace(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	val, ok, err := unstructured.NestedString(obj.Object, "data", ref.key())
+	if err != nil || !ok {
+		return "", false, err
+	}
+	if ref.Kind == KindSecret {
+		b, err := base64.StdEncoding.DecodeString(val)
+		if err != nil {
+			return "", false, fmt.Errorf("decoding key %q: %w", ref.key(), err)
+		}
+		val = string(b)
+	}
+	return val, true, nil
+}
+
+// Merge deep merges src into dst and returns dst. Nested maps are merged recursively,
+// any other value of src replaces the one of dst.
+func Merge(dst, src map[string]any) map[string]any {
+	if dst == nil {
+		dst = map[string]any{}
+	}
+	for k, v := range src {
+		srcMap, srcIsMap := v.(map[string]any)
+		dstMap, dstIsMap := dst[k].(map[string]any)
+		if srcIsMap && dstIsMap {
+			dst[k] = Merge(dstMap, srcMap)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// objectKey identifies a referenced ConfigMap or Secret.
+type objectKey struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (k objectKey) String() string {
+	return strings.Join([]string{k.kind, k.namespace, k.name}, "/")
+}
@@ -0,0 +1,153 @@
+package valuesfrom
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newObject(kind, name string, data map[string]any) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "v1",
+		"kind":       kind,
+		"metadata":   map[string]any{"name": name, "namespace": "demo"},
+		"data":       data,
+	}}
+}
+
+func newDynamicClient(objs ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "configmaps"}: "ConfigMapList",
+		{Version: "v1", Resource: "secrets"}:    "SecretList",
+	}, objs...)
+}
+
+func TestLoad(t *testing.T) {
+	dyn := newDynamicClient(
+		newObject(KindConfigMap, "shared", map[string]any{
+			"values.yaml": "replicas: 2\nservice:\n  type: ClusterIP\n  port: 80\n",
+			"custom.yaml": "service:\n  port: 8080\n",
+			"shared.yaml": "database:\n  host: db\n  port: 5432\n",
+		}),
+		newObject(KindSecret, "credentials", map[string]any{
+			"password": base64.StdEncoding.EncodeToString([]byte("s3cr3t")),
+		}),
+	)
+
+	tests := []struct {
+		name     string
+		refs     []Reference
+		expected map[string]any
+		err      string
+	}{
+		{
+			name: "later references override earlier ones",
+			refs: []Reference{
+				{Kind: KindConfigMap, Name: "shared"},
+				{Kind: KindConfigMap, Name: "shared", Key: "custom.yaml"},
+			},
+			expected: map[string]any{
+				"replicas": float64(2),
+				"service":  map[string]any{"type": "ClusterIP", "port": float64(8080)},
+			},
+		},
+		{
+			name: "secret at target path",
+			refs: []Reference{
+				{Kind: KindConfigMap, Name: "shared", Key: "custom.yaml"},
+				{Kind: KindSecret, Name: "credentials", Key: "password", TargetPath: "database.password"},
+			},
+			expected: map[string]any{
+				"service":  map[string]any{"port": float64(8080)},
+				"database": map[string]any{"password": "s3cr3t"},
+			},
+		},
+		{
+			name: "map selected by JSON path",
+			refs: []Reference{
+				{Kind: KindConfigMap, Name: "shared", Key: "shared.yaml", JSONPath: "{.database}"},
+			},
+			expected: map[string]any{"host": "db", "port": float64(5432)},
+		},
+		{
+			name: "value selected by JSON path at target path",
+			refs: []Reference{
+				{Kind: KindConfigMap, Name: "shared", Key: "shared.yaml", JSONPath: ".database.port", TargetPath: "db.port"},
+			},
+			expected: map[string]any{"db": map[string]any{"port": float64(5432)}},
+		},
+		{
+			name: "value selected by JSON path without target path",
+			refs: []Reference{
+				{Kind: KindConfigMap, Name: "shared", Key: "shared.yaml", JSONPath: "{.database.host}"},
+			},
+			err: `values from ConfigMap demo/shared key "shared.yaml" are not a map`,
+		},
+		{
+			name: "JSON path not found",
+			refs: []Reference{
+				{Kind: KindConfigMap, Name: "shared", Key: "shared.yaml", JSONPath: "{.cache}"},
+			},
+			err: `evaluating JSON path "{.cache}"`,
+		},
+		{
+			name: "optional missing object and key",
+			refs: []Reference{
+				{Kind: KindConfigMap, Name: "missing", Optional: true},
+				{Kind: KindSecret, Name: "credentials", Key: "token", Optional: true},
+			},
+			expected: map[string]any{},
+		},
+		{
+			name: "required missing object",
+			refs: []Reference{{Kind: KindConfigMap, Name: "missing"}},
+			err:  `key "values.yaml" not found in ConfigMap demo/missing`,
+		},
+		{
+			name: "unsupported kind",
+			refs: []Reference{{Kind: "Pod", Name: "shared"}},
+			err:  `unsupported kind "Pod"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := Load(context.Background(), dyn, "demo", tt.refs)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, values)
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	dst := map[string]any{
+		"image":   map[string]any{"repository": "nginx", "tag": "1.0"},
+		"ports":   []any{80},
+		"enabled": true,
+	}
+	src := map[string]any{
+		"image":   map[string]any{"tag": "1.1"},
+		"ports":   []any{8080},
+		"enabled": map[string]any{"value": false},
+	}
+
+	assert.Equal(t, map[string]any{
+		"image":   map[string]any{"repository": "nginx", "tag": "1.1"},
+		"ports":   []any{8080},
+		"enabled": map[string]any{"value": false},
+	}, Merge(dst, src))
+
+	assert.Equal(t, map[string]any{"a": 1}, Merge(nil, map[string]any{"a": 1}))
+}
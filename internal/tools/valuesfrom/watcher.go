@@ -0,0 +1,312 @@
+package valuesfrom
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/metadata/metadatainformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchedResources are the resources of the kinds that can be referenced, by kind.
+var watchedResources = map[string]string{KindConfigMap: "configmaps", KindSecret: "secrets"}
+
+// Owner is a composition whose values come from ConfigMaps or Secrets.
+type Owner struct {
+	GVR       schema.GroupVersionResource
+	Namespace string
+	Name      string
+}
+
+// NotifyFunc is called for every owner of a referenced object that changed,
+// with a revision identifying the change.
+type NotifyFunc func(ctx context.Context, owner Owner, revision string) error
+
+// Watcher watches the ConfigMaps and Secrets referenced by the compositions and notifies
+// their owners when they change. Informers are started lazily, only for the namespaces
+// of the compositions that reference some object, and only cache the object metadata.
+// They are stopped once no owner of their namespace references any object.
+// Since it knows when the referenced objects change, it also caches the values loaded for
+// every owner until one of its objects changes.
+type Watcher struct {
+	client metadata.Interface
+	notify NotifyFunc
+
+	mu        sync.Mutex
+	owners    map[objectKey]map[Owner]struct{}
+	refs      map[Owner][]objectKey
+	informers map[string]*namespaceInformers
+	inUse     map[string]int
+	values    map[Owner]loadedValues
+	changes   uint64
+}
+
+// namespaceInformers are the informers running in a namespace, with the function stopping them.
+type namespaceInformers struct {
+	informers []cache.SharedIndexInformer
+	stop      context.CancelFunc
+}
+
+// loadedValues are the values loaded for an owner from its references.
+type loadedValues struct {
+	refs   []Reference
+	values map[string]any
+}
+
+// NewWatcher returns a Watcher that notifies the owners by setting the given annotation
+// to the revision of the changed object.
+func NewWatcher(cfg *rest.Config, annotation string) (*Watcher, error) {
+	client, err := metadata.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating metadata client: %w", err)
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("creating dynamic client: %w", err)
+	}
+	return newWatcher(client, annotateOwner(dyn, annotation)), nil
+}
+
+func newWatcher(client metadata.Interface, notify NotifyFunc) *Watcher {
+	return &Watcher{
+		client:    client,
+		notify:    notify,
+		owners:    map[objectKey]map[Owner]struct{}{},
+		refs:      map[Owner][]objectKey{},
+		informers: map[string]*namespaceInformers{},
+		inUse:     map[string]int{},
+		values:    map[Owner]loadedValues{},
+	}
+}
+
+// annotateOwner patches the annotation of the owner, so that the controller reconciles it.
+func annotateOwner(dyn dynamic.Interface, annotation string) NotifyFunc {
+	return func(ctx context.Context, owner Owner, revision string) error {
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, annotation, revision)
+		_, err := dyn.Resource(owner.GVR).Namespace(owner.Namespace).
+			Patch(ctx, owner.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+		return err
+	}
+}
+
+// Track records the objects referenced by the owner, replacing the ones recorded before.
+// It is safe to call on a nil Watcher.
+func (w *Watcher) Track(owner Owner, refs []Reference) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.untrack(owner)
+	if len(refs) == 0 {
+		delete(w.values, owner)
+		w.stopUnused(owner.Namespace)
+		return
+	}
+
+	keys := make([]objectKey, 0, len(refs))
+	for _, ref := range refs {
+		key := objectKey{kind: ref.Kind, namespace: owner.Namespace, name: ref.Name}
+		if w.owners[key] == nil {
+			w.owners[key] = map[Owner]struct{}{}
+		}
+		w.owners[key][owner] = struct{}{}
+		keys = append(keys, key)
+	}
+	w.refs[owner] = keys
+	w.inUse[owner.Namespace]++
+
+	if _, ok := w.informers[owner.Namespace]; !ok {
+		w.informers[owner.Namespace] = w.start(owner.Namespace)
+	}
+}
+
+// Load returns the values referenced by the owner, as Load does. The values are read again only
+// when the references of the owner or one of the referenced objects changed since the last load,
+// or when the informers of the namespace have not listed the objects yet. The owner must be tracked
+// with the same references for its values to be cached. On a nil Watcher the values are always read.
+func (w *Watcher) Load(ctx context.Context, dyn dynamic.Interface, owner Owner, refs []Reference) (map[string]any, error) {
+	if w == nil {
+		return Load(ctx, dyn, owner.Namespace, refs)
+	}
+
+	w.mu.Lock()
+	loaded, ok := w.values[owner]
+	changes := w.changes
+	w.mu.Unlock()
+	if ok && reflect.DeepEqual(loaded.refs, refs) {
+		return runtime.DeepCopyJSON(loaded.values), nil
+	}
+
+	values, err := Load(ctx, dyn, owner.Namespace, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// A change notified while loading may have been missed by the read, the values are not cached
+	if changes == w.changes && w.tracked(owner, refs) && w.synced(owner.Namespace) {
+		w.values[owner] = loadedValues{
+			refs:   append([]Reference(nil), refs...),
+			values: runtime.DeepCopyJSON(values),
+		}
+	}
+	return values, nil
+}
+
+// tracked reports whether the owner is tracked with the given references.
+func (w *Watcher) tracked(owner Owner, refs []Reference) bool {
+	keys := w.refs[owner]
+	if len(keys) != len(refs) {
+		return false
+	}
+	for i, ref := range refs {
+		if keys[i] != (objectKey{kind: ref.Kind, namespace: owner.Namespace, name: ref.Name}) {
+			return false
+		}
+	}
+	return true
+}
+
+// synced reports whether the informers of the namespace have listed the existing objects,
+// after which no change of the referenced objects can be missed.
+func (w *Watcher) synced(namespace string) bool {
+	running, ok := w.informers[namespace]
+	if !ok || len(running.informers) != len(watchedResources) {
+		return false
+	}
+	for _, informer := range running.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// Untrack forgets the objects referenced by the owner. It is safe to call on a nil Watcher.
+func (w *Watcher) Untrack(owner Owner) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.untrack(owner)
+	delete(w.values, owner)
+	w.stopUnused(owner.Namespace)
+}
+
+func (w *Watcher) untrack(owner Owner) {
+	keys, ok := w.refs[owner]
+	if !ok {
+		return
+	}
+	for _, key := range keys {
+		delete(w.owners[key], owner)
+		if len(w.owners[key]) == 0 {
+			delete(w.owners, key)
+		}
+	}
+	delete(w.refs, owner)
+
+	w.inUse[owner.Namespace]--
+	if w.inUse[owner.Namespace] <= 0 {
+		delete(w.inUse, owner.Namespace)
+	}
+}
+
+// stopUnused stops the informers of the namespace when no owner of the namespace references any object.
+func (w *Watcher) stopUnused(namespace string) {
+	if w.inUse[namespace] > 0 {
+		return
+	}
+	running, ok := w.informers[namespace]
+	if !ok {
+		return
+	}
+	running.stop()
+	delete(w.informers, namespace)
+}
+
+// start runs the metadata informers of ConfigMaps and Secrets in the namespace until they are stopped.
+func (w *Watcher) start(namespace string) *namespaceInformers {
+	ctx, cancel := context.WithCancel(context.Background())
+	informers := make([]cache.SharedIndexInformer, 0, len(watchedResources))
+	for kind, resource := range watchedResources {
+		gvr := schema.GroupVersionResource{Version: "v1", Resource: resource}
+		informer := metadatainformer.NewFilteredMetadataInformer(w.client, gvr, namespace, 0, cache.Indexers{}, nil).Informer()
+		_, err := informer.AddEventHandler(w.handler(kind))
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("watching %s in namespace %s: %w", resource, namespace, err))
+			continue
+		}
+		go informer.Run(ctx.Done())
+		informers = append(informers, informer)
+	}
+	return &namespaceInformers{informers: informers, stop: cancel}
+}
+
+func (w *Watcher) handler(kind string) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			if !isInInitialList {
+				w.changed(kind, obj, false)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj any) {
+			o, okOld := oldObj.(*metav1.PartialObjectMetadata)
+			n, okNew := newObj.(*metav1.PartialObjectMetadata)
+			if okOld && okNew && o.ResourceVersion == n.ResourceVersion {
+				return
+			}
+			w.changed(kind, newObj, false)
+		},
+		DeleteFunc: func(obj any) {
+			if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = d.Obj
+			}
+			w.changed(kind, obj, true)
+		},
+	}
+}
+
+// changed notifies the owners of the object, if any.
+func (w *Watcher) changed(kind string, obj any, deleted bool) {
+	m, ok := obj.(*metav1.PartialObjectMetadata)
+	if !ok {
+		return
+	}
+	key := objectKey{kind: kind, namespace: m.Namespace, name: m.Name}
+
+	w.mu.Lock()
+	w.changes++
+	owners := make([]Owner, 0, len(w.owners[key]))
+	for owner := range w.owners[key] {
+		owners = append(owners, owner)
+		delete(w.values, owner)
+	}
+	w.mu.Unlock()
+
+	revision := fmt.Sprintf("%s@%s", key, m.ResourceVersion)
+	if deleted {
+		revision = fmt.Sprintf("%s@deleted", key)
+	}
+	for _, owner := range owners {
+		err := w.notify(context.Background(), owner, revision)
+		if err != nil {
+			utilruntime.HandleError(fmt.Errorf("notifying %s/%s of the change of %s: %w", owner.Namespace, owner.Name, key, err))
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package valuesfrom
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+type notifications struct {
+	mu   sync.Mutex
+	sent map[Owner][]string
+}
+
+func (n *notifications) notify(_ context.Context, owner Owner, revision string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent[owner] = append(n.sent[owner], revision)
+	return nil
+}
+
+func (n *notifications) get(owner Owner) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.sent[owner]...)
+}
+
+func newConfigMapMetadata(name, resourceVersion string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "demo", ResourceVersion: resourceVersion},
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	client := metadatafake.NewSimpleMetadataClient(scheme, newConfigMapMetadata("shared", "1"))
+
+	n := &notifications{sent: map[Owner][]string{}}
+	w := newWatcher(client, n.notify)
+
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-2-0", Resource: "fireworksapps"}
+	tracked := Owner{GVR: gvr, Namespace: "demo", Name: "tracked"}
+	untracked := Owner{GVR: gvr, Namespace: "demo", Name: "untracked"}
+	w.Track(tracked, []Reference{{Kind: KindConfigMap, Name: "shared"}})
+	w.Track(untracked, []Reference{{Kind: KindConfigMap, Name: "shared"}})
+	w.Untrack(untracked)
+
+	configmaps := client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("demo")
+	// Give the informer the time to list the existing objects, which must not notify anybody
+	time.Sleep(200 * time.Millisecond)
+	_, err := configmaps.(metadatafake.MetadataClient).UpdateFake(newConfigMapMetadata("shared", "2"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(n.get(tracked)) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, []string{"ConfigMap/demo/shared@2"}, n.get(tracked))
+	assert.Empty(t, n.get(untracked))
+
+	require.NoError(t, configmaps.Delete(context.Background(), "shared", metav1.DeleteOptions{}))
+	require.Eventually(t, func() bool {
+		return len(n.get(tracked)) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "ConfigMap/demo/shared@deleted", n.get(tracked)[1])
+}
+
+func TestWatcher_StopUnused(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	w := newWatcher(metadatafake.NewSimpleMetadataClient(scheme), (&notifications{sent: map[Owner][]string{}}).notify)
+
+	running := func(namespace string) bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		_, ok := w.informers[namespace]
+		return ok
+	}
+
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-2-0", Resource: "fireworksapps"}
+	first := Owner{GVR: gvr, Namespace: "demo", Name: "first"}
+	second := Owner{GVR: gvr, Namespace: "demo", Name: "second"}
+	refs := []Reference{{Kind: KindConfigMap, Name: "shared"}}
+
+	w.Track(first, refs)
+	w.Track(second, refs)
+	// Tracking the same references again keeps the informers running
+	w.Track(first, refs)
+	assert.True(t, running("demo"))
+
+	w.Untrack(first)
+	assert.True(t, running("demo"), "the informers are still needed by the other owner")
+
+	// An owner whose definition no longer has valuesFrom is tracked with no references
+	w.Track(second, nil)
+	assert.False(t, running("demo"))
+
+	w.Track(first, refs)
+	assert.True(t, running("demo"), "the informers are started again when needed")
+	w.Untrack(first)
+	assert.False(t, running("demo"))
+}
+
+func TestWatcher_Nil(t *testing.T) {
+	var w *Watcher
+	assert.NotPanics(t, func() {
+		w.Track(Owner{Name: "demo"}, []Reference{{Kind: KindConfigMap, Name: "shared"}})
+		w.Untrack(Owner{Name: "demo"})
+	})
+
+	values, err := w.Load(context.Background(), newDynamicClient(newObject(KindConfigMap, "shared", map[string]any{"values.yaml": "replicas: 2"})),
+		Owner{Namespace: "demo", Name: "demo"}, []Reference{{Kind: KindConfigMap, Name: "shared"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"replicas": float64(2)}, values)
+}
+
+func TestWatcher_Load(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+	client := metadatafake.NewSimpleMetadataClient(scheme, newConfigMapMetadata("shared", "1"))
+	dyn := newDynamicClient(newObject(KindConfigMap, "shared", map[string]any{"values.yaml": "replicas: 2"}))
+
+	n := &notifications{sent: map[Owner][]string{}}
+	w := newWatcher(client, n.notify)
+
+	owner := Owner{GVR: schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1-2-0", Resource: "fireworksapps"}, Namespace: "demo", Name: "tracked"}
+	refs := []Reference{{Kind: KindConfigMap, Name: "shared"}}
+	w.Track(owner, refs)
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.synced("demo")
+	}, 5*time.Second, 50*time.Millisecond)
+
+	values, err := w.Load(context.Background(), dyn, owner, refs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"replicas": float64(2)}, values)
+
+	// The returned values belong to the caller
+	values["replicas"] = float64(5)
+
+	// Until the object is reported as changed, the values are not read again
+	configmaps := dyn.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("demo")
+	_, err = configmaps.Update(context.Background(), newObject(KindConfigMap, "shared", map[string]any{"values.yaml": "replicas: 3"}), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	values, err = w.Load(context.Background(), dyn, owner, refs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"replicas": float64(2)}, values)
+
+	_, err = client.Resource(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}).Namespace("demo").(metadatafake.MetadataClient).
+		UpdateFake(newConfigMapMetadata("shared", "2"), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return len(n.get(owner)) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	values, err = w.Load(context.Background(), dyn, owner, refs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"replicas": float64(3)}, values)
+}
@@ -172,7 +172,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	handler := composition.NewHandler(cfg, pig, *event.NewAPIRecorder(rec), *pluralizer, mapper, *urlChartInspector, *saName, *saNamespace)
+	handler, err := composition.NewHandler(cfg, pig, *event.NewAPIRecorder(rec), *pluralizer, mapper, *urlChartInspector, *saName, *saNamespace)
+	if err != nil {
+		log.Error(err, "Creating composition handler.")
+		os.Exit(1)
+	}
 
 	opts := []builder.FuncOption{
 		builder.WithLogger(log),
@@ -184,6 +188,12 @@ func main() {
 			LabelSelector: ptr.To(labelselector.String()),
 		}),
 		builder.WithActionEvent(ctrlevent.CRUpdated, ctrlevent.Observe),
+		// Reconcile the compositions whose valuesFrom ConfigMaps or Secrets changed
+		builder.WithWatchAnnotations(ctrlevent.AnnotationEvent{
+			EventType:  ctrlevent.Observe,
+			Annotation: meta.AnnotationKeyValuesFromRevision,
+			OnAction:   ctrlevent.OnAny,
+		}),
 	}
 
 	metricsServerBindAddress := ""